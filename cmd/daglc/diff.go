@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/vuuihc/gfc/generators"
+)
+
+// runDiff compares two graphs structurally. Like diff, it exits with 0 if the
+// graphs are equivalent, 1 if they are not and 2 on errors.
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	opts := optimizeFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: daglc diff [flags] <old> <new>")
+		fmt.Fprintln(stderr, "old and new are dagl files or compiled json or msgpack graphs")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	var graphs [2]*generators.Graph
+	for i := range graphs {
+		graph, err := loadGraph(flags.Arg(i), compileOptions{optimize: opts()})
+		if err != nil {
+			fmt.Fprintf(stderr, "daglc diff: %v\n", err)
+			return 2
+		}
+		graphs[i] = graph
+	}
+	diff, err := generators.DiffGraphs(graphs[0], graphs[1])
+	if err == nil {
+		err = diff.Write(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "daglc diff: %v\n", err)
+		return 2
+	}
+	if !diff.Equivalent() {
+		return 1
+	}
+	return 0
+}
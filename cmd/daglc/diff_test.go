@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunDiff tests the exit codes and output of diffing graphs
+func TestRunDiff(t *testing.T) {
+	oldPath := writeTestFile(t, "old.dagl", testCode)
+	var stdout, stderr bytes.Buffer
+	compiled := filepath.Join(t.TempDir(), "old.json")
+	require.Equal(t, 0, run([]string{"graph", "-o", compiled, oldPath}, &stdout, &stderr), stderr.String())
+	require.Equal(t, 0, run([]string{"diff", compiled, oldPath}, &stdout, &stderr), stderr.String())
+	require.Empty(t, stdout.String())
+
+	newPath := writeTestFile(t, "new.dagl", `
+func main(input) {
+	builtin("jq", input, filter='.payload');
+}`)
+	require.Equal(t, 1, run([]string{"diff", compiled, newPath}, &stdout, &stderr), stderr.String())
+	require.Equal(t, "- node unused = builtin.jq(input) filter=\".unused\"\n", stdout.String())
+
+	// 优化掉无用的节点后两个图等价
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"diff", "-O", compiled, newPath}, &stdout, &stderr), stderr.String())
+	require.Empty(t, stdout.String())
+
+	require.Equal(t, 2, run([]string{"diff", compiled}, &stdout, &stderr))
+	require.Equal(t, 2, run([]string{"diff", compiled, filepath.Join(t.TempDir(), "missing.json")}, &stdout, &stderr))
+}
+
+// TestRunDiffBaseline tests comparing a graph of an older compiler with a newly compiled one
+func TestRunDiffBaseline(t *testing.T) {
+	oldPath := writeTestFile(t, "old.json", baselineGraph)
+	newPath := writeTestFile(t, "main.dagl", readmeCode)
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, run([]string{"diff", oldPath, newPath}, &stdout, &stderr), stderr.String())
+	require.Empty(t, stdout.String())
+
+	// 只有真正的改动才会被报告
+	changed := writeTestFile(t, "changed.dagl", strings.Replace(readmeCode, "timeout=\"800ms\"", "timeout=\"500ms\"", 1))
+	require.Equal(t, 1, run([]string{"diff", oldPath, changed}, &stdout, &stderr), stderr.String())
+	require.Equal(t, `~ node result: args.timeout "800ms" -> "500ms"`+"\n", stdout.String())
+}
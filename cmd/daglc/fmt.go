@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// runFmt formats dagl files. By default the formatted source is written to stdout.
+func runFmt(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result to the file instead of stdout")
+	diff := flags.Bool("d", false, "print a unified diff instead of the formatted source")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: daglc fmt [flags] <file.dagl>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	code := 0
+	for _, path := range flags.Args() {
+		if err := formatFile(path, *write, *diff, stdout); err != nil {
+			fmt.Fprintf(stderr, "daglc fmt: %v\n", err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// formatFile formats a dagl file
+func formatFile(path string, write, diff bool, stdout io.Writer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.WrapIf(err, "read source")
+	}
+	src := string(data)
+	formatted, err := parser.Format(src)
+	if err != nil {
+		return sourceError(path, err)
+	}
+	if diff {
+		_, err = io.WriteString(stdout, unifiedDiff(path+".orig", path, src, formatted))
+		if err != nil {
+			return err
+		}
+	}
+	if write {
+		if formatted == src {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return errors.WrapIf(os.WriteFile(path, []byte(formatted), info.Mode().Perm()), "write source")
+	}
+	if !diff {
+		_, err = io.WriteString(stdout, formatted)
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunFmt tests printing, diffing and rewriting formatted files
+func TestRunFmt(t *testing.T) {
+	path := writeTestFile(t, "main.dagl", `func main(input) {
+	unused=builtin("jq", input, filter=".unused");
+	builtin("jq", input, filter='.payload');
+}
+`)
+	formatted := `func main(input) {
+    unused = builtin("jq", input, filter='.unused');
+    builtin("jq", input, filter='.payload');
+}
+`
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, run([]string{"fmt", path}, &stdout, &stderr), stderr.String())
+	require.Equal(t, formatted, stdout.String())
+
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"fmt", "-d", path}, &stdout, &stderr), stderr.String())
+	require.Equal(t, `--- `+path+`.orig
++++ `+path+`
+@@ -1,4 +1,4 @@
+ func main(input) {
+-	unused=builtin("jq", input, filter=".unused");
+-	builtin("jq", input, filter='.payload');
++    unused = builtin("jq", input, filter='.unused');
++    builtin("jq", input, filter='.payload');
+ }
+`, stdout.String())
+
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"fmt", "-w", path}, &stdout, &stderr), stderr.String())
+	require.Empty(t, stdout.String())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, formatted, string(data))
+
+	// 已经格式化的文件没有差异
+	require.Equal(t, 0, run([]string{"fmt", "-d", path}, &stdout, &stderr), stderr.String())
+	require.Empty(t, stdout.String())
+
+	require.Equal(t, 2, run([]string{"fmt"}, &stdout, &stderr))
+	require.Equal(t, 1, run([]string{"fmt", filepath.Join(t.TempDir(), "missing.dagl")}, &stdout, &stderr))
+}
+
+// TestUnifiedDiff tests splitting changes into hunks with context
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	require.Equal(t, `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,4 +9,3 @@
+ i
+ j
+ k
+-l
+`, unifiedDiff("old", "new", old, new))
+	require.Equal(t, "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+a\n", unifiedDiff("old", "new", "", "a\n"))
+	require.Empty(t, unifiedDiff("old", "new", old, old))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/generators"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// runGraph compiles a dagl file, or loads a compiled graph, and writes it in the given format.
+// The dagl format decompiles a graph back into dagl source.
+func runGraph(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("graph", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "json", "output format: json, msgpack, dot, mermaid or dagl")
+	output := flags.String("o", "", "output file, default stdout")
+	opts := optimizeFlags(flags)
+	source := flags.Bool("source", false, "record the dagl source position and inline call stack of every node")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: daglc graph [flags] <file.dagl|graph.json|graph.msgpack>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	graph, err := loadGraph(flags.Arg(0), compileOptions{optimize: opts(), source: *source})
+	if err != nil {
+		fmt.Fprintf(stderr, "daglc graph: %v\n", err)
+		return 1
+	}
+	w := stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(stderr, "daglc graph: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeGraph(w, graph, *format); err != nil {
+		fmt.Fprintf(stderr, "daglc graph: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// optimizeFlags registers the optimization flags and returns a function reading them
+func optimizeFlags(flags *flag.FlagSet) func() generators.OptimizeOptions {
+	all := flags.Bool("O", false, "enable all optimizations")
+	dce := flags.Bool("dce", false, "eliminate dead nodes")
+	cse := flags.Bool("cse", false, "eliminate common subexpressions")
+	fuseJq := flags.Bool("fuse-jq", false, "fuse chains of jq nodes")
+	identity := flags.Bool("identity", false, "eliminate identity nodes")
+	return func() generators.OptimizeOptions {
+		return generators.OptimizeOptions{
+			EliminateDeadNodes:            *all || *dce,
+			EliminateCommonSubexpressions: *all || *cse,
+			FuseJqNodes:                   *all || *fuseJq,
+			EliminateIdentityNodes:        *all || *identity,
+		}
+	}
+}
+
+// compileOptions are the options of compiling a dagl file
+type compileOptions struct {
+	optimize generators.OptimizeOptions
+	// source 在节点上记录源码位置
+	source bool
+}
+
+// loadGraph loads a compiled graph from json or msgpack, checking its structure
+// and upgrading graphs of older compilers with Normalize, or compiles a dagl file
+func loadGraph(path string, opts compileOptions) (*generators.Graph, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WrapIf(err, "read graph")
+	}
+	var graph *generators.Graph
+	switch filepath.Ext(path) {
+	case ".json":
+		graph, err = generators.UnmarshalGraphJSON(data)
+	case ".msgpack", ".msg":
+		graph, err = generators.UnmarshalGraphMsgpack(data)
+	default:
+		statements, err := parser.NewParser(string(data)).TryParse()
+		if err != nil {
+			return nil, sourceError(path, err)
+		}
+		generator := generators.NewGFGenerator(statements).WithOptimizeOptions(opts.optimize)
+		if opts.source {
+			generator.WithSource(path)
+		}
+		graph, err := generator.Generate()
+		if err != nil {
+			return nil, sourceError(path, err)
+		}
+		return graph, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 外部的图可能引用不存在的节点，优化之前先校验。旧的编译器生成的图入度的算法不同，
+	// 也没有响应节点，只校验结构，再升级成当前的格式
+	if err := graph.ValidateStructure(); err != nil {
+		return nil, errors.WrapIff(err, "invalid graph %s", path)
+	}
+	graph.Normalize()
+	graph.Optimize(opts.optimize)
+	return graph, nil
+}
+
+// sourceError prefixes an error in a dagl file with the file name and position, like file:line:column
+func sourceError(path string, err error) error {
+	var e *parser.Error
+	if errors.As(err, &e) && e.Pos.IsValid() {
+		return errors.Errorf("%s:%s: %s", path, e.Pos, e.Msg)
+	}
+	return errors.Errorf("%s: %v", path, err)
+}
+
+// writeGraph writes a graph in the given format
+func writeGraph(w io.Writer, graph *generators.Graph, format string) error {
+	switch format {
+	case "json":
+		return graph.WriteJSON(w)
+	case "msgpack":
+		return graph.WriteMsgpack(w)
+	case "dot":
+		return graph.WriteDOT(w)
+	case "mermaid":
+		return graph.WriteMermaid(w)
+	case "dagl":
+		return graph.WriteDagl(w)
+	default:
+		return errors.Errorf("unknown format %q", format)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/generators"
+)
+
+// writeTestFile writes a file into a temporary directory and returns its path
+func writeTestFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+const testCode = `
+func main(input) {
+	unused=builtin("jq", input, filter='.unused');
+	builtin("jq", input, filter='.payload');
+}`
+
+// TestRunGraph tests compiling a dagl file to the supported formats
+func TestRunGraph(t *testing.T) {
+	path := writeTestFile(t, "main.dagl", testCode)
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, run([]string{"graph", path}, &stdout, &stderr), stderr.String())
+	graph, err := generators.UnmarshalGraphJSON(stdout.Bytes())
+	require.NoError(t, err)
+	require.Len(t, graph.Nodes, 3)
+
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"graph", "-O", "--format", "dot", path}, &stdout, &stderr), stderr.String())
+	require.True(t, strings.HasPrefix(stdout.String(), "digraph gflow {"))
+	require.NotContains(t, stdout.String(), ".unused")
+
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"graph", "--format", "mermaid", path}, &stdout, &stderr), stderr.String())
+	require.Contains(t, stdout.String(), `n2["2: jq = builtin.jq<br/>filter=.payload"]`)
+	require.NotContains(t, stdout.String(), "subgraph")
+
+	stdout.Reset()
+	output := filepath.Join(t.TempDir(), "graph.msgpack")
+	require.Equal(t, 0, run([]string{"graph", "--format", "msgpack", "-o", output, path}, &stdout, &stderr), stderr.String())
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"graph", "--format", "dot", output}, &stdout, &stderr), stderr.String())
+	require.Contains(t, stdout.String(), "filter=.unused")
+
+	// 把编译好的图反编译成dagl
+	stdout.Reset()
+	output = filepath.Join(t.TempDir(), "graph.json")
+	require.Equal(t, 0, run([]string{"graph", "-o", output, path}, &stdout, &stderr), stderr.String())
+	require.Equal(t, 0, run([]string{"graph", "--format", "dagl", output}, &stdout, &stderr), stderr.String())
+	require.Equal(t, `func main(input) {
+    unused = builtin("jq", input, filter='.unused');
+    builtin("jq", input, filter='.payload');
+}
+`, stdout.String())
+}
+
+// TestRunGraphErrors tests the exit codes of invalid invocations
+func TestRunGraphErrors(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 2, run(nil, &stdout, &stderr))
+	require.Equal(t, 2, run([]string{"unknown"}, &stdout, &stderr))
+	require.Equal(t, 2, run([]string{"graph"}, &stdout, &stderr))
+	require.Equal(t, 1, run([]string{"graph", filepath.Join(t.TempDir(), "missing.dagl")}, &stdout, &stderr))
+	path := writeTestFile(t, "main.dagl", testCode)
+	require.Equal(t, 1, run([]string{"graph", "--format", "yaml", path}, &stdout, &stderr))
+
+	// 引用不存在的节点的图在优化之前被拒绝
+	stderr.Reset()
+	path = writeTestFile(t, "bad.json", `{"nodes": [{"type": "builtin.start"}, {"type": "builtin.jq", "inputs": [5], "in_degree": 1, "is_response": true}]}`)
+	require.Equal(t, 1, run([]string{"graph", "-O", path}, &stdout, &stderr))
+	require.Contains(t, stderr.String(), "daglc graph: invalid graph "+path+": ")
+}
+
+// baselineGraph is the README example compiled by the compiler before node names,
+// response nodes and in degrees counting both inputs and dependencies
+const baselineGraph = `{"nodes": [
+	{"type": "builtin.start", "in_degree": 0},
+	{"type": "builtin.jq", "args": {"filter": [".payload | fromjson"]}, "in_degree": 1, "inputs": [0]},
+	{"type": "builtin.jq", "args": {"filter": [".suggestion_type+\"##\"+(.filter_retrievers//[]|join(\"#\"))+\"##\"+(.context//[]|join(\"#\"))+\"##\"+.query"]}, "in_degree": 1, "inputs": [1]},
+	{"type": "builtin.lookup_cache", "args": {"prefix": ["ime_rec_bert_ner_v1"]}, "in_degree": 1, "inputs": [2]},
+	{"type": "builtin.http", "args": {"default_value": ["{\"actions\":[]}"], "endpoint": ["http://192002625-146479.Production/suggestion/"], "max_retry_times": ["3"], "method": ["post"], "timeout": ["800ms"]}, "in_degree": 1, "inputs": [1]},
+	{"type": "builtin.jq", "args": {"filter": ["{\"key\": .[0], \"payload\": .[1], \"ttl\": 259200000}"]}, "in_degree": 2, "inputs": [2, 4]},
+	{"type": "builtin.set_cache", "args": {"prefix": ["ime_rec_bert_ner_v1"]}, "in_degree": 1, "inputs": [5]},
+	{"type": "builtin.jq", "args": {"filter": [".found | not"]}, "in_degree": 1, "inputs": [3]},
+	{"type": "builtin.when_true", "in_degree": 1, "inputs": [7]},
+	{"type": "builtin.identity", "in_degree": 1, "inputs": [4], "dependencies": [8]},
+	{"type": "builtin.when_false", "in_degree": 1, "inputs": [7]},
+	{"type": "builtin.jq", "args": {"filter": [".payload"]}, "in_degree": 1, "inputs": [3], "dependencies": [10]},
+	{"type": "builtin.when_any", "in_degree": 2, "inputs": [9, 11]}
+]}`
+
+// readmeCode is the full example of the README, which baselineGraph was compiled from
+const readmeCode = "" +
+	"// a function to get cache key\n" +
+	"inline func getCacheKey(input) {\n" +
+	"  builtin(\"jq\",input,filter=`.suggestion_type+\"##\"+(.filter_retrievers//[]|join(\"#\"))+\"##\"+(.context//[]|join(\"#\"))+\"##\"+.query`);\n" +
+	"}\n" +
+	"\n" +
+	"// a function to set cache\n" +
+	"inline func setCache(key, result) {\n" +
+	"\tcacheReq=builtin(\"jq\",[key,result],filter=`{\"key\": .[0], \"payload\": .[1], \"ttl\": 259200000}`);\n" +
+	"\tbuiltin(\"set_cache\", cacheReq, prefix=`ime_rec_bert_ner_v1`);\n" +
+	"}\n" +
+	"\n" +
+	"// a function to lookup cache\n" +
+	"inline func lookupCache(key){\n" +
+	"  builtin(\"lookup_cache\", key, prefix=`ime_rec_bert_ner_v1`);\n" +
+	"}\n" +
+	"\n" +
+	"func main(input) {\n" +
+	"    input = builtin(\"jq\", input, filter=`.payload | fromjson`);\n" +
+	"    key=@call(getCacheKey, [input]);\n" +
+	"    cacheRes=@call(lookupCache,[key]);\n" +
+	"    result=builtin(\"http\", input, endpoint=`http://192002625-146479.Production/suggestion/`,\n" +
+	"        method=`post`, max_retry_times=\"3\", default_value=`{\"actions\":[]}`, timeout=\"800ms\");\n" +
+	"    @call(setCache, [key, result]);\n" +
+	"    cacheMiss=builtin(\"jq\", cacheRes, filter=`.found | not`);\n" +
+	"    if(cacheMiss){\n" +
+	"      result;\n" +
+	"    }else{\n" +
+	"      builtin(\"jq\", cacheRes, filter=`.payload`);\n" +
+	"    }\n" +
+	"}\n" +
+	"\n" +
+	"// {\"payload\": \"{\\\"request_id\\\":\\\"1674\\\",\\\"request_type\\\":7,\\\"context\\\":[],\\\"context_interval\\\":[],\\\"query\\\":\\\"红楼梦小姐姐\\\",\\\"uid\\\":\\\"1674\\\",\\\"api_level\\\":0}\"}\n"
+
+// TestRunGraphBaseline tests loading a graph of an older compiler
+func TestRunGraphBaseline(t *testing.T) {
+	path := writeTestFile(t, "old.json", baselineGraph)
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, run([]string{"graph", "--format", "dot", path}, &stdout, &stderr), stderr.String())
+	require.Contains(t, stdout.String(), "digraph")
+
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"graph", "--format", "dagl", path}, &stdout, &stderr), stderr.String())
+	require.Contains(t, stdout.String(), "func main(")
+
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"graph", "-O", path}, &stdout, &stderr), stderr.String())
+	graph, err := generators.UnmarshalGraphJSON(stdout.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, graph.Validate())
+	require.Equal(t, "builtin.when_any", graph.Nodes[len(graph.Nodes)-1].Type)
+	require.True(t, graph.Nodes[len(graph.Nodes)-1].IsResponse)
+}
+
+// TestRunGraphSourceErrors tests reporting syntax and generator errors with their positions
+func TestRunGraphSourceErrors(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := writeTestFile(t, "main.dagl", "func main(input) {\n  builtin(\"jq\", input filter='.a');\n}")
+	require.Equal(t, 1, run([]string{"graph", path}, &stdout, &stderr))
+	require.Equal(t, "daglc graph: "+path+":2:23: expect ), got identifier filter\n", stderr.String())
+
+	stderr.Reset()
+	path = writeTestFile(t, "main.dagl", "func main(input) {\n  builtin(\"jq\", key, filter='.a');\n}")
+	require.Equal(t, 1, run([]string{"graph", path}, &stdout, &stderr))
+	require.Equal(t, "daglc graph: "+path+`:2:3: invalid input node: undefined variable "key"`+"\n", stderr.String())
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vuuihc/gfc/lsp"
+)
+
+// runLsp serves the language server protocol over stdin and stdout
+func runLsp(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 0 {
+		fmt.Fprintln(stderr, "usage: daglc lsp")
+		return 2
+	}
+	if err := lsp.NewServer(os.Stdin, stdout).Run(); err != nil {
+		fmt.Fprintf(stderr, "daglc lsp: %v\n", err)
+		return 1
+	}
+	return 0
+}
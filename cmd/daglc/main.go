@@ -0,0 +1,58 @@
+// Command daglc compiles dagl source into gflow graphs.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// command is a daglc subcommand
+type command struct {
+	usage string
+	run   func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]command{
+	"diff":     {usage: "compare two graphs structurally", run: runDiff},
+	"fmt":      {usage: "format dagl files", run: runFmt},
+	"graph":    {usage: "compile a dagl file and write the graph", run: runGraph},
+	"lsp":      {usage: "serve the language server protocol over stdio", run: runLsp},
+	"rename":   {usage: "rename a symbol in dagl files", run: runRename},
+	"simulate": {usage: "run a graph with mocked models and services", run: runSimulate},
+	"test":     {usage: "run the tests in dagl files", run: runTest},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the subcommand named by the first argument and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "daglc: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+	return cmd.run(args[1:], stdout, stderr)
+}
+
+// usage prints the subcommands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: daglc <command> [arguments]")
+	fmt.Fprintln(w, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
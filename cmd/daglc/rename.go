@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/symbols"
+)
+
+// runRename renames a function, a constant or a variable in the dagl files
+// under the given paths. By default the references to rename are listed.
+func runRename(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("rename", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result to the files")
+	diff := flags.Bool("d", false, "print a unified diff of the files")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: daglc rename [flags] <old> <new> [path...]")
+		fmt.Fprintln(stderr, "old is the name of a function or a constant, or function.variable for a variable.")
+		fmt.Fprintln(stderr, "paths are dagl files or directories searched for them, . by default.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return 2
+	}
+	old, name, paths := flags.Arg(0), flags.Arg(1), flags.Args()[2:]
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	if err := rename(old, name, paths, *write, *diff, stdout); err != nil {
+		fmt.Fprintf(stderr, "daglc rename: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// rename renames a symbol in the files under paths
+func rename(old, name string, paths []string, write, diff bool, stdout io.Writer) error {
+	index := symbols.NewIndex()
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			err = index.AddDir(path)
+		} else {
+			var data []byte
+			data, err = os.ReadFile(path)
+			index.Add(path, string(data))
+		}
+		if err != nil {
+			return errors.WrapIf(err, "read source")
+		}
+	}
+	renames, err := index.Rename(old, name)
+	if err != nil {
+		return err
+	}
+	// 先算出所有文件的结果，避免写了一部分文件后出错
+	results := make(map[string]string)
+	for path, refs := range renames {
+		result, err := symbols.Replace(index.Source(path), refs, name)
+		if err != nil {
+			return &symbols.FileError{Path: path, Err: err}
+		}
+		results[path] = result
+	}
+	for _, path := range index.Paths() {
+		refs, ok := renames[path]
+		if !ok {
+			continue
+		}
+		src, result := index.Source(path), results[path]
+		if diff {
+			if _, err := io.WriteString(stdout, unifiedDiff(path+".orig", path, src, result)); err != nil {
+				return err
+			}
+		}
+		if write {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, []byte(result), info.Mode().Perm()); err != nil {
+				return errors.WrapIf(err, "write source")
+			}
+		}
+		if !write && !diff {
+			for _, ref := range refs {
+				fmt.Fprintf(stdout, "%s:%s: %s -> %s\n", path, ref.Pos, ref.Name, name)
+			}
+		}
+	}
+	return nil
+}
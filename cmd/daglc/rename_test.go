@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunRename tests listing and writing a rename in a directory of dagl files
+func TestRunRename(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.dagl")
+	b := filepath.Join(dir, "sub", "b.dagl")
+	require.NoError(t, os.WriteFile(a, []byte(`@prefix = 'prefix';
+func main(input) {
+	// prefix 是缓存的前缀
+	builtin("lookup_cache", input, prefix=@prefix);
+}
+`), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Dir(b), 0o755))
+	require.NoError(t, os.WriteFile(b, []byte(`@prefix = 'p';
+@other = @prefix;
+func main(input) {
+	input;
+}
+`), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, run([]string{"rename", "prefix", "cachePrefix", dir}, &stdout, &stderr), stderr.String())
+	require.Equal(t, a+":1:2: prefix -> cachePrefix\n"+a+":4:41: prefix -> cachePrefix\n"+
+		b+":1:2: prefix -> cachePrefix\n"+b+":2:11: prefix -> cachePrefix\n", stdout.String())
+
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"rename", "-w", "prefix", "cachePrefix", dir}, &stdout, &stderr), stderr.String())
+	require.Empty(t, stdout.String())
+	data, err := os.ReadFile(a)
+	require.NoError(t, err)
+	require.Equal(t, `@cachePrefix = 'prefix';
+func main(input) {
+	// prefix 是缓存的前缀
+	builtin("lookup_cache", input, prefix=@cachePrefix);
+}
+`, string(data))
+
+	require.Equal(t, 0, run([]string{"rename", "-d", "main.input", "req", b}, &stdout, &stderr), stderr.String())
+	require.Equal(t, `--- `+b+`.orig
++++ `+b+`
+@@ -1,5 +1,5 @@
+ @cachePrefix = 'p';
+ @other = @cachePrefix;
+-func main(input) {
+-	input;
++func main(req) {
++	req;
+ }
+`, stdout.String())
+
+	stderr.Reset()
+	require.Equal(t, 1, run([]string{"rename", "cachePrefix", "other", dir}, &stdout, &stderr))
+	require.Equal(t, "daglc rename: "+b+`:2:2: constant "other" is already defined`+"\n", stderr.String())
+	require.Equal(t, 2, run([]string{"rename", "prefix"}, &stdout, &stderr))
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/executor"
+	"github.com/vuuihc/gfc/generators"
+	"gopkg.in/yaml.v3"
+)
+
+// runSimulate runs a graph in process with the model and external builtin ops
+// replaced by mocks, and prints the input and output of every node
+func runSimulate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	inputPath := flags.String("input", "", "json file of the graph input, - for stdin, null by default")
+	mocksPath := flags.String("mocks", "", "yaml file of the mocks")
+	opts := optimizeFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: daglc simulate <file.dagl|graph.json|graph.msgpack> [flags]")
+		fmt.Fprintln(stderr, "the mocks file maps node names, node types or op names to an output or an error:")
+		fmt.Fprintln(stderr, "  lookup_cache:\n    output: {\"found\": false}\n  model.ner:\n    error: timeout")
+		flags.PrintDefaults()
+	}
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return 2
+	}
+	if len(paths) != 1 {
+		flags.Usage()
+		return 2
+	}
+	if err := simulate(paths[0], *inputPath, *mocksPath, opts(), stdout, stderr); err != nil {
+		fmt.Fprintf(stderr, "daglc simulate: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parseInterspersed parses flags before and after the positional arguments, and returns the positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// simulate runs a graph with mocks and prints its trace. When a node fails,
+// the trace of the nodes run before it is printed before returning the error.
+func simulate(path, inputPath, mocksPath string, opts generators.OptimizeOptions, stdout, stderr io.Writer) error {
+	graph, err := loadGraph(path, compileOptions{optimize: opts, source: true})
+	if err != nil {
+		return err
+	}
+	input := json.RawMessage("null")
+	if inputPath != "" {
+		if input, err = readInput(inputPath); err != nil {
+			return err
+		}
+	}
+	mocks := executor.Mocks{}
+	if mocksPath != "" {
+		if mocks, err = loadMocks(mocksPath); err != nil {
+			return err
+		}
+	}
+	for _, key := range mocks.Unused(graph) {
+		fmt.Fprintf(stderr, "daglc simulate: warning: mock %q matches no node\n", key)
+	}
+	registry := executor.Builtins()
+	mocks.Apply(registry, graph)
+	result, err := executor.New(registry).Run(context.Background(), graph, input)
+	if result != nil {
+		printTrace(stdout, graph, mocks, result, err)
+	}
+	return err
+}
+
+// readInput reads the json input of a graph from a file, or stdin if path is -
+func readInput(path string) (json.RawMessage, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, errors.WrapIf(err, "read input")
+	}
+	if !json.Valid(data) {
+		return nil, errors.Errorf("input %s is not json", path)
+	}
+	return data, nil
+}
+
+// loadMocks loads the mocks of a yaml file. Each key is a node name, a node
+// type or an op name, mapped to the output or the error of the nodes it matches.
+func loadMocks(path string) (executor.Mocks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WrapIf(err, "read mocks")
+	}
+	var entries map[string]struct {
+		Output yaml.Node `yaml:"output"`
+		Error  string    `yaml:"error"`
+	}
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, errors.WrapIff(err, "invalid mocks %s", path)
+	}
+	mocks := executor.Mocks{}
+	for key, entry := range entries {
+		if entry.Output.Kind == 0 && entry.Error == "" {
+			return nil, errors.Errorf("mock %q should have an output or an error", key)
+		}
+		mock := executor.Mock{Err: entry.Error}
+		if entry.Output.Kind != 0 {
+			var v interface{}
+			if err := entry.Output.Decode(&v); err != nil {
+				return nil, errors.WrapIff(err, "invalid output of mock %q", key)
+			}
+			if mock.Output, err = json.Marshal(jsonValue(v)); err != nil {
+				return nil, errors.WrapIff(err, "invalid output of mock %q", key)
+			}
+		}
+		mocks[key] = mock
+	}
+	return mocks, nil
+}
+
+// jsonValue converts the maps decoded from yaml, whose keys may not be strings, to json objects
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonValue(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			obj[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return obj
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+		return v
+	}
+	return v
+}
+
+// printTrace prints the input and output of every node by id, and the response.
+// If the run failed with err, the failed node and the nodes not run are marked
+// instead, and there is no response.
+func printTrace(w io.Writer, graph *generators.Graph, mocks executor.Mocks, result *executor.Result, err error) {
+	failed := -1
+	var nodeErr *executor.NodeError
+	if errors.As(err, &nodeErr) {
+		failed = nodeErr.ID
+	}
+	for id := range graph.Nodes {
+		node := &graph.Nodes[id]
+		desc := node.Type
+		if _, ok := mocks.Lookup(node); ok && id != 0 {
+			desc += ", mocked"
+		}
+		if result.Skipped[id] {
+			fmt.Fprintf(w, "%s (%s) skipped\n", generators.NodeName(graph, id), desc)
+			continue
+		}
+		if id != failed && result.Outputs[id] == nil {
+			// 出错后没有执行的节点
+			fmt.Fprintf(w, "%s (%s) not run\n", generators.NodeName(graph, id), desc)
+			continue
+		}
+		fmt.Fprintf(w, "%s (%s)\n", generators.NodeName(graph, id), desc)
+		if input := result.Inputs[id]; input != nil {
+			fmt.Fprintf(w, "  input:  %s\n", compactJSON(input))
+		}
+		if id == failed {
+			fmt.Fprintf(w, "  error:  %v\n", nodeErr.Err)
+			continue
+		}
+		fmt.Fprintf(w, "  output: %s\n", compactJSON(result.Outputs[id]))
+	}
+	if err == nil {
+		fmt.Fprintf(w, "response: %s\n", compactJSON(result.Response))
+	}
+}
+
+func compactJSON(data json.RawMessage) string {
+	if data == nil {
+		return "null"
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const simulateCode = `
+func main(input) {
+	cacheRes = builtin("lookup_cache", input, prefix='ner');
+	hit = builtin("jq", cacheRes, filter='.found');
+	if (hit) {
+		builtin("jq", cacheRes, filter='.payload');
+	} else {
+		model("ner", input);
+	}
+}`
+
+// TestRunSimulate tests running a graph with mocks and printing the trace
+func TestRunSimulate(t *testing.T) {
+	path := writeTestFile(t, "main.dagl", simulateCode)
+	input := writeTestFile(t, "input.json", `{"query": "红楼梦"}`)
+	mocks := writeTestFile(t, "mocks.yaml", "lookup_cache:\n  output:\n    found: false\nner:\n  output: {tags: [1, 2]}\n")
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, run([]string{"simulate", path, "--input", input, "--mocks", mocks}, &stdout, &stderr), stderr.String())
+	require.Equal(t, `input (builtin.start)
+  output: {"query":"红楼梦"}
+cacheRes (builtin.lookup_cache, mocked)
+  input:  {"query":"红楼梦"}
+  output: {"found":false}
+hit (builtin.jq)
+  input:  {"found":false}
+  output: false
+when_true (builtin.when_true) skipped
+jq (builtin.jq) skipped
+when_false (builtin.when_false)
+  input:  false
+  output: false
+ner (model.ner, mocked)
+  input:  {"query":"红楼梦"}
+  output: {"tags":[1,2]}
+when_any (builtin.when_any)
+  output: {"tags":[1,2]}
+response: {"tags":[1,2]}
+`, stdout.String())
+
+	// 命中缓存时不执行模型
+	stdout.Reset()
+	mocks = writeTestFile(t, "mocks.yaml", "lookup_cache:\n  output: {found: true, payload: cached}\n")
+	require.Equal(t, 0, run([]string{"simulate", "--mocks", mocks, path, "--input", input}, &stdout, &stderr), stderr.String())
+	require.Contains(t, stdout.String(), "ner (model.ner) skipped\n")
+	require.Contains(t, stdout.String(), "response: \"cached\"\n")
+}
+
+// TestRunSimulateErrors tests reporting missing mocks, failing mocks and invalid files
+func TestRunSimulateErrors(t *testing.T) {
+	path := writeTestFile(t, "main.dagl", simulateCode)
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 1, run([]string{"simulate", path}, &stdout, &stderr))
+	require.Equal(t, "daglc simulate: node cacheRes ("+path+":3:13): no mock for builtin.lookup_cache\n", stderr.String())
+
+	// 出错时打印出错之前的节点，拼错的mock会给出警告
+	stdout.Reset()
+	stderr.Reset()
+	mocks := writeTestFile(t, "mocks.yaml", "builtin.lookup_cache:\n  error: connection refused\nnerr:\n  output: 1\n")
+	require.Equal(t, 1, run([]string{"simulate", path, "--mocks", mocks}, &stdout, &stderr))
+	require.Equal(t, `input (builtin.start)
+  output: null
+cacheRes (builtin.lookup_cache, mocked)
+  input:  null
+  error:  connection refused
+hit (builtin.jq) not run
+when_true (builtin.when_true) not run
+jq (builtin.jq) not run
+when_false (builtin.when_false) not run
+ner (model.ner) not run
+when_any (builtin.when_any) not run
+`, stdout.String())
+	require.Equal(t, "daglc simulate: warning: mock \"nerr\" matches no node\n"+
+		"daglc simulate: node cacheRes ("+path+":3:13): connection refused\n", stderr.String())
+
+	stderr.Reset()
+	mocks = writeTestFile(t, "mocks.yaml", "ner: {}\n")
+	require.Equal(t, 1, run([]string{"simulate", path, "--mocks", mocks}, &stdout, &stderr))
+	require.Equal(t, "daglc simulate: mock \"ner\" should have an output or an error\n", stderr.String())
+
+	input := writeTestFile(t, "input.json", "{")
+	require.Equal(t, 1, run([]string{"simulate", path, "--input", input}, &stdout, &stderr))
+	require.Equal(t, 1, run([]string{"simulate", path, "--input", filepath.Join(t.TempDir(), "missing.json")}, &stdout, &stderr))
+	require.Equal(t, 2, run([]string{"simulate"}, &stdout, &stderr))
+	require.Equal(t, 2, run([]string{"simulate", path, path}, &stdout, &stderr))
+	require.Equal(t, 2, run([]string{"simulate", path, "--unknown"}, &stdout, &stderr))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/executor"
+	"github.com/vuuihc/gfc/generators"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// runTest runs the tests of dagl files. Each test runs the main function of
+// its file with an input and mocks, and compares the response to the expected one.
+func runTest(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	pattern := flags.String("run", "", "run only the tests whose names match the regular expression")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: daglc test [flags] <file.dagl>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	re, err := regexp.Compile(*pattern)
+	if err != nil {
+		fmt.Fprintf(stderr, "daglc test: invalid -run: %v\n", err)
+		return 2
+	}
+	code := 0
+	for _, path := range flags.Args() {
+		tests, failed, err := testFile(path, re, stdout)
+		if err != nil {
+			fmt.Fprintf(stderr, "daglc test: %v\n", err)
+			code = 1
+			continue
+		}
+		if tests == 0 {
+			fmt.Fprintf(stdout, "?\t%s\t[no tests]\n", path)
+			continue
+		}
+		status := "ok"
+		if failed > 0 {
+			status = "FAIL"
+			code = 1
+		}
+		fmt.Fprintf(stdout, "%s\t%s\n", status, path)
+	}
+	return code
+}
+
+// testFile compiles the main function of a dagl file and runs its tests
+// matching re. It returns the number of tests run and the number of failed tests.
+func testFile(path string, re *regexp.Regexp, stdout io.Writer) (int, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, errors.WrapIf(err, "read dagl")
+	}
+	statements, err := parser.NewParser(string(data)).TryParse()
+	if err != nil {
+		return 0, 0, sourceError(path, err)
+	}
+	graph, err := generators.NewGFGenerator(statements).Generate()
+	if err != nil {
+		return 0, 0, sourceError(path, err)
+	}
+	// 和生成器一样，常量只能引用在它之前定义的常量。测试可以使用所有的常量
+	consts := map[string]string{}
+	for _, statement := range statements {
+		if v, ok := statement.(parser.AssignStmt); ok {
+			if v.Value.Type == parser.StrValTypeConst {
+				consts[v.VarName] = consts[v.Value.Value]
+			} else {
+				consts[v.VarName] = v.Value.Value
+			}
+		}
+	}
+	tests, failed := 0, 0
+	for _, statement := range statements {
+		test, ok := statement.(parser.TestStmt)
+		if !ok || !re.MatchString(test.Name) {
+			continue
+		}
+		tests++
+		if err := runDaglTest(graph, &test, consts); err != nil {
+			failed++
+			fmt.Fprintf(stdout, "--- FAIL: %s\n    %v\n", test.Name, sourceError(path, err))
+			continue
+		}
+		fmt.Fprintf(stdout, "--- PASS: %s\n", test.Name)
+	}
+	return tests, failed, nil
+}
+
+// runDaglTest runs a test with the compiled main function. A test without
+// expect passes if main runs without errors. A mock matching no node fails
+// the test, as it is usually a misspelled node name.
+func runDaglTest(graph *generators.Graph, test *parser.TestStmt, consts map[string]string) error {
+	input := json.RawMessage("null")
+	mocks := executor.Mocks{}
+	var mockItems []parser.TestItemStmt
+	var expect *parser.TestItemStmt
+	var want json.RawMessage
+	for _, statement := range test.Body {
+		item, ok := statement.(parser.TestItemStmt)
+		if !ok {
+			continue
+		}
+		value, err := testJSON(item, consts)
+		if err != nil {
+			return err
+		}
+		switch item.Kind {
+		case parser.TestItemInput:
+			input = value
+		case parser.TestItemMock:
+			mocks[item.Key] = executor.Mock{Output: value}
+			mockItems = append(mockItems, item)
+		case parser.TestItemExpect:
+			expect, want = &item, value
+		}
+	}
+	unused := make(map[string]bool)
+	for _, key := range mocks.Unused(graph) {
+		unused[key] = true
+	}
+	// 按源码的顺序报告第一个没有匹配任何节点的mock
+	for _, item := range mockItems {
+		if unused[item.Key] {
+			return &parser.Error{Pos: item.KeyPos, Msg: fmt.Sprintf("mock %q matches no node", item.Key)}
+		}
+	}
+	registry := executor.Builtins()
+	mocks.Apply(registry, graph)
+	result, err := executor.New(registry).Run(context.Background(), graph, input)
+	if err != nil {
+		return &parser.Error{Pos: test.Pos, Msg: err.Error()}
+	}
+	if expect == nil {
+		return nil
+	}
+	response := result.Response
+	if response == nil {
+		// 响应节点被跳过
+		response = json.RawMessage("null")
+	}
+	if !jsonEqual(want, response) {
+		return &parser.Error{Pos: expect.Pos, Msg: fmt.Sprintf("response %s, expect %s", compactJSON(response), compactJSON(want))}
+	}
+	return nil
+}
+
+// testJSON returns the json value of a test item, resolving constants
+func testJSON(item parser.TestItemStmt, consts map[string]string) (json.RawMessage, error) {
+	value := item.Value.Value
+	if item.Value.Type == parser.StrValTypeConst {
+		v, ok := consts[value]
+		if !ok {
+			return nil, &parser.Error{Pos: item.Value.Pos, Msg: fmt.Sprintf("undefined constant %q", value)}
+		}
+		value = v
+	}
+	if !json.Valid([]byte(value)) {
+		what := item.Kind.String()
+		if item.Kind == parser.TestItemMock {
+			what = "mock " + item.Key
+		}
+		return nil, &parser.Error{Pos: item.Value.Pos, Msg: what + " is not json"}
+	}
+	return json.RawMessage(value), nil
+}
+
+// jsonEqual checks if two json values are equal, ignoring formatting and the order of keys
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
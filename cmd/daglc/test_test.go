@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testTestCode = `@found = '{"found": true, "payload": "cached"}';
+
+func main(input) {
+	cacheRes = builtin("lookup_cache", input, prefix='ner');
+	hit = builtin("jq", cacheRes, filter='.found');
+	if (hit) {
+		builtin("jq", cacheRes, filter='.payload');
+	} else {
+		model("ner", input);
+	}
+}
+
+test "cache miss" {
+	input = '{"query": "a"}';
+	mock lookup_cache = '{"found": false}';
+	mock "model.ner" = ` + "`{\n  \"tags\": [1, 2]\n}`" + `;
+	expect = '{"tags":[1,2]}';
+}
+
+test "cache hit" {
+	mock lookup_cache = @found;
+	expect = '"cached"';
+}
+`
+
+// TestRunTest tests running the tests in a dagl file
+func TestRunTest(t *testing.T) {
+	path := writeTestFile(t, "main.dagl", testTestCode)
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, run([]string{"test", path}, &stdout, &stderr), stderr.String())
+	require.Equal(t, "--- PASS: cache miss\n--- PASS: cache hit\nok\t"+path+"\n", stdout.String())
+
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"test", "-run", "hit$", path}, &stdout, &stderr), stderr.String())
+	require.Equal(t, "--- PASS: cache hit\nok\t"+path+"\n", stdout.String())
+}
+
+// TestRunTestFailures tests reporting failed tests with their positions
+func TestRunTestFailures(t *testing.T) {
+	path := writeTestFile(t, "main.dagl", testTestCode+`
+test "wrong expect" {
+	mock lookup_cache = @found;
+	expect = '"miss"';
+}
+
+test "missing mock" {
+	mock lookup_cache = '{"found": false}';
+}
+
+test "invalid json" {
+	input = @found;
+	mock ner = '{';
+}
+
+test "undefined constant" {
+	input = @missing;
+}
+
+test "unused mock" {
+	mock lookup_cache = @found;
+	mock "model.nre" = '{}';
+}
+`)
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 1, run([]string{"test", path}, &stdout, &stderr), stderr.String())
+	require.Equal(t, "--- PASS: cache miss\n"+
+		"--- PASS: cache hit\n"+
+		"--- FAIL: wrong expect\n    "+path+`:29:2: response "cached", expect "miss"`+"\n"+
+		"--- FAIL: missing mock\n    "+path+":32:1: node ner: no mock for model.ner\n"+
+		"--- FAIL: invalid json\n    "+path+":38:13: mock ner is not json\n"+
+		"--- FAIL: undefined constant\n    "+path+`:42:11: undefined constant "missing"`+"\n"+
+		"--- FAIL: unused mock\n    "+path+`:47:7: mock "model.nre" matches no node`+"\n"+
+		"FAIL\t"+path+"\n", stdout.String())
+
+	// 没有测试的文件
+	stdout.Reset()
+	path = writeTestFile(t, "main.dagl", "func main(input) { builtin(\"jq\", input, filter='.a'); }")
+	require.Equal(t, 0, run([]string{"test", path}, &stdout, &stderr), stderr.String())
+	require.Equal(t, "?\t"+path+"\t[no tests]\n", stdout.String())
+
+	// 编译错误
+	stdout.Reset()
+	path = writeTestFile(t, "main.dagl", "test 'a' {}")
+	require.Equal(t, 1, run([]string{"test", path}, &stdout, &stderr))
+	require.Equal(t, "daglc test: "+path+": main function not found\n", stderr.String())
+	require.Equal(t, 2, run([]string{"test"}, &stdout, &stderr))
+	require.Equal(t, 2, run([]string{"test", "-run", "(", path}, &stdout, &stderr))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext 是 unified diff 中每处修改前后保留的行数
+const diffContext = 3
+
+// diffLine is a line of a unified diff
+type diffLine struct {
+	kind byte // ' '、'-' 或者 '+'
+	text string
+}
+
+// unifiedDiff returns the unified diff between two texts, or "" if they are the same
+func unifiedDiff(oldName, newName, old, new string) string {
+	if old == new {
+		return ""
+	}
+	lines := diffLines(splitLines(old), splitLines(new))
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	// oldLine 和 newLine 是lines[i]之前两边各有多少行
+	oldLine, newLine := 0, 0
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+		// 找到这处修改的范围，间隔不超过两倍上下文的修改合并在一起
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines) && j-end <= 2*diffContext; j++ {
+			if lines[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+		end += diffContext
+		if end > len(lines) {
+			end = len(lines)
+		}
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		for _, line := range lines[start:end] {
+			if line.kind != '+' {
+				oldCount++
+			}
+			if line.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, line := range lines[start:end] {
+			fmt.Fprintf(&buf, "%c%s\n", line.kind, line.text)
+		}
+		for _, line := range lines[i:end] {
+			if line.kind != '+' {
+				oldLine++
+			}
+			if line.kind != '-' {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return buf.String()
+}
+
+// hunkRange formats the range of a hunk, starting from 0
+func hunkRange(start, count int) string {
+	// 空的范围用前一行的行号
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines diffs two lists of lines by their longest common subsequence
+func diffLines(old, new []string) []diffLine {
+	// lcs[i][j] 是 old[i:] 和 new[j:] 的最长公共子序列的长度
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case i < len(old) && j < len(new) && old[i] == new[j]:
+			lines = append(lines, diffLine{' ', old[i]})
+			i++
+			j++
+		case j == len(new) || i < len(old) && lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', old[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', new[j]})
+			j++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,45 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/generators"
+)
+
+// whenTrue guards the true branch of an if statement: it outputs its input
+// when the input is true, and is skipped otherwise
+func whenTrue(_ context.Context, _ *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+	ok, err := truthy(input)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrSkip
+	}
+	return input, nil
+}
+
+// whenFalse guards the else branch of an if statement: it outputs its input
+// when the input is false, and is skipped otherwise
+func whenFalse(_ context.Context, _ *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+	ok, err := truthy(input)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, ErrSkip
+	}
+	return input, nil
+}
+
+// truthy checks if a json value is true as a condition. Like jq, only false
+// and null are false.
+func truthy(value json.RawMessage) (bool, error) {
+	var v interface{}
+	if err := json.Unmarshal(value, &v); err != nil {
+		return false, errors.WrapIf(err, "invalid condition")
+	}
+	return v != nil && v != false, nil
+}
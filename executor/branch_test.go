@@ -0,0 +1,166 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/generators"
+)
+
+// readmeCode is the full example of the README
+const readmeCode = "// a function to get cache key\n" +
+	"inline func getCacheKey(input) {\n" +
+	"  builtin(\"jq\",input,filter=`.suggestion_type+\"##\"+(.filter_retrievers//[]|join(\"#\"))+\"##\"+(.context//[]|join(\"#\"))+\"##\"+.query`);\n" +
+	"}\n" +
+	"\n" +
+	"// a function to set cache\n" +
+	"inline func setCache(key, result) {\n" +
+	"\tcacheReq=builtin(\"jq\",[key,result],filter=`{\"key\": .[0], \"payload\": .[1], \"ttl\": 259200000}`);\n" +
+	"\tbuiltin(\"set_cache\", cacheReq, prefix=`ime_rec_bert_ner_v1`);\n" +
+	"}\n" +
+	"\n" +
+	"// a function to lookup cache\n" +
+	"inline func lookupCache(key){\n" +
+	"  builtin(\"lookup_cache\", key, prefix=`ime_rec_bert_ner_v1`);\n" +
+	"}\n" +
+	"\n" +
+	"func main(input) {\n" +
+	"    input = builtin(\"jq\", input, filter=`.payload | fromjson`);\n" +
+	"    key=@call(getCacheKey, [input]);\n" +
+	"    cacheRes=@call(lookupCache,[key]);\n" +
+	"    result=builtin(\"http\", input, endpoint=`http://192002625-146479.Production/suggestion/`,\n" +
+	"        method=`post`, max_retry_times=\"3\", default_value=`{\"actions\":[]}`, timeout=\"800ms\");\n" +
+	"    @call(setCache, [key, result]);\n" +
+	"    cacheMiss=builtin(\"jq\", cacheRes, filter=`.found | not`);\n" +
+	"    if(cacheMiss){\n" +
+	"      result;\n" +
+	"    }else{\n" +
+	"      builtin(\"jq\", cacheRes, filter=`.payload`);\n" +
+	"    }\n" +
+	"}\n"
+
+const readmeInput = `{"payload": "{\"request_id\":\"1674\",\"request_type\":7,\"context\":[],\"context_interval\":[],\"query\":\"红楼梦小姐姐\",\"uid\":\"1674\",\"api_level\":0}"}`
+
+// fakeOps registers ops faking the http service, and the cache ops backed by a memory cache
+type fakeOps struct {
+	cache *MemoryCache
+	// looked 在查过缓存后关闭。http 请求等到查过缓存才返回，否则写缓存可能在查缓存之前
+	looked chan struct{}
+}
+
+func (f *fakeOps) register(r *Registry) {
+	RegisterCache(r, f.cache)
+	lookup := &LookupCache{Store: f.cache}
+	r.Register("builtin.lookup_cache", OpFunc(func(ctx context.Context, node *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+		defer close(f.looked)
+		return lookup.Run(ctx, node, input)
+	}))
+	r.Register("builtin.http", OpFunc(func(context.Context, *generators.Node, json.RawMessage) (json.RawMessage, error) {
+		<-f.looked
+		return json.RawMessage(`{"actions":["from http"]}`), nil
+	}))
+}
+
+// TestRunCacheExample tests the README example through the cache miss and the cache hit path
+func TestRunCacheExample(t *testing.T) {
+	graph := compile(t, readmeCode)
+	fake := &fakeOps{cache: NewMemoryCache(10)}
+	registry := Builtins()
+	fake.register(registry)
+	// names 返回分支中执行了或者被跳过的节点
+	names := func(result *Result, skipped bool) []string {
+		var names []string
+		for id, s := range result.Skipped {
+			if s == skipped && len(graph.Nodes[id].Dependencies) > 0 {
+				names = append(names, graph.Nodes[id].Name)
+			}
+		}
+		return names
+	}
+
+	// 缓存未命中，返回http的结果并写入缓存
+	fake.looked = make(chan struct{})
+	result, err := New(registry).Run(context.Background(), graph, json.RawMessage(readmeInput))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"actions":["from http"]}`, string(result.Response))
+	require.Equal(t, []string{"identity"}, names(result, false))
+	require.Equal(t, []string{"jq"}, names(result, true))
+	payload, found, err := fake.cache.Get(context.Background(), `ime_rec_bert_ner_v1:"######红楼梦小姐姐"`)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.JSONEq(t, `{"actions":["from http"]}`, string(payload))
+
+	// 缓存命中，返回缓存中的结果
+	require.NoError(t, fake.cache.Set(context.Background(), `ime_rec_bert_ner_v1:"######红楼梦小姐姐"`, json.RawMessage(`{"actions":["from cache"]}`), time.Hour))
+	fake.looked = make(chan struct{})
+	result, err = New(registry).Run(context.Background(), graph, json.RawMessage(readmeInput))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"actions":["from cache"]}`, string(result.Response))
+	require.Equal(t, []string{"jq"}, names(result, false))
+	require.Equal(t, []string{"identity"}, names(result, true))
+}
+
+// TestRunNestedBranches tests skipping the nodes of a nested if statement in a branch not taken
+func TestRunNestedBranches(t *testing.T) {
+	graph := compile(t, `func main(input) {
+	a = builtin("identity", input);
+	if (input) {
+		if (a) {
+			builtin("identity", [a]);
+		}
+	} else {
+		builtin("identity", [a, a]);
+	}
+}`)
+	for input, response := range map[string]string{"true": `true`, "false": `[false,false]`, "null": `[null,null]`} {
+		result, err := New(Builtins()).Run(context.Background(), graph, json.RawMessage(input))
+		require.NoError(t, err)
+		require.JSONEq(t, response, string(result.Response), input)
+	}
+	// 内层if的条件为真，但是外层分支没有执行
+	graph.Nodes[1].Type = "model.true"
+	registry := Builtins()
+	registry.Register("model.true", OpFunc(func(context.Context, *generators.Node, json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage("true"), nil
+	}))
+	result, err := New(registry).Run(context.Background(), graph, json.RawMessage("false"))
+	require.NoError(t, err)
+	require.JSONEq(t, `[true,true]`, string(result.Response))
+	for id, node := range graph.Nodes {
+		if len(node.Scope) > 2 {
+			require.True(t, result.Skipped[id], node.Name)
+		}
+	}
+}
+
+// TestRunWhenAnyFirstInput tests that builtin.when_any outputs its first live input without waiting for the other
+func TestRunWhenAnyFirstInput(t *testing.T) {
+	// 两个输入都没有被跳过，例如优化掉了 identity 节点的图
+	graph := &generators.Graph{}
+	graph.AddNode(generators.Node{Type: "builtin.start"})
+	graph.AddNode(generators.Node{Type: "model.fast", Inputs: []int{0}})
+	graph.AddNode(generators.Node{Type: "model.slow", Inputs: []int{0}})
+	graph.AddNode(generators.Node{Type: "builtin.when_any", Inputs: []int{1, 2}})
+	graph.AddNode(generators.Node{Type: "model.signal", Inputs: []int{3}, IsResponse: true})
+	signal := make(chan struct{})
+	registry := Builtins()
+	registry.Register("model.fast", OpFunc(func(context.Context, *generators.Node, json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`"fast"`), nil
+	}))
+	registry.Register("model.slow", OpFunc(func(context.Context, *generators.Node, json.RawMessage) (json.RawMessage, error) {
+		// 等到 when_any 之后的节点执行完
+		<-signal
+		return json.RawMessage(`"slow"`), nil
+	}))
+	registry.Register("model.signal", OpFunc(func(_ context.Context, _ *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+		close(signal)
+		return input, nil
+	}))
+	result, err := New(registry).Run(context.Background(), graph, json.RawMessage("null"))
+	require.NoError(t, err)
+	require.Equal(t, `"fast"`, string(result.Response))
+	require.Equal(t, `"slow"`, string(result.Outputs[2]))
+}
@@ -0,0 +1,249 @@
+package executor
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/generators"
+)
+
+// CacheStore stores the payloads of builtin.set_cache for builtin.lookup_cache
+type CacheStore interface {
+	// Get returns the payload of a key, found is false if the key is missing or expired
+	Get(ctx context.Context, key string) (payload json.RawMessage, found bool, err error)
+	// Set stores the payload of a key, a ttl of 0 never expires
+	Set(ctx context.Context, key string, payload json.RawMessage, ttl time.Duration) error
+}
+
+// RegisterCache registers builtin.lookup_cache and builtin.set_cache backed by store
+func RegisterCache(r *Registry, store CacheStore) {
+	r.Register("builtin.lookup_cache", &LookupCache{Store: store})
+	r.Register("builtin.set_cache", &SetCache{Store: store})
+}
+
+// cacheKey returns the key in the store of a key with the prefix arg. Keys are
+// used as their compacted json text, so the string "1" and the number 1 are
+// different keys.
+func cacheKey(node *generators.Node, key json.RawMessage) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, key); err != nil {
+		return "", errors.WrapIf(err, "invalid cache key")
+	}
+	if prefix := Arg(node, "prefix"); prefix != "" {
+		return prefix + ":" + buf.String(), nil
+	}
+	return buf.String(), nil
+}
+
+// LookupCache is the builtin.lookup_cache op. It looks up its input as the
+// key and outputs {"found": true, "payload": ...}, or {"found": false}.
+type LookupCache struct {
+	Store CacheStore
+}
+
+func (c *LookupCache) Run(ctx context.Context, node *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+	key, err := cacheKey(node, input)
+	if err != nil {
+		return nil, err
+	}
+	payload, found, err := c.Store.Get(ctx, key)
+	if err != nil {
+		return nil, errors.WrapIf(err, "lookup cache")
+	}
+	if !found {
+		return json.RawMessage(`{"found":false}`), nil
+	}
+	return json.Marshal(struct {
+		Found   bool            `json:"found"`
+		Payload json.RawMessage `json:"payload"`
+	}{true, payload})
+}
+
+// SetCache is the builtin.set_cache op. Its input is {"key": ..., "payload": ...,
+// "ttl": milliseconds}, which it outputs after storing the payload.
+type SetCache struct {
+	Store CacheStore
+}
+
+func (c *SetCache) Run(ctx context.Context, node *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+	var req struct {
+		Key     json.RawMessage `json:"key"`
+		Payload json.RawMessage `json:"payload"`
+		TTL     int64           `json:"ttl"`
+	}
+	if err := json.Unmarshal(input, &req); err != nil {
+		return nil, errors.WrapIf(err, "invalid set_cache input")
+	}
+	if req.Key == nil || req.Payload == nil {
+		return nil, errors.New(`set_cache input should have "key" and "payload"`)
+	}
+	// 太大的ttl乘以毫秒会溢出成负数，变成永不过期
+	if req.TTL < 0 || req.TTL > math.MaxInt64/int64(time.Millisecond) {
+		return nil, errors.Errorf("invalid ttl %d", req.TTL)
+	}
+	key, err := cacheKey(node, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Store.Set(ctx, key, req.Payload, time.Duration(req.TTL)*time.Millisecond); err != nil {
+		return nil, errors.WrapIf(err, "set cache")
+	}
+	return input, nil
+}
+
+// MemoryCache is an in-memory CacheStore that evicts the least recently used
+// entries beyond its capacity. Expired entries are removed when looked up.
+type MemoryCache struct {
+	mu       sync.Mutex
+	capacity int
+	// lru 的元素是 *memoryEntry，最近使用的在前面
+	lru     *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	key     string
+	payload json.RawMessage
+	// expires 为零值时不过期
+	expires time.Time
+}
+
+// NewMemoryCache creates a memory cache holding at most capacity entries
+func NewMemoryCache(capacity int) *MemoryCache {
+	return &MemoryCache{capacity: capacity, lru: list.New(), entries: make(map[string]*list.Element), now: time.Now}
+}
+
+func (c *MemoryCache) Get(_ context.Context, key string) (json.RawMessage, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(elem)
+	return entry.payload, true, nil
+}
+
+func (c *MemoryCache) Set(_ context.Context, key string, payload json.RawMessage, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &memoryEntry{key: key, payload: append(json.RawMessage(nil), payload...)}
+	if ttl > 0 {
+		entry.expires = c.now().Add(ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return nil
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.capacity > 0 && c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of entries, expired entries not looked up yet included
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// FileCache is a CacheStore keeping each entry in a json file of a
+// directory, named by the sha256 of the key
+type FileCache struct {
+	dir string
+	now func() time.Time
+}
+
+type fileEntry struct {
+	Key     string          `json:"key"`
+	Payload json.RawMessage `json:"payload"`
+	// ExpiresAt 是过期时间的unix毫秒数，0表示不过期
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// NewFileCache creates a file cache in dir, creating the directory if needed
+func NewFileCache(dir string) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.WrapIf(err, "create cache directory")
+	}
+	return &FileCache{dir: dir, now: time.Now}, nil
+}
+
+func (c *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *FileCache) Get(_ context.Context, key string) (json.RawMessage, bool, error) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var entry fileEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, errors.WrapIff(err, "invalid cache file %s", path)
+	}
+	// 文件名的哈希冲突时不是这个key
+	if entry.Key != key {
+		return nil, false, nil
+	}
+	if entry.ExpiresAt != 0 && c.now().UnixMilli() >= entry.ExpiresAt {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, false, err
+		}
+		return nil, false, nil
+	}
+	return entry.Payload, true, nil
+}
+
+func (c *FileCache) Set(_ context.Context, key string, payload json.RawMessage, ttl time.Duration) error {
+	entry := fileEntry{Key: key, Payload: payload}
+	if ttl > 0 {
+		entry.ExpiresAt = c.now().Add(ttl).UnixMilli()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再改名，读的时候不会读到写了一半的文件
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
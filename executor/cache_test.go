@@ -0,0 +1,123 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/generators"
+)
+
+// testStore tests setting, getting and expiring entries of a store whose clock is now
+func testStore(t *testing.T, store CacheStore, now *time.Time) {
+	ctx := context.Background()
+	_, found, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	require.NoError(t, store.Set(ctx, "a", json.RawMessage(`{"x":1}`), time.Minute))
+	require.NoError(t, store.Set(ctx, "b", json.RawMessage(`2`), 0))
+	payload, found, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, `{"x":1}`, string(payload))
+
+	*now = now.Add(time.Minute)
+	_, found, err = store.Get(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, found)
+	// ttl 为0时不过期
+	payload, found, err = store.Get(ctx, "b")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, `2`, string(payload))
+}
+
+// TestMemoryCache tests expiring entries and evicting the least recently used ones
+func TestMemoryCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := NewMemoryCache(2)
+	cache.now = func() time.Time { return now }
+	testStore(t, cache, &now)
+	require.Equal(t, 1, cache.Len())
+
+	ctx := context.Background()
+	require.NoError(t, cache.Set(ctx, "c", json.RawMessage(`3`), 0))
+	// 读过 b 之后 c 是最久没有使用的
+	_, _, _ = cache.Get(ctx, "b")
+	require.NoError(t, cache.Set(ctx, "d", json.RawMessage(`4`), 0))
+	require.Equal(t, 2, cache.Len())
+	_, found, _ := cache.Get(ctx, "c")
+	require.False(t, found)
+	_, found, _ = cache.Get(ctx, "b")
+	require.True(t, found)
+}
+
+// TestFileCache tests keeping entries in files that outlive the store
+func TestFileCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	dir := t.TempDir()
+	cache, err := NewFileCache(dir)
+	require.NoError(t, err)
+	cache.now = func() time.Time { return now }
+	testStore(t, cache, &now)
+
+	reopened, err := NewFileCache(dir)
+	require.NoError(t, err)
+	payload, found, err := reopened.Get(context.Background(), "b")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, `2`, string(payload))
+}
+
+// TestCacheOps tests the json shapes of builtin.lookup_cache and builtin.set_cache
+func TestCacheOps(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(10)
+	lookup, set := &LookupCache{Store: cache}, &SetCache{Store: cache}
+	node := &generators.Node{Args: map[string][]string{"prefix": {"p"}}}
+
+	output, err := lookup.Run(ctx, node, json.RawMessage(`"k"`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"found":false}`, string(output))
+
+	input := json.RawMessage(`{"key":"k","payload":{"actions":[]},"ttl":259200000}`)
+	output, err = set.Run(ctx, node, input)
+	require.NoError(t, err)
+	require.Equal(t, input, output)
+	output, err = lookup.Run(ctx, node, json.RawMessage(`"k"`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"found":true,"payload":{"actions":[]}}`, string(output))
+
+	// 不同前缀的缓存互不影响，key按压缩后的json文本使用
+	output, err = lookup.Run(ctx, &generators.Node{}, json.RawMessage(`"k"`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"found":false}`, string(output))
+	_, err = set.Run(ctx, node, json.RawMessage(`{"key":{"a": [1, 2]},"payload":1}`))
+	require.NoError(t, err)
+	payload, found, err := cache.Get(ctx, `p:{"a":[1,2]}`)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, `1`, string(payload))
+
+	// 字符串 "1" 和数字 1 是不同的key
+	_, err = set.Run(ctx, node, json.RawMessage(`{"key":"1","payload":"string"}`))
+	require.NoError(t, err)
+	_, err = set.Run(ctx, node, json.RawMessage(`{"key":1,"payload":"number"}`))
+	require.NoError(t, err)
+	output, err = lookup.Run(ctx, node, json.RawMessage(`"1"`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"found":true,"payload":"string"}`, string(output))
+	output, err = lookup.Run(ctx, node, json.RawMessage(`1`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"found":true,"payload":"number"}`, string(output))
+
+	_, err = set.Run(ctx, node, json.RawMessage(`{"payload":1}`))
+	require.EqualError(t, err, `set_cache input should have "key" and "payload"`)
+	_, err = set.Run(ctx, node, json.RawMessage(`{"key":"k","payload":1,"ttl":-1}`))
+	require.EqualError(t, err, "invalid ttl -1")
+	_, err = set.Run(ctx, node, json.RawMessage(`{"key":"k","payload":1,"ttl":9223372036855}`))
+	require.EqualError(t, err, "invalid ttl 9223372036855")
+}
@@ -0,0 +1,296 @@
+// Package executor runs compiled gflow graphs in process. It is a reference
+// implementation of the scheduling semantics documented on generators.Node,
+// for local testing and small embedded deployments.
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/generators"
+)
+
+// startType 是图的入口节点，输出图的输入。whenAnyType 汇合if语句的两个分支，
+// 它们由执行器自己执行
+const (
+	startType   = "builtin.start"
+	whenAnyType = "builtin.when_any"
+)
+
+// ErrSkip is returned by an op to skip its node, like a builtin.when_true
+// node whose condition is false. A node is skipped without running when one
+// of its inputs or dependencies is skipped, except builtin.when_any, which is
+// skipped when both its inputs are.
+var ErrSkip = errors.New("skip")
+
+// Executor runs graphs with the ops of a registry
+type Executor struct {
+	registry *Registry
+	// concurrency 是同时执行的节点数量上限，0表示不限制
+	concurrency int
+}
+
+// New creates an executor running the ops of registry
+func New(registry *Registry) *Executor {
+	return &Executor{registry: registry}
+}
+
+// WithConcurrency limits the number of nodes running at the same time, 0 means no limit
+func (e *Executor) WithConcurrency(n int) *Executor {
+	e.concurrency = n
+	return e
+}
+
+// Result is the result of running a graph
+type Result struct {
+	// Response 是 IsResponse 节点的输出，节点被跳过时为nil
+	Response json.RawMessage
+	// Outputs 是每个节点的输出，下标是节点在图中的Offset。被跳过的节点输出为nil
+	Outputs []json.RawMessage
+	// Inputs 是传给每个节点的Op的输入，没有执行Op的节点为nil
+	Inputs []json.RawMessage
+	// Skipped 是每个节点是否被跳过
+	Skipped []bool
+}
+
+// NodeError is an error running a node
+type NodeError struct {
+	ID   int
+	Node *generators.Node
+	Err  error
+	// name 是节点在日志中的名字
+	name string
+}
+
+func (e *NodeError) Error() string {
+	if source := e.Node.Source; source != nil {
+		return fmt.Sprintf("node %s (%s:%d:%d): %v", e.name, source.File, source.Line, source.Column, e.Err)
+	}
+	return fmt.Sprintf("node %s: %v", e.name, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// Run runs a graph with input as the output of builtin.start. A node is
+// scheduled in its own goroutine once all its inputs and dependencies have
+// run, except builtin.when_any, which outputs the first of its inputs that
+// runs without waiting for the other. Run waits for all nodes, and stops
+// scheduling nodes at the first error. The error of a node is returned with
+// the partial result of the nodes run before it.
+func (e *Executor) Run(ctx context.Context, graph *generators.Graph, input json.RawMessage) (*Result, error) {
+	if err := graph.Validate(); err != nil {
+		return nil, errors.WrapIf(err, "invalid graph")
+	}
+	ops := make([]Op, len(graph.Nodes))
+	for id := range graph.Nodes {
+		node := &graph.Nodes[id]
+		if node.Type == startType || node.Type == whenAnyType {
+			continue
+		}
+		op, ok := e.registry.Lookup(node.Type)
+		if !ok {
+			return nil, &NodeError{ID: id, Node: node, Err: errors.Errorf("no op registered for type %q", node.Type), name: generators.NodeName(graph, id)}
+		}
+		ops[id] = op
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r := &run{
+		ctx:         ctx,
+		cancel:      cancel,
+		graph:       graph,
+		ops:         ops,
+		input:       input,
+		outputs:     make([]json.RawMessage, len(graph.Nodes)),
+		inputs:      make([]json.RawMessage, len(graph.Nodes)),
+		skipped:     make([]bool, len(graph.Nodes)),
+		done:        make([]bool, len(graph.Nodes)),
+		inDegree:    make([]int, len(graph.Nodes)),
+		downstreams: make([][]int, len(graph.Nodes)),
+	}
+	if e.concurrency > 0 {
+		r.slots = make(chan struct{}, e.concurrency)
+	}
+	var ready []int
+	for id := range graph.Nodes {
+		node := &graph.Nodes[id]
+		r.inDegree[id] = node.InDegree
+		for _, upstream := range node.Upstreams() {
+			r.downstreams[upstream] = append(r.downstreams[upstream], id)
+		}
+		if node.InDegree == 0 {
+			ready = append(ready, id)
+		}
+	}
+	for _, id := range ready {
+		r.schedule(id)
+	}
+	r.wg.Wait()
+	result := &Result{Outputs: r.outputs, Inputs: r.inputs, Skipped: r.skipped}
+	if r.err != nil {
+		return result, r.err
+	}
+	for id := range graph.Nodes {
+		if graph.Nodes[id].IsResponse {
+			result.Response = r.outputs[id]
+		}
+	}
+	return result, nil
+}
+
+// run is the state of running a graph
+type run struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	graph  *generators.Graph
+	ops    []Op
+	input  json.RawMessage
+	// slots 限制同时执行的节点数量，为nil时不限制
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	// mu 保护下面的字段
+	mu      sync.Mutex
+	outputs []json.RawMessage
+	inputs  []json.RawMessage
+	skipped []bool
+	// done 是节点是否已经执行完或者被跳过
+	done []bool
+	// inDegree 是每个节点还没有执行完的上游节点数量，downstreams 是每个节点的下游节点
+	inDegree    []int
+	downstreams [][]int
+	err         error
+}
+
+// schedule runs a node in a new goroutine, and schedules the downstream nodes
+// ready to run when it is done
+func (r *run) schedule(id int) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if r.slots != nil {
+			r.slots <- struct{}{}
+			defer func() { <-r.slots }()
+		}
+		output, err := r.exec(id)
+		var ready []int
+		r.mu.Lock()
+		switch {
+		case errors.Is(err, ErrSkip):
+			ready = r.finish(id, nil, true)
+		case err != nil:
+			if r.err == nil {
+				r.err = &NodeError{ID: id, Node: &r.graph.Nodes[id], Err: err, name: generators.NodeName(r.graph, id)}
+				r.cancel()
+			}
+		default:
+			ready = r.finish(id, output, false)
+		}
+		if r.err != nil {
+			ready = nil
+		}
+		r.mu.Unlock()
+		for _, downstream := range ready {
+			r.schedule(downstream)
+		}
+	}()
+}
+
+// finish records the output of a node and returns the downstream nodes ready
+// to run. Skipped nodes and builtin.when_any nodes are finished right away
+// without being scheduled. r.mu must be held.
+func (r *run) finish(id int, output json.RawMessage, skipped bool) []int {
+	r.done[id] = true
+	r.outputs[id], r.skipped[id] = output, skipped
+	var ready []int
+	for _, downstream := range r.downstreams[id] {
+		r.inDegree[downstream]--
+		if r.done[downstream] {
+			// when_any 已经输出了先执行完的输入
+			continue
+		}
+		node := &r.graph.Nodes[downstream]
+		switch {
+		case node.Type == whenAnyType && !skipped && containsInt(node.Inputs, id):
+			ready = append(ready, r.finish(downstream, output, false)...)
+		case r.inDegree[downstream] > 0:
+		case node.Type == whenAnyType || r.skippedUpstream(node):
+			// 没有执行的分支中的节点，或者两个输入都被跳过的 when_any
+			ready = append(ready, r.finish(downstream, nil, true)...)
+		default:
+			ready = append(ready, downstream)
+		}
+	}
+	return ready
+}
+
+// skippedUpstream checks if an input or a dependency of a node was skipped. r.mu must be held.
+func (r *run) skippedUpstream(node *generators.Node) bool {
+	for _, upstream := range node.Upstreams() {
+		if r.skipped[upstream] {
+			return true
+		}
+	}
+	return false
+}
+
+// exec runs the op of a node with its merged inputs
+func (r *run) exec(id int) (output json.RawMessage, err error) {
+	node := &r.graph.Nodes[id]
+	if node.Type == startType {
+		return r.input, nil
+	}
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	input := r.mergeInputs(node)
+	r.inputs[id] = input
+	r.mu.Unlock()
+	defer func() {
+		if v := recover(); v != nil {
+			err = errors.Errorf("panic: %v", v)
+		}
+	}()
+	output, err = r.ops[id].Run(r.ctx, node, input)
+	if err == nil && output == nil {
+		output = json.RawMessage("null")
+	}
+	return output, err
+}
+
+// mergeInputs returns the output of the only input of a node, or the outputs
+// of its inputs merged into a json array
+func (r *run) mergeInputs(node *generators.Node) json.RawMessage {
+	switch len(node.Inputs) {
+	case 0:
+		return json.RawMessage("null")
+	case 1:
+		return r.outputs[node.Inputs[0]]
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, input := range node.Inputs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(r.outputs[input])
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+func containsInt(list []int, v int) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/generators"
+	"github.com/vuuihc/gfc/parser"
+)
+
+func compile(t *testing.T, src string) *generators.Graph {
+	statements, err := parser.NewParser(src).TryParse()
+	require.NoError(t, err)
+	graph, err := generators.NewGFGenerator(statements).Generate()
+	require.NoError(t, err)
+	return graph
+}
+
+// tagOp wraps its input in an object named by the tag arg
+var tagOp = OpFunc(func(_ context.Context, node *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+	return json.RawMessage(`{"` + Arg(node, "tag") + `":` + string(input) + `}`), nil
+})
+
+// TestRun tests passing outputs along the edges and merging several inputs into an array
+func TestRun(t *testing.T) {
+	graph := compile(t, `func main(input) {
+	a = model("tag", input, tag='a');
+	b = model("tag", input, tag='b');
+	builtin("identity", [b, a, b]);
+}`)
+	registry := Builtins()
+	registry.Register("model.tag", tagOp)
+	result, err := New(registry).Run(context.Background(), graph, json.RawMessage(`1`))
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"b":1},{"a":1},{"b":1}]`, string(result.Response))
+	require.Len(t, result.Outputs, len(graph.Nodes))
+	require.Equal(t, json.RawMessage(`1`), result.Outputs[0])
+	require.Nil(t, result.Inputs[0])
+	require.JSONEq(t, `[{"b":1},{"a":1},{"b":1}]`, string(result.Inputs[3]))
+}
+
+// TestRunConcurrently tests that nodes whose inputs have run are run at the same time
+func TestRunConcurrently(t *testing.T) {
+	graph := compile(t, `func main(input) {
+	a = model("wait", input);
+	b = model("wait", input);
+	builtin("identity", [a, b]);
+}`)
+	// 两个节点互相等待，顺序执行时会超时
+	var started int32
+	both := make(chan struct{})
+	registry := Builtins()
+	registry.Register("model.wait", OpFunc(func(ctx context.Context, _ *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+		if atomic.AddInt32(&started, 1) == 2 {
+			close(both)
+		}
+		select {
+		case <-both:
+			return input, nil
+		case <-time.After(500 * time.Millisecond):
+			return nil, errors.New("not run concurrently")
+		}
+	}))
+	result, err := New(registry).Run(context.Background(), graph, json.RawMessage(`"x"`))
+	require.NoError(t, err)
+	require.JSONEq(t, `["x","x"]`, string(result.Response))
+
+	// 限制并发为1时按入度依次执行
+	started = 0
+	both = make(chan struct{})
+	_, err = New(registry).WithConcurrency(1).Run(context.Background(), graph, json.RawMessage(`"x"`))
+	require.ErrorContains(t, err, "not run concurrently")
+}
+
+// TestRunErrors tests that the first error stops scheduling and names the node
+func TestRunErrors(t *testing.T) {
+	graph := compile(t, `func main(input) {
+	a = model("fail", input);
+	b = model("tag", a, tag='b');
+	b;
+}`)
+	registry := Builtins()
+	_, err := New(registry).Run(context.Background(), graph, nil)
+	require.EqualError(t, err, `node a: no op registered for type "model.fail"`)
+
+	var ran int32
+	registry.Register("model.fail", OpFunc(func(context.Context, *generators.Node, json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("boom")
+	}))
+	registry.Register("model.tag", OpFunc(func(context.Context, *generators.Node, json.RawMessage) (json.RawMessage, error) {
+		atomic.AddInt32(&ran, 1)
+		return nil, nil
+	}))
+	result, err := New(registry).Run(context.Background(), graph, json.RawMessage(`1`))
+	var nodeErr *NodeError
+	require.True(t, errors.As(err, &nodeErr))
+	require.Equal(t, "a", nodeErr.Node.Name)
+	require.EqualError(t, nodeErr.Err, "boom")
+	require.Zero(t, atomic.LoadInt32(&ran))
+	// 出错时返回出错之前的结果
+	require.Equal(t, json.RawMessage(`1`), result.Outputs[0])
+	require.Equal(t, json.RawMessage(`1`), result.Inputs[nodeErr.ID])
+	require.Nil(t, result.Outputs[nodeErr.ID])
+	require.Nil(t, result.Inputs[2])
+	require.Nil(t, result.Response)
+
+	registry.Register("model.fail", OpFunc(func(context.Context, *generators.Node, json.RawMessage) (json.RawMessage, error) {
+		panic("oops")
+	}))
+	_, err = New(registry).Run(context.Background(), graph, nil)
+	require.EqualError(t, err, "node a: panic: oops")
+
+	graph.Nodes[1].InDegree = 2
+	_, err = New(registry).Run(context.Background(), graph, nil)
+	require.True(t, strings.HasPrefix(err.Error(), "invalid graph: "), err.Error())
+}
@@ -0,0 +1,217 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/generators"
+)
+
+// HTTP is the builtin.http op. It sends its input as the json body of a
+// request to the endpoint arg and outputs the json response body. The other
+// args are:
+//   - method: the request method, post by default. get requests have no body.
+//   - max_retry_times: how many times a failed request is retried, 0 by default.
+//     Network errors, timeouts, 429 and 5xx responses are retried with
+//     exponential backoff, other failures are not.
+//   - timeout: the timeout of each attempt, like 800ms. A number is taken as milliseconds.
+//   - default_value: the json output when the request fails, instead of an error.
+type HTTP struct {
+	Client *http.Client
+	// MaxRequestBytes 和 MaxResponseBytes 限制请求和响应body的大小，0表示不限制
+	MaxRequestBytes  int64
+	MaxResponseBytes int64
+	// Backoff 是第一次重试前的等待时间，之后每次重试翻倍，不超过 MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewHTTP creates the http op with the default client and limits
+func NewHTTP() *HTTP {
+	return &HTTP{
+		Client:           http.DefaultClient,
+		MaxRequestBytes:  1 << 20,
+		MaxResponseBytes: 10 << 20,
+		Backoff:          100 * time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+	}
+}
+
+// httpArgs are the parsed args of a builtin.http node
+type httpArgs struct {
+	endpoint     string
+	method       string
+	retries      int
+	timeout      time.Duration
+	defaultValue json.RawMessage
+}
+
+func parseHTTPArgs(node *generators.Node) (*httpArgs, error) {
+	args := &httpArgs{endpoint: Arg(node, "endpoint"), method: http.MethodPost}
+	if args.endpoint == "" {
+		return nil, errors.New("endpoint is required")
+	}
+	if method := Arg(node, "method"); method != "" {
+		args.method = strings.ToUpper(method)
+	}
+	if retries := Arg(node, "max_retry_times"); retries != "" {
+		n, err := strconv.Atoi(retries)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid max_retry_times %q", retries)
+		}
+		args.retries = n
+	}
+	if timeout := Arg(node, "timeout"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			ms, err := strconv.Atoi(timeout)
+			if err != nil {
+				return nil, errors.Errorf("invalid timeout %q", timeout)
+			}
+			d = time.Duration(ms) * time.Millisecond
+		}
+		if d <= 0 {
+			return nil, errors.Errorf("invalid timeout %q", timeout)
+		}
+		args.timeout = d
+	}
+	if _, ok := node.Args["default_value"]; ok {
+		value := Arg(node, "default_value")
+		if !json.Valid([]byte(value)) {
+			return nil, errors.Errorf("default_value %q is not json", value)
+		}
+		args.defaultValue = json.RawMessage(value)
+	}
+	return args, nil
+}
+
+// retryableError is a failed attempt worth retrying
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+func (h *HTTP) Run(ctx context.Context, node *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+	args, err := parseHTTPArgs(node)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.do(ctx, args, input)
+	if err != nil && args.defaultValue != nil && ctx.Err() == nil {
+		// 调用方取消时不用默认值，整个图都在停止
+		return args.defaultValue, nil
+	}
+	return output, err
+}
+
+// do sends the request, retrying the retryable failures
+func (h *HTTP) do(ctx context.Context, args *httpArgs, input json.RawMessage) (json.RawMessage, error) {
+	if h.MaxRequestBytes > 0 && int64(len(input)) > h.MaxRequestBytes {
+		return nil, errors.Errorf("request body of %d bytes exceeds the limit of %d bytes", len(input), h.MaxRequestBytes)
+	}
+	backoff := h.Backoff
+	for attempt := 0; ; attempt++ {
+		output, err := h.attempt(ctx, args, input)
+		if err == nil {
+			return output, nil
+		}
+		err = errors.WrapIff(err, "%s %s", args.method, args.endpoint)
+		var retryable *retryableError
+		if attempt >= args.retries || !errors.As(err, &retryable) {
+			if attempt > 0 {
+				err = errors.WrapIff(err, "after %d attempts", attempt+1)
+			}
+			return nil, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if backoff *= 2; h.MaxBackoff > 0 && backoff > h.MaxBackoff {
+			backoff = h.MaxBackoff
+		}
+	}
+}
+
+// attempt sends the request once
+func (h *HTTP) attempt(ctx context.Context, args *httpArgs, input json.RawMessage) (json.RawMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if args.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, args.timeout)
+		defer cancel()
+	}
+	var body io.Reader
+	if args.method != http.MethodGet && args.method != http.MethodHead {
+		body = bytes.NewReader(input)
+	}
+	req, err := http.NewRequestWithContext(ctx, args.method, args.endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// 网络错误和单次请求超时可以重试
+		return nil, &retryableError{err}
+	}
+	defer resp.Body.Close()
+	reader := io.Reader(resp.Body)
+	if h.MaxResponseBytes > 0 {
+		reader = io.LimitReader(resp.Body, h.MaxResponseBytes+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, &retryableError{errors.WrapIf(err, "read response")}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("status %s: %s", resp.Status, truncate(data, 200))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, &retryableError{err}
+		}
+		return nil, err
+	}
+	if h.MaxResponseBytes > 0 && int64(len(data)) > h.MaxResponseBytes {
+		return nil, errors.Errorf("response body exceeds the limit of %d bytes", h.MaxResponseBytes)
+	}
+	if !json.Valid(data) {
+		return nil, errors.Errorf("response body is not json: %s", truncate(data, 200))
+	}
+	return data, nil
+}
+
+// truncate returns the beginning of data for error messages
+func truncate(data []byte, n int) string {
+	s := strings.TrimSpace(string(data))
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
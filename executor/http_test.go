@@ -0,0 +1,142 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/generators"
+)
+
+func httpNode(endpoint string, args ...string) *generators.Node {
+	node := &generators.Node{Type: "builtin.http", Args: map[string][]string{"endpoint": {endpoint}}}
+	for i := 0; i+1 < len(args); i += 2 {
+		node.Args[args[i]] = []string{args[i+1]}
+	}
+	return node
+}
+
+func testHTTP() *HTTP {
+	h := NewHTTP()
+	h.Backoff = time.Millisecond
+	return h
+}
+
+// TestHTTP tests sending the input and outputting the response
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"method": r.Method, "body": string(body), "type": r.Header.Get("Content-Type")})
+	}))
+	defer server.Close()
+
+	output, err := testHTTP().Run(context.Background(), httpNode(server.URL), json.RawMessage(`{"q":1}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"method":"POST","body":"{\"q\":1}","type":"application/json"}`, string(output))
+
+	output, err = testHTTP().Run(context.Background(), httpNode(server.URL, "method", "get"), json.RawMessage(`{"q":1}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"method":"GET","body":"","type":""}`, string(output))
+}
+
+// TestHTTPRetry tests retrying 5xx responses and timeouts, but not 4xx responses
+func TestHTTPRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch n := atomic.AddInt32(&calls, 1); {
+		case r.URL.Path == "/bad":
+			http.Error(w, "bad request", http.StatusBadRequest)
+		case n == 1:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case n == 2:
+			// 超过单次请求的超时
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte(`"slow"`))
+		default:
+			_, _ = w.Write([]byte(`"ok"`))
+		}
+	}))
+	defer server.Close()
+
+	output, err := testHTTP().Run(context.Background(), httpNode(server.URL, "max_retry_times", "2", "timeout", "50ms"), nil)
+	require.NoError(t, err)
+	require.Equal(t, `"ok"`, string(output))
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// 没有超时时等到慢的响应
+	atomic.StoreInt32(&calls, 0)
+	output, err = testHTTP().Run(context.Background(), httpNode(server.URL, "max_retry_times", "1"), nil)
+	require.NoError(t, err)
+	require.Equal(t, `"slow"`, string(output))
+
+	atomic.StoreInt32(&calls, 0)
+	_, err = testHTTP().Run(context.Background(), httpNode(server.URL, "timeout", "50"), nil)
+	require.EqualError(t, err, "POST "+server.URL+": status 503 Service Unavailable: unavailable")
+
+	atomic.StoreInt32(&calls, 10)
+	_, err = testHTTP().Run(context.Background(), httpNode(server.URL+"/bad", "max_retry_times", "3"), nil)
+	require.EqualError(t, err, "POST "+server.URL+"/bad: status 400 Bad Request: bad request")
+	require.Equal(t, int32(11), atomic.LoadInt32(&calls))
+}
+
+// TestHTTPDefaultValue tests outputting default_value after all attempts fail
+func TestHTTPDefaultValue(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	node := httpNode(server.URL, "max_retry_times", "3", "default_value", `{"actions":[]}`)
+	output, err := testHTTP().Run(context.Background(), node, nil)
+	require.NoError(t, err)
+	require.Equal(t, `{"actions":[]}`, string(output))
+	require.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	// 取消时不用默认值
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = testHTTP().Run(ctx, node, nil)
+	require.ErrorIs(t, err, context.Canceled)
+
+	for args, message := range map[string]string{
+		"default_value=actions": `default_value "actions" is not json`,
+		"max_retry_times=x":     `invalid max_retry_times "x"`,
+		"timeout=-1s":           `invalid timeout "-1s"`,
+		"endpoint=":             "endpoint is required",
+	} {
+		kv := strings.SplitN(args, "=", 2)
+		_, err := testHTTP().Run(context.Background(), httpNode(server.URL, kv[0], kv[1]), nil)
+		require.EqualError(t, err, message, args)
+	}
+}
+
+// TestHTTPLimits tests the request and response size limits
+func TestHTTPLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`"` + strings.Repeat("a", 100) + `"`))
+	}))
+	defer server.Close()
+
+	h := testHTTP()
+	h.MaxRequestBytes = 10
+	h.MaxResponseBytes = 50
+	_, err := h.Run(context.Background(), httpNode(server.URL), json.RawMessage(`"0123456789"`))
+	require.EqualError(t, err, "request body of 12 bytes exceeds the limit of 10 bytes")
+	_, err = h.Run(context.Background(), httpNode(server.URL), json.RawMessage(`1`))
+	require.EqualError(t, err, "POST "+server.URL+": response body exceeds the limit of 50 bytes")
+
+	h.MaxResponseBytes = 0
+	output, err := h.Run(context.Background(), httpNode(server.URL), json.RawMessage(`1`))
+	require.NoError(t, err)
+	require.Len(t, output, 102)
+}
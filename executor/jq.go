@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/generators"
+	"github.com/vuuihc/gfc/jq"
+)
+
+// JQ is the builtin.jq op. It runs the filter arg on its input and outputs
+// the first output of the filter, or null if the filter has no output.
+type JQ struct {
+	// queries 缓存解析过的 filter
+	queries sync.Map
+}
+
+func (j *JQ) query(filter string) (*jq.Query, error) {
+	if q, ok := j.queries.Load(filter); ok {
+		return q.(*jq.Query), nil
+	}
+	q, err := jq.Parse(filter)
+	if err != nil {
+		return nil, errors.WrapIff(err, "invalid filter %q", filter)
+	}
+	j.queries.Store(filter, q)
+	return q, nil
+}
+
+func (j *JQ) Run(_ context.Context, node *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+	if _, ok := node.Args["filter"]; !ok {
+		return nil, errors.New("filter is required")
+	}
+	q, err := j.query(Arg(node, "filter"))
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := q.RunJSON(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	return outputs[0], nil
+}
@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/generators"
+)
+
+func TestJQ(t *testing.T) {
+	op := &JQ{}
+	run := func(filter string, input string) (string, error) {
+		node := &generators.Node{Type: "builtin.jq", Args: map[string][]string{"filter": {filter}}}
+		output, err := op.Run(context.Background(), node, json.RawMessage(input))
+		return string(output), err
+	}
+	output, err := run(`{"key": .[0], "payload": .[1], "ttl": 259200000}`, `["k",{"actions":[]}]`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"key":"k","payload":{"actions":[]},"ttl":259200000}`, output)
+	// 只输出第一个结果，没有结果时输出null
+	output, err = run(".[]", `[1,2]`)
+	require.NoError(t, err)
+	require.Equal(t, "1", output)
+	output, err = run("empty", `1`)
+	require.NoError(t, err)
+	require.Equal(t, "null", output)
+
+	_, err = run(".a |", `1`)
+	require.EqualError(t, err, `invalid filter ".a |": offset 4: unexpected end of filter`)
+	_, err = run(".a", `[1]`)
+	require.EqualError(t, err, `cannot index array with "a"`)
+	_, err = op.Run(context.Background(), &generators.Node{Type: "builtin.jq"}, json.RawMessage("1"))
+	require.EqualError(t, err, "filter is required")
+}
+
+// TestRunJQ tests builtin.jq nodes in a graph, with the inputs of several values merged into an array
+func TestRunJQ(t *testing.T) {
+	graph := compile(t, "func main(input) {\n"+
+		"  a = builtin(\"jq\", input, filter=`.a`);\n"+
+		"  b = builtin(\"jq\", input, filter=`.b | join(\",\")`);\n"+
+		"  builtin(\"jq\", [a, b], filter=`{\"sum\": (.[0] + 1), \"joined\": .[1]}`);\n"+
+		"}")
+	result, err := New(Builtins()).Run(context.Background(), graph, json.RawMessage(`{"a":1,"b":["x","y"]}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"sum":2,"joined":"x,y"}`, string(result.Response))
+}
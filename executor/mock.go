@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/generators"
+)
+
+// localBuiltins 是不依赖外部服务的内建op，模拟执行时照常执行
+var localBuiltins = map[string]bool{
+	"builtin.identity":   true,
+	"builtin.jq":         true,
+	"builtin.when_true":  true,
+	"builtin.when_false": true,
+}
+
+// Mock is a canned result of a node
+type Mock struct {
+	Output json.RawMessage
+	// Err 不为空时节点返回这个错误
+	Err string
+}
+
+// Mocks maps node names, node types like model.ner, or op names like ner
+// to canned results
+type Mocks map[string]Mock
+
+// Lookup returns the mock of a node, matched by the node name first, then the
+// node type, then the op name of the type
+func (m Mocks) Lookup(node *generators.Node) (Mock, bool) {
+	keys := []string{node.Name, node.Type}
+	if i := strings.Index(node.Type, "."); i >= 0 {
+		keys = append(keys, node.Type[i+1:])
+	}
+	for _, key := range keys {
+		if mock, ok := m[key]; ok && key != "" {
+			return mock, true
+		}
+	}
+	return Mock{}, false
+}
+
+// Unused returns the sorted keys of the mocks matching no node of a graph,
+// which are likely misspelled
+func (m Mocks) Unused(graph *generators.Graph) []string {
+	used := make(map[string]bool)
+	for i := range graph.Nodes {
+		node := &graph.Nodes[i]
+		if node.Type == startType || node.Type == whenAnyType {
+			continue
+		}
+		used[node.Name], used[node.Type] = true, true
+		if dot := strings.Index(node.Type, "."); dot >= 0 {
+			used[node.Type[dot+1:]] = true
+		}
+	}
+	var unused []string
+	for key := range m {
+		if !used[key] {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// Apply registers the mocks in r for the node types of a graph. Model nodes
+// and builtin nodes calling external services, like http and the cache ops,
+// must be mocked, and fail when they run without a mock. Other nodes with a
+// mock return it instead of running their op.
+func (m Mocks) Apply(r *Registry, graph *generators.Graph) {
+	for i := range graph.Nodes {
+		typ := graph.Nodes[i].Type
+		if typ == startType || typ == whenAnyType {
+			continue
+		}
+		op, ok := r.Lookup(typ)
+		if _, mocked := op.(*mockOp); mocked {
+			continue
+		}
+		if ok && localBuiltins[typ] {
+			r.Register(typ, &mockOp{mocks: m, fallback: op})
+		} else {
+			r.Register(typ, &mockOp{mocks: m})
+		}
+	}
+}
+
+// mockOp returns the mock of a node, or runs fallback if the node has no mock
+type mockOp struct {
+	mocks    Mocks
+	fallback Op
+}
+
+func (o *mockOp) Run(ctx context.Context, node *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+	mock, ok := o.mocks.Lookup(node)
+	switch {
+	case !ok && o.fallback != nil:
+		return o.fallback.Run(ctx, node, input)
+	case !ok:
+		return nil, errors.Errorf("no mock for %s", node.Type)
+	case mock.Err != "":
+		return nil, errors.New(mock.Err)
+	}
+	return mock.Output, nil
+}
@@ -0,0 +1,82 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/generators"
+)
+
+func TestMocksLookup(t *testing.T) {
+	mocks := Mocks{
+		"result":       {Output: json.RawMessage(`"by name"`)},
+		"builtin.http": {Output: json.RawMessage(`"by type"`)},
+		"http":         {Output: json.RawMessage(`"by op"`)},
+		"ner":          {Err: "timeout"},
+	}
+	for _, c := range []struct {
+		node   generators.Node
+		output string
+		err    string
+	}{
+		{generators.Node{Name: "result", Type: "builtin.http"}, `"by name"`, ""},
+		{generators.Node{Name: "other", Type: "builtin.http"}, `"by type"`, ""},
+		{generators.Node{Name: "other", Type: "model.http"}, `"by op"`, ""},
+		{generators.Node{Name: "f.ner", Type: "model.ner"}, "", "timeout"},
+	} {
+		mock, ok := mocks.Lookup(&c.node)
+		require.True(t, ok, c.node.Name)
+		require.Equal(t, c.output, string(mock.Output), c.node.Name)
+		require.Equal(t, c.err, mock.Err, c.node.Name)
+	}
+	_, ok := mocks.Lookup(&generators.Node{Type: "model.other"})
+	require.False(t, ok)
+}
+
+// TestMocksUnused tests finding the mocks matching no node
+func TestMocksUnused(t *testing.T) {
+	graph := compile(t, readmeCode)
+	mocks := Mocks{"builtin.http": {}, "lookup_cache": {}, "model.nerr": {}, "start": {}, "result": {}}
+	require.Equal(t, []string{"model.nerr", "start"}, mocks.Unused(graph))
+	require.Empty(t, Mocks{}.Unused(graph))
+}
+
+// TestMocksApply tests running the README example with the external ops mocked
+func TestMocksApply(t *testing.T) {
+	graph := compile(t, readmeCode)
+	run := func(mocks Mocks) (*Result, error) {
+		registry := Builtins()
+		mocks.Apply(registry, graph)
+		return New(registry).Run(context.Background(), graph, json.RawMessage(readmeInput))
+	}
+	mocks := Mocks{
+		"lookup_cache":       {Output: json.RawMessage(`{"found":false}`)},
+		"builtin.http":       {Output: json.RawMessage(`{"actions":["mocked"]}`)},
+		"setCache.set_cache": {Output: json.RawMessage(`{}`)},
+	}
+	result, err := run(mocks)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"actions":["mocked"]}`, string(result.Response))
+	// jq 照常执行
+	for id, node := range graph.Nodes {
+		if node.Name == "getCacheKey.jq" {
+			require.JSONEq(t, `"######红楼梦小姐姐"`, string(result.Outputs[id]))
+		}
+	}
+
+	// 命中缓存的分支，mock 一个 jq 节点
+	mocks["lookup_cache"] = Mock{Output: json.RawMessage(`{"found":true,"payload":{"actions":["cached"]}}`)}
+	mocks["getCacheKey.jq"] = Mock{Output: json.RawMessage(`"key"`)}
+	result, err = run(mocks)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"actions":["cached"]}`, string(result.Response))
+
+	delete(mocks, "setCache.set_cache")
+	_, err = run(mocks)
+	require.EqualError(t, err, "node setCache.set_cache: no mock for builtin.set_cache")
+	mocks["set_cache"] = Mock{Err: "connection refused"}
+	_, err = run(mocks)
+	require.EqualError(t, err, "node setCache.set_cache: connection refused")
+}
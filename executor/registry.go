@@ -0,0 +1,78 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/vuuihc/gfc/generators"
+)
+
+// Op runs the task of a node. input is the output of the node's only input,
+// or the outputs of several inputs merged into a json array.
+type Op interface {
+	Run(ctx context.Context, node *generators.Node, input json.RawMessage) (json.RawMessage, error)
+}
+
+// OpFunc adapts a function to an Op
+type OpFunc func(ctx context.Context, node *generators.Node, input json.RawMessage) (json.RawMessage, error)
+
+func (f OpFunc) Run(ctx context.Context, node *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+	return f(ctx, node, input)
+}
+
+// Registry maps node types to the ops running them. It is safe for concurrent use.
+type Registry struct {
+	mu  sync.RWMutex
+	ops map[string]Op
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{ops: make(map[string]Op)}
+}
+
+// defaultCacheCapacity 是默认的内存缓存的容量
+const defaultCacheCapacity = 10000
+
+// Builtins creates a registry with the builtin ops. builtin.start and
+// builtin.when_any are run by the executor itself and are not registered.
+// The cache ops share a MemoryCache, RegisterCache replaces it.
+func Builtins() *Registry {
+	r := NewRegistry()
+	r.Register("builtin.identity", OpFunc(identity))
+	r.Register("builtin.when_true", OpFunc(whenTrue))
+	r.Register("builtin.when_false", OpFunc(whenFalse))
+	r.Register("builtin.jq", &JQ{})
+	r.Register("builtin.http", NewHTTP())
+	RegisterCache(r, NewMemoryCache(defaultCacheCapacity))
+	return r
+}
+
+// Register registers the op of a node type, replacing the op registered before
+func (r *Registry) Register(typ string, op Op) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops[typ] = op
+}
+
+// Lookup returns the op of a node type
+func (r *Registry) Lookup(typ string) (Op, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	op, ok := r.ops[typ]
+	return op, ok
+}
+
+// Arg returns the first value of a node arg, or "" if the node doesn't have it
+func Arg(node *generators.Node, name string) string {
+	if values := node.Args[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// identity outputs its input
+func identity(_ context.Context, _ *generators.Node, input json.RawMessage) (json.RawMessage, error) {
+	return input, nil
+}
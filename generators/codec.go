@@ -0,0 +1,93 @@
+package generators
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"emperror.dev/errors"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackTag 是Node和Graph上msgpack字段名使用的struct tag
+const msgpackTag = "msg"
+
+// EncodeJSON marshals a graph to json
+func (g *Graph) EncodeJSON() ([]byte, error) {
+	js, err := json.Marshal(g)
+	return js, errors.WrapIf(err, "marshal graph to json")
+}
+
+// WriteJSON writes a graph as json to w
+func (g *Graph) WriteJSON(w io.Writer) error {
+	js, err := g.EncodeJSON()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(js)
+	return errors.WrapIf(err, "write graph json")
+}
+
+// UnmarshalGraphJSON unmarshals a graph from json
+func UnmarshalGraphJSON(data []byte) (*Graph, error) {
+	graph := &Graph{}
+	if err := json.Unmarshal(data, graph); err != nil {
+		return nil, errors.WrapIf(err, "unmarshal graph from json")
+	}
+	return graph, nil
+}
+
+// EncodeMsgpack marshals a graph to msgpack, using the field names of the msg struct tags
+func (g *Graph) EncodeMsgpack() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := g.WriteMsgpack(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteMsgpack writes a graph as msgpack to w. Map keys are sorted, so the
+// same graph always encodes to the same bytes.
+func (g *Graph) WriteMsgpack(w io.Writer) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag(msgpackTag)
+	enc.SetSortMapKeys(true)
+	return errors.WrapIf(enc.Encode(g), "marshal graph to msgpack")
+}
+
+// EncodeMsgpack encodes the args of a node with the keys sorted, as the
+// SetSortMapKeys option of msgpack only sorts a few map types like map[string]string
+func (a Args) EncodeMsgpack(e *msgpack.Encoder) error {
+	if a == nil {
+		return e.EncodeNil()
+	}
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if err := e.EncodeMapLen(len(keys)); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := e.EncodeString(key); err != nil {
+			return err
+		}
+		if err := e.Encode(a[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalGraphMsgpack unmarshals a graph from msgpack
+func UnmarshalGraphMsgpack(data []byte) (*Graph, error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag(msgpackTag)
+	graph := &Graph{}
+	if err := dec.Decode(graph); err != nil {
+		return nil, errors.WrapIf(err, "unmarshal graph from msgpack")
+	}
+	return graph, nil
+}
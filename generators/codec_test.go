@@ -0,0 +1,86 @@
+package generators
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// testGraph generates the graph used by the codec tests
+func testGraph() *Graph {
+	code := `
+	func main(input) {
+		cacheMiss=builtin("jq", input, filter='.found | not');
+		if(cacheMiss){
+			builtin("http", input, endpoint='http://localhost/', timeout="800ms");
+		}else{
+			builtin("jq", input, filter='.payload');
+		}
+	}`
+	return NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph()
+}
+
+// TestJSONRoundTrip tests marshaling a graph to json and back
+func TestJSONRoundTrip(t *testing.T) {
+	graph := testGraph()
+	js, err := graph.EncodeJSON()
+	require.NoError(t, err)
+	require.Equal(t, graph.MarshalToJson(), js)
+
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteJSON(&buf))
+	require.Equal(t, js, buf.Bytes())
+
+	loaded, err := UnmarshalGraphJSON(js)
+	require.NoError(t, err)
+	require.Equal(t, js, loaded.MarshalToJson())
+
+	_, err = UnmarshalGraphJSON([]byte(`{"nodes": [`))
+	require.Error(t, err)
+}
+
+// TestMsgpackRoundTrip tests marshaling a graph to msgpack and back
+func TestMsgpackRoundTrip(t *testing.T) {
+	graph := testGraph()
+	data, err := graph.EncodeMsgpack()
+	require.NoError(t, err)
+
+	loaded, err := UnmarshalGraphMsgpack(data)
+	require.NoError(t, err)
+	reencoded, err := loaded.EncodeMsgpack()
+	require.NoError(t, err)
+	require.Equal(t, data, reencoded)
+	require.Equal(t, graph.MarshalToJson(), loaded.MarshalToJson())
+
+	_, err = UnmarshalGraphMsgpack(data[:len(data)/2])
+	require.Error(t, err)
+}
+
+// TestMsgpackFieldNames tests that msgpack uses the names and omitempty of the msg struct tags
+func TestMsgpackFieldNames(t *testing.T) {
+	data, err := testGraph().EncodeMsgpack()
+	require.NoError(t, err)
+	var decoded map[string][]map[string]interface{}
+	require.NoError(t, msgpack.Unmarshal(data, &decoded))
+	nodes := decoded["nodes"]
+	require.Equal(t, map[string]interface{}{"type": "builtin.start", "name": "input", "in_degree": int8(0)}, nodes[0])
+	require.Equal(t, []interface{}{int8(1)}, nodes[2]["inputs"])
+	require.Equal(t, map[string]interface{}{"filter": []interface{}{".found | not"}}, nodes[1]["args"])
+	require.Equal(t, true, nodes[len(nodes)-1]["is_response"])
+	require.Contains(t, nodes[3], "dependencies")
+}
+
+// TestMsgpackDeterministic tests that encoding a graph with several args always gives the same bytes
+func TestMsgpackDeterministic(t *testing.T) {
+	graph := testGraph()
+	data, err := graph.EncodeMsgpack()
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		again, err := graph.EncodeMsgpack()
+		require.NoError(t, err)
+		require.Equal(t, data, again)
+	}
+}
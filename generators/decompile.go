@@ -0,0 +1,619 @@
+package generators
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// Decompile rebuilds dagl statements that compile to a graph equivalent to g.
+// Variables are named after the node names, if/else statements are rebuilt
+// from the builtin.when_true, builtin.when_false and builtin.when_any nodes.
+// Graphs using patterns dagl can not express, for example guards moved by
+// EliminateIdentityNodes, are reported as errors. The graph only needs to pass
+// ValidateStructure, so graphs of older compilers are decompiled as if they
+// were normalized, without being modified.
+func Decompile(g *Graph) ([]parser.Statement, error) {
+	if err := g.ValidateStructure(); err != nil {
+		return nil, errors.WrapIf(err, "invalid graph")
+	}
+	g = &Graph{Nodes: append([]Node(nil), g.Nodes...)}
+	g.Normalize()
+	d := newDecompiler(g)
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+	if err := d.place(); err != nil {
+		return nil, err
+	}
+	return d.statements(), nil
+}
+
+// WriteDagl writes a graph as dagl source to w
+func (g *Graph) WriteDagl(w io.Writer) error {
+	statements, err := Decompile(g)
+	if err != nil {
+		return err
+	}
+	return errors.WrapIf(parser.Fprint(w, statements), "write graph dagl")
+}
+
+// dBody is the main function body or a branch of an if statement
+type dBody struct {
+	// guard 是分支的 when_true 或 when_false 节点，main 函数为-1
+	guard int
+	block *dBlock
+	items []dItem
+	// lastUse 是使用这个分支中定义的节点的最后一个节点的位置
+	lastUse int
+}
+
+// dItem is a statement of a body: a node or an if statement
+type dItem struct {
+	node  int
+	block *dBlock
+}
+
+// dBlock is an if statement
+type dBlock struct {
+	cond      int
+	whenTrue  int
+	whenFalse int
+	whenAny   int
+	trueBody  *dBody
+	falseBody *dBody
+	parent    *dBody
+	// wrapped 为true时if语句的结果在语句之外被使用，需要包装成内联函数
+	wrapped bool
+}
+
+type decompiler struct {
+	graph *Graph
+	// order 是节点的拓扑序，position 是节点在order中的位置
+	order    []int
+	position []int
+	// lastConsumer 是使用节点的最后一个节点的位置
+	lastConsumer []int
+	// lastGuarded 是依赖 when_true/when_false 节点的最后一个节点的位置
+	lastGuarded map[int]int
+	// open 是正在生成的函数体和分支，由外到内
+	open    []*dBody
+	bodyOf  []*dBody
+	blockOf []*dBlock
+
+	needVar []bool
+	vars    []string
+	names   map[string]bool
+	funcs   []parser.Statement
+}
+
+func newDecompiler(g *Graph) *decompiler {
+	d := &decompiler{
+		graph:        g,
+		position:     make([]int, len(g.Nodes)),
+		lastConsumer: make([]int, len(g.Nodes)),
+		lastGuarded:  make(map[int]int),
+		bodyOf:       make([]*dBody, len(g.Nodes)),
+		blockOf:      make([]*dBlock, len(g.Nodes)),
+		needVar:      make([]bool, len(g.Nodes)),
+		vars:         make([]string, len(g.Nodes)),
+		names:        map[string]bool{"main": true},
+	}
+	d.order = decompileOrder(g)
+	for pos, id := range d.order {
+		d.position[id] = pos
+		d.lastConsumer[id] = -1
+	}
+	for _, id := range d.order {
+		node := &g.Nodes[id]
+		for _, input := range node.Inputs {
+			d.lastConsumer[input] = d.position[id]
+			// when_any 直接汇合分支的结果，不需要通过变量引用
+			if node.Type != "builtin.when_any" {
+				d.needVar[input] = true
+			}
+		}
+		for _, dependency := range node.Dependencies {
+			d.lastGuarded[dependency] = d.position[id]
+		}
+	}
+	return d
+}
+
+// decompileOrder returns the nodes in topological order. Smaller offsets come
+// first, so a graph generated from dagl keeps its order.
+func decompileOrder(g *Graph) []int {
+	degrees := make([]int, len(g.Nodes))
+	consumers := make([][]int, len(g.Nodes))
+	var ready []int
+	for id := range g.Nodes {
+		for _, upstream := range g.Nodes[id].Upstreams() {
+			degrees[id]++
+			consumers[upstream] = append(consumers[upstream], id)
+		}
+		if degrees[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	var order []int
+	for len(ready) > 0 {
+		sort.Ints(ready)
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+		for _, consumer := range consumers[id] {
+			if degrees[consumer]--; degrees[consumer] == 0 {
+				ready = append(ready, consumer)
+			}
+		}
+	}
+	return order
+}
+
+// isGuard checks if a node is a builtin.when_true or builtin.when_false node
+func (d *decompiler) isGuard(id int) bool {
+	t := d.graph.Nodes[id].Type
+	return t == "builtin.when_true" || t == "builtin.when_false"
+}
+
+// check reports the nodes that no dagl statement generates
+func (d *decompiler) check() error {
+	var errs []error
+	for id := range d.graph.Nodes {
+		node := &d.graph.Nodes[id]
+		switch node.Type {
+		case "builtin.start":
+		case "builtin.when_true", "builtin.when_false":
+			if len(node.Inputs) != 1 || len(node.Args) > 0 {
+				errs = append(errs, fmt.Errorf("node %d: %s should have a single input and no args", id, node.Type))
+			}
+			// 嵌套的if语句的守卫节点依赖外层分支的守卫节点
+			if len(node.Dependencies) > 1 || len(node.Dependencies) == 1 && !d.isGuard(node.Dependencies[0]) {
+				errs = append(errs, fmt.Errorf("node %d: dependencies %v are not a single builtin.when_true or builtin.when_false node", id, node.Dependencies))
+			}
+		case "builtin.when_any":
+			if len(node.Dependencies) > 0 || len(node.Args) > 0 {
+				errs = append(errs, fmt.Errorf("node %d: builtin.when_any should have no dependencies or args", id))
+			}
+		default:
+			if !strings.HasPrefix(node.Type, "builtin.") && !strings.HasPrefix(node.Type, "model.") {
+				errs = append(errs, fmt.Errorf("node %d: type %q is neither builtin nor model", id, node.Type))
+			}
+			// 只有分支中的节点有依赖，依赖就是分支的 when_true 或 when_false 节点
+			if len(node.Dependencies) > 1 || len(node.Dependencies) == 1 && !d.isGuard(node.Dependencies[0]) {
+				errs = append(errs, fmt.Errorf("node %d: dependencies %v are not a single builtin.when_true or builtin.when_false node", id, node.Dependencies))
+			}
+			for name := range node.Args {
+				if !isIdentifier(name) {
+					errs = append(errs, fmt.Errorf("node %d: arg name %q is not an identifier", id, name))
+				}
+			}
+		}
+		for _, input := range node.Inputs {
+			if d.isGuard(input) {
+				errs = append(errs, fmt.Errorf("node %d: input %d is a %s node, which can only be a dependency", id, input, d.graph.Nodes[input].Type))
+			}
+		}
+	}
+	return errors.Combine(errs...)
+}
+
+// place places every node in the main function body or a branch
+func (d *decompiler) place() error {
+	root := &dBody{guard: -1, lastUse: -1}
+	d.open = []*dBody{root}
+	for pos, id := range d.order {
+		var err error
+		switch d.graph.Nodes[id].Type {
+		case "builtin.start":
+			d.bodyOf[id] = root
+		case "builtin.when_true":
+			err = d.placeWhenTrue(pos, id)
+		case "builtin.when_false":
+			err = d.placeWhenFalse(id)
+		case "builtin.when_any":
+			err = d.placeWhenAny(id)
+		default:
+			err = d.placeNode(pos, id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for len(d.open) > 1 {
+		if err := d.close(); err != nil {
+			return err
+		}
+	}
+	return d.placeResponse(root)
+}
+
+func (d *decompiler) top() *dBody {
+	return d.open[len(d.open)-1]
+}
+
+// closable checks if the innermost branch can end before the node at pos
+func (d *decompiler) closable(pos int) bool {
+	body := d.top()
+	// else 分支只能由 when_any 结束
+	if body.guard != body.block.whenTrue {
+		return false
+	}
+	if body.lastUse >= pos || d.lastGuarded[body.guard] > pos {
+		return false
+	}
+	for _, id := range d.order[pos:] {
+		node := &d.graph.Nodes[id]
+		if node.Type == "builtin.when_false" && node.Inputs[0] == body.block.cond {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *decompiler) placeWhenTrue(pos, id int) error {
+	node := &d.graph.Nodes[id]
+	cond := node.Inputs[0]
+	if len(node.Dependencies) == 1 {
+		// 嵌套的if语句在它依赖的分支中
+		for d.top().guard != node.Dependencies[0] {
+			if len(d.open) == 1 {
+				return fmt.Errorf("node %d: the branch of node %d ended before it", id, node.Dependencies[0])
+			}
+			if err := d.close(); err != nil {
+				return err
+			}
+		}
+	}
+	for len(d.open) > 1 && d.closable(pos) {
+		if err := d.close(); err != nil {
+			return err
+		}
+	}
+	if err := d.use(id, cond); err != nil {
+		return err
+	}
+	parent := d.top()
+	block := &dBlock{cond: cond, whenTrue: id, whenFalse: -1, whenAny: -1, parent: parent}
+	block.trueBody = &dBody{guard: id, block: block, lastUse: -1}
+	parent.items = append(parent.items, dItem{node: -1, block: block})
+	d.blockOf[id] = block
+	d.open = append(d.open, block.trueBody)
+	return nil
+}
+
+func (d *decompiler) placeWhenFalse(id int) error {
+	cond := d.graph.Nodes[id].Inputs[0]
+	for {
+		body := d.top()
+		if body.block == nil {
+			return fmt.Errorf("node %d: builtin.when_false has no matching builtin.when_true on node %d", id, cond)
+		}
+		// 条件相同的嵌套if语句由守卫节点的依赖区分
+		if body.guard == body.block.whenTrue && body.block.cond == cond &&
+			equalInts(d.graph.Nodes[body.guard].Dependencies, d.graph.Nodes[id].Dependencies) {
+			break
+		}
+		if err := d.close(); err != nil {
+			return err
+		}
+	}
+	block := d.top().block
+	if err := d.pop(); err != nil {
+		return err
+	}
+	block.whenFalse = id
+	block.falseBody = &dBody{guard: id, block: block, lastUse: -1}
+	d.blockOf[id] = block
+	d.open = append(d.open, block.falseBody)
+	return nil
+}
+
+func (d *decompiler) placeWhenAny(id int) error {
+	for {
+		body := d.top()
+		if body.block == nil {
+			return fmt.Errorf("node %d: builtin.when_any does not join the branches of an if statement", id)
+		}
+		if body.guard == body.block.whenFalse {
+			break
+		}
+		if err := d.close(); err != nil {
+			return err
+		}
+	}
+	block := d.top().block
+	if err := d.pop(); err != nil {
+		return err
+	}
+	trueEnd, falseEnd := d.bodyValue(block.trueBody), d.bodyValue(block.falseBody)
+	if inputs := d.graph.Nodes[id].Inputs; inputs[0] != trueEnd || inputs[1] != falseEnd {
+		return fmt.Errorf("node %d: builtin.when_any should join the last nodes %d and %d of the branches of nodes %d and %d, got %v",
+			id, trueEnd, falseEnd, block.whenTrue, block.whenFalse, inputs)
+	}
+	block.whenAny = id
+	d.blockOf[id] = block
+	return nil
+}
+
+func (d *decompiler) placeNode(pos, id int) error {
+	node := &d.graph.Nodes[id]
+	guard := -1
+	if len(node.Dependencies) == 1 {
+		guard = node.Dependencies[0]
+	}
+	for d.top().guard != guard {
+		if len(d.open) == 1 {
+			return fmt.Errorf("node %d: the branch of node %d ended before it", id, guard)
+		}
+		if err := d.close(); err != nil {
+			return err
+		}
+	}
+	for _, input := range node.Inputs {
+		if err := d.use(id, input); err != nil {
+			return err
+		}
+	}
+	body := d.top()
+	body.items = append(body.items, dItem{node: id})
+	if d.lastConsumer[id] > body.lastUse {
+		body.lastUse = d.lastConsumer[id]
+	}
+	d.bodyOf[id] = body
+	return nil
+}
+
+// placeResponse moves the statement generating the response to the end of main
+func (d *decompiler) placeResponse(root *dBody) error {
+	response := -1
+	for id := range d.graph.Nodes {
+		if d.graph.Nodes[id].IsResponse {
+			response = id
+		}
+	}
+	for i, item := range root.items {
+		if d.itemValue(item) != response {
+			continue
+		}
+		if i == len(root.items)-1 {
+			return nil
+		}
+		// main 函数的最后一个语句是图的Response
+		if d.lastConsumer[response] >= 0 {
+			return fmt.Errorf("node %d: the response node is used by other nodes, so it can not be the last statement of main", response)
+		}
+		root.items = append(append(root.items[:i:i], root.items[i+1:]...), item)
+		return nil
+	}
+	return fmt.Errorf("node %d: the response node is not the result of a statement of main", response)
+}
+
+// pop ends the innermost branch
+func (d *decompiler) pop() error {
+	body := d.top()
+	if len(body.items) == 0 {
+		return fmt.Errorf("node %d: no node depends on %s", body.guard, d.graph.Nodes[body.guard].Type)
+	}
+	d.open = d.open[:len(d.open)-1]
+	return nil
+}
+
+// close ends the innermost branch before its if statement ends
+func (d *decompiler) close() error {
+	if body := d.top(); body.guard != body.block.whenTrue {
+		return fmt.Errorf("node %d: builtin.when_false is not joined by a builtin.when_any", body.guard)
+	}
+	return d.pop()
+}
+
+func (d *decompiler) isOpen(body *dBody) bool {
+	for _, open := range d.open {
+		if open == body {
+			return true
+		}
+	}
+	return false
+}
+
+// use makes node id visible to its consumer. A node in a branch that ended is
+// only visible as the result of the if statement, which is then wrapped in an
+// inline function.
+func (d *decompiler) use(consumer, id int) error {
+	var block *dBlock
+	if body := d.bodyOf[id]; body != nil {
+		if d.isOpen(body) {
+			return nil
+		}
+		block = body.block
+	} else {
+		block = d.blockOf[id]
+	}
+	for ; block != nil && d.blockValue(block) == id; block = block.parent.block {
+		if d.isOpen(block.parent) {
+			block.wrapped = true
+			return nil
+		}
+	}
+	return fmt.Errorf("node %d: uses node %d out of its branch", consumer, id)
+}
+
+func (d *decompiler) itemValue(item dItem) int {
+	if item.block != nil {
+		return d.blockValue(item.block)
+	}
+	return item.node
+}
+
+// blockValue returns the node an if statement results in
+func (d *decompiler) blockValue(block *dBlock) int {
+	if block.whenAny >= 0 {
+		return block.whenAny
+	}
+	return d.bodyValue(block.trueBody)
+}
+
+// bodyValue returns the node the last statement of a branch results in
+func (d *decompiler) bodyValue(body *dBody) int {
+	if len(body.items) == 0 {
+		return -1
+	}
+	return d.itemValue(body.items[len(body.items)-1])
+}
+
+// statements returns the inline functions wrapping if statements and the main function
+func (d *decompiler) statements() []parser.Statement {
+	start := 0
+	for id := range d.graph.Nodes {
+		if d.graph.Nodes[id].Type == "builtin.start" {
+			start = id
+		}
+	}
+	d.vars[start] = d.newName(varBase(d.graph.Nodes[start].Name, "input"))
+	main := parser.FuncStmt{Name: "main", Inputs: []string{d.vars[start]}, Body: d.body(d.open[0])}
+	return append(d.funcs, main)
+}
+
+func (d *decompiler) body(body *dBody) []parser.Statement {
+	var statements []parser.Statement
+	for _, item := range body.items {
+		if item.block != nil {
+			statements = append(statements, d.ifStmt(item.block))
+		} else {
+			statements = append(statements, d.nodeStmt(item.node))
+		}
+	}
+	return statements
+}
+
+func (d *decompiler) ifStmt(block *dBlock) parser.Statement {
+	value := d.blockValue(block)
+	if block.wrapped {
+		// 结果通过内联函数调用赋值给变量，函数中不需要再赋值
+		d.needVar[value] = false
+	}
+	stmt := parser.IfStmt{
+		Cond: parser.NodeExp{Type: parser.NodeExpTypeVar, Value: d.vars[block.cond]},
+		True: d.body(block.trueBody),
+	}
+	if block.falseBody != nil {
+		stmt.False = d.body(block.falseBody)
+	}
+	if !block.wrapped {
+		return stmt
+	}
+	// 内联函数在调用处展开，可以直接使用调用处的变量，所以不需要参数
+	name := d.newName("if_" + d.vars[block.cond])
+	d.funcs = append(d.funcs, parser.FuncStmt{Name: name, Inline: true, Body: []parser.Statement{stmt}})
+	if d.vars[value] == "" {
+		d.vars[value] = d.newName(varBase(d.graph.Nodes[value].Name, "v"))
+	}
+	return parser.NodeAssignStmt{VarName: d.vars[value], Value: parser.FuncCallStmt{Type: parser.FuncCallTypeInline, FuncName: name}}
+}
+
+func (d *decompiler) nodeStmt(id int) parser.Statement {
+	node := &d.graph.Nodes[id]
+	call := parser.FuncCallStmt{Type: parser.FuncCallTypeBuiltin, FuncName: strings.TrimPrefix(node.Type, "builtin.")}
+	if strings.HasPrefix(node.Type, "model.") {
+		call = parser.FuncCallStmt{Type: parser.FuncCallTypeModel, FuncName: strings.TrimPrefix(node.Type, "model.")}
+	}
+	for _, input := range node.Inputs {
+		call.Inputs = append(call.Inputs, parser.NodeExp{Type: parser.NodeExpTypeVar, Value: d.vars[input]})
+	}
+	var names []string
+	for name := range node.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range node.Args[name] {
+			call.Args = append(call.Args, parser.ArgPair{Name: name, Value: parser.StrVal{Type: parser.StrValTypeLiteral, Value: value}})
+		}
+	}
+	// 没有被使用的节点只在有用户起的名字时才赋值给变量
+	if !d.needVar[id] && !isAssignedName(node) {
+		if node.Type == "builtin.identity" && len(call.Inputs) == 1 && len(call.Args) == 0 {
+			return parser.NodeValStmt{Name: d.vars[node.Inputs[0]]}
+		}
+		return call
+	}
+	d.vars[id] = d.newName(varBase(node.Name, call.FuncName))
+	return parser.NodeAssignStmt{VarName: d.vars[id], Value: call}
+}
+
+// isAssignedName checks if a node is named after a variable rather than its op
+func isAssignedName(node *Node) bool {
+	if node.Name == "" {
+		return false
+	}
+	op := node.Type[strings.Index(node.Type, ".")+1:]
+	return varBase(node.Name, "") != op
+}
+
+// varBase returns the variable name without the inline function qualifier
+// and the unique suffix, or fallback if a node has no name
+func varBase(name, fallback string) string {
+	name = name[strings.LastIndex(name, ".")+1:]
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// daglKeywords 是不能作为变量名的标志符
+var daglKeywords = map[string]bool{
+	"builtin": true, "model": true, "if": true, "else": true, "func": true, "inline": true,
+}
+
+// newName returns an identifier based on name that is not used yet
+func (d *decompiler) newName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	base := b.String()
+	if base == "" || unicode.IsDigit([]rune(base)[0]) || daglKeywords[base] {
+		base = "n" + base
+	}
+	unique := base
+	for i := 2; d.names[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", base, i)
+	}
+	d.names[unique] = true
+	return unique
+}
+
+// isIdentifier checks if s is a dagl identifier
+func isIdentifier(s string) bool {
+	for _, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// equalInts checks if two lists have the same elements in the same order
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
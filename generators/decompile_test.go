@@ -0,0 +1,255 @@
+package generators
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// withoutNames returns the json of a graph without node names, which are not kept by decompiling
+func withoutNames(g *Graph) string {
+	nodes := append([]Node(nil), g.Nodes...)
+	for i := range nodes {
+		nodes[i].Name = ""
+	}
+	return string((&Graph{Nodes: nodes}).MarshalToJson())
+}
+
+// testDecompile decompiles the graph of code, and checks that the source compiles to the same graph
+func testDecompile(t *testing.T, code string) string {
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph()
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteDagl(&buf))
+	recompiled := NewGFGenerator(parser.NewParser(buf.String()).Parse()).GenerateGraph()
+	require.Equal(t, withoutNames(graph), withoutNames(recompiled), "decompiled:\n%s", buf.String())
+	return buf.String()
+}
+
+// TestDecompile tests decompiling variables, args and if/else statements
+func TestDecompile(t *testing.T) {
+	code := `
+	inline func lookupCache(key){
+		builtin("lookup_cache", key, prefix='p');
+	}
+	func main(input) {
+		input = builtin("jq", input, filter='.payload | fromjson');
+		cacheRes=@call(lookupCache, [input]);
+		result=builtin("http", input, endpoint='http://localhost/', method='post', default_value='{"actions":[]}');
+		cacheMiss=builtin("jq", cacheRes, filter='.found | not');
+		if(cacheMiss){
+			result;
+		}else{
+			builtin("jq", cacheRes, filter='.payload');
+		}
+	}`
+	expected := `func main(input) {
+    input_2 = builtin("jq", input, filter='.payload | fromjson');
+    cacheRes = builtin("lookup_cache", input_2, prefix='p');
+    result = builtin("http", input_2,
+        default_value='{"actions":[]}',
+        endpoint='http://localhost/',
+        method='post');
+    cacheMiss = builtin("jq", cacheRes, filter='.found | not');
+    if (cacheMiss) {
+        result;
+    } else {
+        builtin("jq", cacheRes, filter='.payload');
+    }
+}
+`
+	require.Equal(t, expected, testDecompile(t, code))
+}
+
+// TestDecompileNestedBranches tests decompiling if statements inside branches
+func TestDecompileNestedBranches(t *testing.T) {
+	testDecompile(t, `
+	func main(input) {
+		a = builtin("jq", input, filter='.a');
+		if (a) {
+			b = model("ner", [input, a], text="it's");
+			if (b) {
+				builtin("jq", b, filter='.b');
+			} else {
+				if (a) {
+					b;
+				}
+			}
+		} else {
+			builtin("http", input, endpoint="http://localhost/");
+			if (a) {
+				a;
+			}
+		}
+	}`)
+	testDecompile(t, `
+	func main(input) {
+		if (input) {
+			if (input) {
+				builtin("jq", input, filter='.a');
+			}
+		} else {
+			builtin("jq", input, filter='.b');
+		}
+		builtin("jq", input, filter='.c');
+	}`)
+}
+
+// TestDecompileBranchResult tests wrapping if statements whose result is used in inline functions
+func TestDecompileBranchResult(t *testing.T) {
+	code := `
+	inline func choose(cond, a, b) {
+		if (cond) {
+			a;
+		} else {
+			b;
+		}
+	}
+	inline func maybe(cond, a) {
+		if (cond) {
+			builtin("jq", a, filter='.a');
+		}
+	}
+	func main(input) {
+		chosen = @call(choose, [input, input, input]);
+		if (chosen) {
+			m = @call(maybe, [chosen, input]);
+			builtin("jq", [m, chosen], filter='.[0]');
+		}
+	}`
+	expected := `inline func if_input() {
+    if (input) {
+        input;
+    } else {
+        input;
+    }
+}
+
+inline func if_chosen() {
+    if (chosen) {
+        m = builtin("jq", input, filter='.a');
+    }
+}
+
+func main(input) {
+    chosen = @call(if_input, []);
+    if (chosen) {
+        m = @call(if_chosen, []);
+        builtin("jq", [m, chosen], filter='.[0]');
+    }
+}
+`
+	require.Equal(t, expected, testDecompile(t, code))
+}
+
+// TestDecompileHandWritten tests decompiling graphs that dagl did not generate
+func TestDecompileHandWritten(t *testing.T) {
+	graph := &Graph{Nodes: []Node{
+		{Type: "builtin.jq", Inputs: []int{2}, Args: map[string][]string{"filter": {".a"}}, InDegree: 1, IsResponse: true},
+		{Type: "builtin.log", Inputs: []int{2}, Args: map[string][]string{"tag": {"a", "it's \"b\""}}, InDegree: 1},
+		{Type: "builtin.start"},
+	}}
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteDagl(&buf))
+	expected := `func main(input) {
+    builtin("log", input, tag='a', tag=` + "`it's \"b\"`" + `);
+    builtin("jq", input, filter='.a');
+}
+`
+	require.Equal(t, expected, buf.String())
+}
+
+// baselineGraph is the README example compiled by the compiler before node names,
+// response nodes and in degrees counting both inputs and dependencies
+const baselineGraph = `{"nodes": [
+	{"type": "builtin.start", "in_degree": 0},
+	{"type": "builtin.jq", "args": {"filter": [".payload | fromjson"]}, "in_degree": 1, "inputs": [0]},
+	{"type": "builtin.jq", "args": {"filter": [".suggestion_type+\"##\"+(.filter_retrievers//[]|join(\"#\"))+\"##\"+(.context//[]|join(\"#\"))+\"##\"+.query"]}, "in_degree": 1, "inputs": [1]},
+	{"type": "builtin.lookup_cache", "args": {"prefix": ["ime_rec_bert_ner_v1"]}, "in_degree": 1, "inputs": [2]},
+	{"type": "builtin.http", "args": {"default_value": ["{\"actions\":[]}"], "endpoint": ["http://192002625-146479.Production/suggestion/"], "max_retry_times": ["3"], "method": ["post"], "timeout": ["800ms"]}, "in_degree": 1, "inputs": [1]},
+	{"type": "builtin.jq", "args": {"filter": ["{\"key\": .[0], \"payload\": .[1], \"ttl\": 259200000}"]}, "in_degree": 2, "inputs": [2, 4]},
+	{"type": "builtin.set_cache", "args": {"prefix": ["ime_rec_bert_ner_v1"]}, "in_degree": 1, "inputs": [5]},
+	{"type": "builtin.jq", "args": {"filter": [".found | not"]}, "in_degree": 1, "inputs": [3]},
+	{"type": "builtin.when_true", "in_degree": 1, "inputs": [7]},
+	{"type": "builtin.identity", "in_degree": 1, "inputs": [4], "dependencies": [8]},
+	{"type": "builtin.when_false", "in_degree": 1, "inputs": [7]},
+	{"type": "builtin.jq", "args": {"filter": [".payload"]}, "in_degree": 1, "inputs": [3], "dependencies": [10]},
+	{"type": "builtin.when_any", "in_degree": 2, "inputs": [9, 11]}
+]}`
+
+// TestDecompileBaseline tests decompiling a graph of an older compiler
+func TestDecompileBaseline(t *testing.T) {
+	graph, err := UnmarshalGraphJSON([]byte(baselineGraph))
+	require.NoError(t, err)
+	old := graph.MarshalToJson()
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteDagl(&buf))
+	require.Equal(t, old, graph.MarshalToJson(), "decompiling modified the graph")
+
+	graph.Normalize()
+	recompiled := NewGFGenerator(parser.NewParser(buf.String()).Parse()).GenerateGraph()
+	require.Equal(t, withoutNames(graph), withoutNames(recompiled), "decompiled:\n%s", buf.String())
+}
+
+// TestDecompileErrors tests reporting graphs that dagl can not express
+func TestDecompileErrors(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		nodes []Node
+		err   string
+	}{
+		{"unknown type", []Node{
+			{Type: "builtin.start"},
+			{Type: "op.rank", Inputs: []int{0}, InDegree: 1, IsResponse: true},
+		}, `node 1: type "op.rank" is neither builtin nor model`},
+		{"several dependencies", []Node{
+			{Type: "builtin.start"},
+			{Type: "builtin.jq", Inputs: []int{0}, InDegree: 1},
+			{Type: "builtin.jq", Inputs: []int{0}, Dependencies: []int{1}, InDegree: 2, IsResponse: true},
+		}, "node 2: dependencies [1] are not a single builtin.when_true or builtin.when_false node"},
+		{"when_any not joining branches", []Node{
+			{Type: "builtin.start"},
+			{Type: "builtin.when_true", Inputs: []int{0}, InDegree: 1},
+			{Type: "builtin.jq", Inputs: []int{0}, Dependencies: []int{1}, InDegree: 2},
+			{Type: "builtin.when_false", Inputs: []int{0}, InDegree: 1},
+			{Type: "builtin.jq", Inputs: []int{0}, Dependencies: []int{3}, InDegree: 2},
+			{Type: "builtin.when_any", Inputs: []int{4, 2}, InDegree: 2, IsResponse: true},
+		}, "node 5: builtin.when_any should join the last nodes 2 and 4 of the branches of nodes 1 and 3, got [4 2]"},
+		{"response used", []Node{
+			{Type: "builtin.start"},
+			{Type: "builtin.jq", Inputs: []int{0}, InDegree: 1, IsResponse: true},
+			{Type: "builtin.log", Inputs: []int{1}, InDegree: 1},
+		}, "node 1: the response node is used by other nodes, so it can not be the last statement of main"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Decompile(&Graph{Nodes: c.nodes})
+			require.EqualError(t, err, c.err)
+		})
+	}
+}
+
+// TestDecompileOptimized tests decompiling a graph whose guards were moved by optimizations
+func TestDecompileOptimized(t *testing.T) {
+	code := `
+	func main(input) {
+		a = builtin("jq", input, filter='.a');
+		if (input) {
+			a;
+		} else {
+			builtin("jq", input, filter='.b');
+		}
+	}`
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).WithOptimizeOptions(OptimizeOptions{EliminateIdentityNodes: true}).GenerateGraph()
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteDagl(&buf))
+	expected := `func main(input) {
+    if (input) {
+        a = builtin("jq", input, filter='.a');
+    } else {
+        builtin("jq", input, filter='.b');
+    }
+}
+`
+	require.Equal(t, expected, buf.String())
+}
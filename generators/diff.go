@@ -0,0 +1,384 @@
+package generators
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// GraphDiff is the structural difference between two graphs. Nodes are matched
+// by their Type, Args, name and upstream topology rather than by offset, so
+// adding a statement does not make every following node look changed.
+type GraphDiff struct {
+	Old *Graph
+	New *Graph
+	// Matches 是Old中节点在New中对应的节点，没有对应节点时为-1
+	Matches []int
+	// Removed 是只在Old中的节点，Added 是只在New中的节点
+	Removed []int
+	Added   []int
+	Changed []NodeChange
+	// RemovedEdges 和 AddedEdges 是两个图中都有的节点的输入和依赖的变化
+	RemovedEdges []DiffEdge
+	AddedEdges   []DiffEdge
+}
+
+// NodeChange is a changed field of a node present in both graphs
+type NodeChange struct {
+	Old    int
+	New    int
+	Field  string
+	Before string
+	After  string
+}
+
+// DiffEdge is an input or a dependency of a node present in both graphs
+type DiffEdge struct {
+	// From 是上游节点的名字
+	From string
+	// To 是节点在New中的位置
+	To int
+	// Input 是边在To的Inputs中的位置，依赖为-1
+	Input int
+}
+
+// DiffGraphs compares two graphs
+func DiffGraphs(old, new *Graph) (*GraphDiff, error) {
+	oldOrder, err := old.topoOrder()
+	if err != nil {
+		return nil, errors.WrapIf(err, "old graph")
+	}
+	newOrder, err := new.topoOrder()
+	if err != nil {
+		return nil, errors.WrapIf(err, "new graph")
+	}
+	d := &GraphDiff{Old: old, New: new}
+	newMatches := d.match(oldOrder, newOrder)
+	for id, match := range d.Matches {
+		if match < 0 {
+			d.Removed = append(d.Removed, id)
+		}
+	}
+	for id, match := range newMatches {
+		if match < 0 {
+			d.Added = append(d.Added, id)
+		}
+	}
+	for id, match := range d.Matches {
+		if match >= 0 {
+			d.compareNodes(id, match)
+		}
+	}
+	return d, nil
+}
+
+// match matches the nodes of the two graphs, and returns the matches of the new nodes
+func (d *GraphDiff) match(oldOrder, newOrder []int) []int {
+	d.Matches = make([]int, len(d.Old.Nodes))
+	newMatches := make([]int, len(d.New.Nodes))
+	for i := range d.Matches {
+		d.Matches[i] = -1
+	}
+	for i := range newMatches {
+		newMatches[i] = -1
+	}
+	link := func(oldID, newID int) {
+		d.Matches[oldID] = newID
+		newMatches[newID] = oldID
+	}
+	// 先匹配计算和上游拓扑完全相同的节点，同名的节点优先
+	bySignature := make(map[string][]int)
+	oldSignatures := signatures(d.Old, oldOrder)
+	for _, id := range oldOrder {
+		bySignature[oldSignatures[id]] = append(bySignature[oldSignatures[id]], id)
+	}
+	newSignatures := signatures(d.New, newOrder)
+	for _, id := range newOrder {
+		candidates := bySignature[newSignatures[id]]
+		if len(candidates) == 0 {
+			continue
+		}
+		chosen := 0
+		for i, candidate := range candidates {
+			if d.Old.Nodes[candidate].Name == d.New.Nodes[id].Name {
+				chosen = i
+				break
+			}
+		}
+		link(candidates[chosen], id)
+		bySignature[newSignatures[id]] = append(candidates[:chosen:chosen], candidates[chosen+1:]...)
+	}
+	// 再按名字、类型和已经匹配的上游匹配变化了的节点
+	for _, newID := range newOrder {
+		if newMatches[newID] >= 0 {
+			continue
+		}
+		best, bestScore := -1, 0
+		for _, oldID := range oldOrder {
+			if d.Matches[oldID] >= 0 {
+				continue
+			}
+			if score := d.similarity(oldID, newID, d.Matches); score > bestScore {
+				best, bestScore = oldID, score
+			}
+		}
+		if best >= 0 {
+			link(best, newID)
+		}
+	}
+	return newMatches
+}
+
+// similarity scores how likely a new node is a changed old node, 0 if unrelated
+func (d *GraphDiff) similarity(oldID, newID int, matches []int) int {
+	oldNode, newNode := &d.Old.Nodes[oldID], &d.New.Nodes[newID]
+	sameName := oldNode.Name != "" && oldNode.Name == newNode.Name
+	if !sameName && oldNode.Type != newNode.Type {
+		return 0
+	}
+	related := 0
+	for i, input := range oldNode.Inputs {
+		if i < len(newNode.Inputs) && matches[input] == newNode.Inputs[i] {
+			related++
+		}
+	}
+	for _, dependency := range oldNode.Dependencies {
+		for _, newDependency := range newNode.Dependencies {
+			if matches[dependency] == newDependency {
+				related++
+			}
+		}
+	}
+	argsEqual := argsKey(oldNode.Args) == argsKey(newNode.Args)
+	if !sameName && related == 0 && !argsEqual {
+		return 0
+	}
+	score := related
+	if sameName {
+		score += 8
+	}
+	if oldNode.Type == newNode.Type {
+		score += 4
+	}
+	if argsEqual {
+		score += 2
+	}
+	return score
+}
+
+// signatures hashes the computation of every node together with its upstream topology
+func signatures(g *Graph, order []int) []string {
+	sigs := make([]string, len(g.Nodes))
+	for _, id := range order {
+		node := &g.Nodes[id]
+		var dependencies []string
+		for _, dependency := range node.Dependencies {
+			dependencies = append(dependencies, sigs[dependency])
+		}
+		sort.Strings(dependencies)
+		var inputs []string
+		for _, input := range node.Inputs {
+			inputs = append(inputs, sigs[input])
+		}
+		key, _ := json.Marshal(struct {
+			Type         string
+			Args         string
+			IsResponse   bool
+			Inputs       []string
+			Dependencies []string
+		}{node.Type, argsKey(node.Args), node.IsResponse, inputs, dependencies})
+		sum := sha1.Sum(key)
+		sigs[id] = hex.EncodeToString(sum[:])
+	}
+	return sigs
+}
+
+// argsKey returns a comparable form of args, treating nil and empty args the same
+func argsKey(args map[string][]string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	key, _ := json.Marshal(args)
+	return string(key)
+}
+
+// compareNodes records the changes of a matched node
+func (d *GraphDiff) compareNodes(oldID, newID int) {
+	oldNode, newNode := &d.Old.Nodes[oldID], &d.New.Nodes[newID]
+	change := func(field, before, after string) {
+		d.Changed = append(d.Changed, NodeChange{Old: oldID, New: newID, Field: field, Before: before, After: after})
+	}
+	// 旧的编译器生成的节点没有名字，不算改名
+	if oldNode.Name != newNode.Name && oldNode.Name != "" && newNode.Name != "" {
+		change("name", oldNode.Name, newNode.Name)
+	}
+	if oldNode.Type != newNode.Type {
+		change("type", oldNode.Type, newNode.Type)
+	}
+	for _, name := range unionArgNames(oldNode.Args, newNode.Args) {
+		before, after := oldNode.Args[name], newNode.Args[name]
+		if argValues(before) != argValues(after) {
+			change("args."+name, argValues(before), argValues(after))
+		}
+	}
+	if oldNode.IsResponse != newNode.IsResponse {
+		change("is_response", fmt.Sprint(oldNode.IsResponse), fmt.Sprint(newNode.IsResponse))
+	}
+	oldEdges := diffEdges(d.Old, oldID, newID, d.Matches)
+	newEdges := diffEdges(d.New, newID, newID, nil)
+	for key, edge := range oldEdges {
+		if _, ok := newEdges[key]; !ok {
+			d.RemovedEdges = append(d.RemovedEdges, edge)
+		}
+	}
+	for key, edge := range newEdges {
+		if _, ok := oldEdges[key]; !ok {
+			d.AddedEdges = append(d.AddedEdges, edge)
+		}
+	}
+	sortEdges(d.RemovedEdges)
+	sortEdges(d.AddedEdges)
+}
+
+// edges returns the inputs and dependencies of a node, keyed so that edges
+// from matched upstream nodes compare equal across the graphs
+func diffEdges(g *Graph, id, to int, matches []int) map[string]DiffEdge {
+	edges := make(map[string]DiffEdge)
+	add := func(from, input int) {
+		key := fmt.Sprintf("new %d", from)
+		if matches != nil {
+			if matches[from] >= 0 {
+				key = fmt.Sprintf("new %d", matches[from])
+			} else {
+				key = fmt.Sprintf("old %d", from)
+			}
+		}
+		key += fmt.Sprintf(" %d", input)
+		edges[key] = DiffEdge{From: NodeName(g, from), To: to, Input: input}
+	}
+	node := &g.Nodes[id]
+	for i, input := range node.Inputs {
+		add(input, i)
+	}
+	for _, dependency := range node.Dependencies {
+		add(dependency, -1)
+	}
+	return edges
+}
+
+func sortEdges(edges []DiffEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].To != edges[j].To {
+			return edges[i].To < edges[j].To
+		}
+		if edges[i].Input != edges[j].Input {
+			return edges[i].Input < edges[j].Input
+		}
+		return edges[i].From < edges[j].From
+	})
+}
+
+func unionArgNames(a, b map[string][]string) []string {
+	var names []string
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func argValues(values []string) string {
+	if values == nil {
+		return "<none>"
+	}
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Equivalent checks if the graphs compute the same. Renamed nodes are still equivalent.
+func (d *GraphDiff) Equivalent() bool {
+	if len(d.Removed) > 0 || len(d.Added) > 0 || len(d.RemovedEdges) > 0 || len(d.AddedEdges) > 0 {
+		return false
+	}
+	for _, change := range d.Changed {
+		if change.Field != "name" {
+			return false
+		}
+	}
+	return true
+}
+
+// NodeName returns the dagl name of a node, or its offset if it has no name
+func NodeName(g *Graph, id int) string {
+	if name := g.Nodes[id].Name; name != "" {
+		return name
+	}
+	return fmt.Sprintf("#%d", id)
+}
+
+// describeNode describes a node like a dagl call
+func describeNode(g *Graph, id int) string {
+	node := &g.Nodes[id]
+	var inputs []string
+	for _, input := range node.Inputs {
+		inputs = append(inputs, NodeName(g, input))
+	}
+	desc := fmt.Sprintf("%s = %s(%s)", NodeName(g, id), node.Type, strings.Join(inputs, ", "))
+	for _, name := range unionArgNames(node.Args, nil) {
+		desc += fmt.Sprintf(" %s=%s", name, argValues(node.Args[name]))
+	}
+	if len(node.Dependencies) > 0 {
+		var dependencies []string
+		for _, dependency := range node.Dependencies {
+			dependencies = append(dependencies, NodeName(g, dependency))
+		}
+		desc += fmt.Sprintf(" after %s", strings.Join(dependencies, ", "))
+	}
+	if node.IsResponse {
+		desc += " (response)"
+	}
+	return desc
+}
+
+// Write writes the differences, one per line: - for removed, + for added and ~ for changed
+func (d *GraphDiff) Write(w io.Writer) error {
+	var buf strings.Builder
+	for _, id := range d.Removed {
+		fmt.Fprintf(&buf, "- node %s\n", describeNode(d.Old, id))
+	}
+	for _, id := range d.Added {
+		fmt.Fprintf(&buf, "+ node %s\n", describeNode(d.New, id))
+	}
+	for _, change := range d.Changed {
+		fmt.Fprintf(&buf, "~ node %s: %s %s -> %s\n", NodeName(d.New, change.New), change.Field, change.Before, change.After)
+	}
+	for _, edge := range d.RemovedEdges {
+		fmt.Fprintf(&buf, "- edge %s\n", edge.describe(d.New))
+	}
+	for _, edge := range d.AddedEdges {
+		fmt.Fprintf(&buf, "+ edge %s\n", edge.describe(d.New))
+	}
+	_, err := io.WriteString(w, buf.String())
+	return errors.WrapIf(err, "write graph diff")
+}
+
+func (e DiffEdge) describe(g *Graph) string {
+	if e.Input < 0 {
+		return fmt.Sprintf("%s -> %s (dependency)", e.From, NodeName(g, e.To))
+	}
+	return fmt.Sprintf("%s -> %s (input %d)", e.From, NodeName(g, e.To), e.Input)
+}
@@ -0,0 +1,131 @@
+package generators
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// testDiff compiles two dagl programs and writes their differences
+func testDiff(t *testing.T, old, new string) (*GraphDiff, string) {
+	oldGraph := NewGFGenerator(parser.NewParser(old).Parse()).GenerateGraph()
+	newGraph := NewGFGenerator(parser.NewParser(new).Parse()).GenerateGraph()
+	diff, err := DiffGraphs(oldGraph, newGraph)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, diff.Write(&buf))
+	return diff, buf.String()
+}
+
+const diffCode = `
+func main(input) {
+	cacheRes = builtin("lookup_cache", input, prefix='p');
+	result = builtin("http", input, endpoint='http://localhost/');
+	cacheMiss = builtin("jq", cacheRes, filter='.found | not');
+	if (cacheMiss) {
+		result;
+	} else {
+		builtin("jq", cacheRes, filter='.payload');
+	}
+}`
+
+// TestDiffEquivalent tests that reordered statements and renamed variables are equivalent
+func TestDiffEquivalent(t *testing.T) {
+	diff, out := testDiff(t, diffCode, diffCode)
+	require.True(t, diff.Equivalent())
+	require.Empty(t, out)
+
+	diff, out = testDiff(t, diffCode, `
+	func main(input) {
+		response = builtin("http", input, endpoint='http://localhost/');
+		cacheRes = builtin("lookup_cache", input, prefix='p');
+		cacheMiss = builtin("jq", cacheRes, filter='.found | not');
+		if (cacheMiss) {
+			response;
+		} else {
+			builtin("jq", cacheRes, filter='.payload');
+		}
+	}`)
+	require.True(t, diff.Equivalent())
+	require.Equal(t, "~ node response: name result -> response\n", out)
+}
+
+// TestDiffChanges tests reporting added, removed and changed nodes and edges
+func TestDiffChanges(t *testing.T) {
+	diff, out := testDiff(t, diffCode, `
+	func main(input) {
+		cacheRes = builtin("lookup_cache", input, prefix='p');
+		result = builtin("http", input, endpoint='http://localhost:8080/', timeout='800ms');
+		logged = builtin("log", result);
+		cacheMiss = builtin("jq", cacheRes, filter='.found | not');
+		if (cacheMiss) {
+			logged;
+		} else {
+			builtin("jq", cacheRes, filter='.payload');
+		}
+	}`)
+	require.False(t, diff.Equivalent())
+	require.Equal(t, `+ node logged = builtin.log(result)
+~ node result: args.endpoint "http://localhost/" -> "http://localhost:8080/"
+~ node result: args.timeout <none> -> "800ms"
+- edge result -> identity (input 0)
++ edge logged -> identity (input 0)
+`, out)
+
+	diff, out = testDiff(t, diffCode, `
+	func main(input) {
+		cacheRes = builtin("lookup_cache", input, prefix='p');
+		cacheMiss = builtin("jq", cacheRes, filter='.found | not');
+		if (cacheMiss) {
+			input;
+		} else {
+			builtin("jq", cacheRes, filter='.payload');
+		}
+	}`)
+	require.False(t, diff.Equivalent())
+	require.Equal(t, `- node result = builtin.http(input) endpoint="http://localhost/"
+- edge result -> identity (input 0)
++ edge input -> identity (input 0)
+`, out)
+}
+
+// TestDiffInputOrder tests that swapping inputs changes the edges
+func TestDiffInputOrder(t *testing.T) {
+	diff, out := testDiff(t, `
+	func main(input) {
+		a = builtin("jq", input, filter='.a');
+		b = builtin("jq", input, filter='.b');
+		builtin("jq", [a, b], filter='.[0]');
+	}`, `
+	func main(input) {
+		a = builtin("jq", input, filter='.a');
+		b = builtin("jq", input, filter='.b');
+		builtin("jq", [b, a], filter='.[0]');
+	}`)
+	require.False(t, diff.Equivalent())
+	require.Equal(t, `- edge a -> jq (input 0)
+- edge b -> jq (input 1)
++ edge b -> jq (input 0)
++ edge a -> jq (input 1)
+`, out)
+}
+
+// TestDiffUnnamed tests diffing hand written graphs without node names
+func TestDiffUnnamed(t *testing.T) {
+	old := &Graph{Nodes: []Node{
+		{Type: "builtin.start"},
+		{Type: "builtin.jq", Inputs: []int{0}, Args: map[string][]string{"filter": {".a"}}, InDegree: 1, IsResponse: true},
+	}}
+	new := &Graph{Nodes: []Node{
+		{Type: "builtin.jq", Inputs: []int{1}, Args: map[string][]string{"filter": {".b"}}, InDegree: 1, IsResponse: true},
+		{Type: "builtin.start"},
+	}}
+	diff, err := DiffGraphs(old, new)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 0}, diff.Matches)
+	var buf bytes.Buffer
+	require.NoError(t, diff.Write(&buf))
+	require.Equal(t, "~ node #0: args.filter \".a\" -> \".b\"\n", buf.String())
+}
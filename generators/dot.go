@@ -0,0 +1,83 @@
+package generators
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// labelMaxArgLen 是节点标签中参数值的最大长度，过长的值会被截断
+const labelMaxArgLen = 60
+
+// dotShapes 是分支相关节点在DOT中的形状
+var dotShapes = map[string]string{
+	"builtin.start":      "oval",
+	"builtin.when_true":  "diamond",
+	"builtin.when_false": "Mdiamond",
+	"builtin.when_any":   "invtriangle",
+}
+
+// WriteDOT writes the graph in graphviz DOT format. Input edges are solid and
+// labelled with the position of the input, dependency edges are dashed, and
+// the response node is highlighted.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph gflow {")
+	fmt.Fprintln(bw, `  node [shape=box, fontname="monospace"];`)
+	for id := range g.Nodes {
+		node := &g.Nodes[id]
+		attrs := []string{fmt.Sprintf("label=%s", dotQuote(nodeLabel(id, node)))}
+		if shape, ok := dotShapes[node.Type]; ok {
+			attrs = append(attrs, "shape="+shape)
+		}
+		if node.IsResponse {
+			attrs = append(attrs, `style="bold,filled"`, `fillcolor="lightyellow"`, "peripheries=2")
+		}
+		fmt.Fprintf(bw, "  n%d [%s];\n", id, strings.Join(attrs, ", "))
+	}
+	for id := range g.Nodes {
+		node := &g.Nodes[id]
+		for i, input := range node.Inputs {
+			if len(node.Inputs) > 1 {
+				fmt.Fprintf(bw, "  n%d -> n%d [label=\"%d\"];\n", input, id, i)
+			} else {
+				fmt.Fprintf(bw, "  n%d -> n%d;\n", input, id)
+			}
+		}
+		for _, dependency := range node.Dependencies {
+			fmt.Fprintf(bw, "  n%d -> n%d [style=dashed, color=gray40];\n", dependency, id)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// nodeLabel returns the label of a node: its offset, Name, Type and Args
+func nodeLabel(id int, node *Node) string {
+	lines := []string{fmt.Sprintf("%d: %s", id, node.Type)}
+	if node.Name != "" {
+		lines[0] = fmt.Sprintf("%d: %s = %s", id, node.Name, node.Type)
+	}
+	names := make([]string, 0, len(node.Args))
+	for name := range node.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range node.Args[name] {
+			if runes := []rune(value); len(runes) > labelMaxArgLen {
+				value = string(runes[:labelMaxArgLen]) + "..."
+			}
+			lines = append(lines, fmt.Sprintf("%s=%s", name, value))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// dotQuote quotes a string as a DOT string
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,57 @@
+package generators
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// TestWriteDOT tests writing a graph in DOT format
+func TestWriteDOT(t *testing.T) {
+	code := `
+	func main(input) {
+		cacheMiss=builtin("jq", input, filter='.found | not');
+		if(cacheMiss){
+			builtin("jq", [input, cacheMiss], filter='.[0]');
+		}else{
+			builtin("http", input, endpoint="http://localhost/", method="post");
+		}
+	}`
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph()
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteDOT(&buf))
+	expected := `digraph gflow {
+  node [shape=box, fontname="monospace"];
+  n0 [label="0: input = builtin.start", shape=oval];
+  n1 [label="1: cacheMiss = builtin.jq\nfilter=.found | not"];
+  n2 [label="2: when_true = builtin.when_true", shape=diamond];
+  n3 [label="3: jq = builtin.jq\nfilter=.[0]"];
+  n4 [label="4: when_false = builtin.when_false", shape=Mdiamond];
+  n5 [label="5: http = builtin.http\nendpoint=http://localhost/\nmethod=post"];
+  n6 [label="6: when_any = builtin.when_any", shape=invtriangle, style="bold,filled", fillcolor="lightyellow", peripheries=2];
+  n0 -> n1;
+  n1 -> n2;
+  n0 -> n3 [label="0"];
+  n1 -> n3 [label="1"];
+  n2 -> n3 [style=dashed, color=gray40];
+  n1 -> n4;
+  n0 -> n5;
+  n4 -> n5 [style=dashed, color=gray40];
+  n3 -> n6 [label="0"];
+  n5 -> n6 [label="1"];
+}
+`
+	require.Equal(t, expected, buf.String())
+}
+
+// TestDOTLabel tests escaping and truncating args in DOT labels
+func TestDOTLabel(t *testing.T) {
+	node := &Node{Type: "builtin.jq", Args: map[string][]string{
+		"filter": {`{"key": .[0]}`},
+		"long":   {"0123456789012345678901234567890123456789012345678901234567890123456789"},
+	}}
+	require.Equal(t, `"2: builtin.jq\nfilter={\"key\": .[0]}\nlong=012345678901234567890123456789012345678901234567890123456789..."`,
+		dotQuote(nodeLabel(2, node)))
+}
@@ -1,9 +1,9 @@
 package generators
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 
 	"emperror.dev/emperror"
 	"github.com/vuuihc/gfc/parser"
@@ -16,13 +16,14 @@ type Node struct {
 	Type string `msg:"type" json:"type"`
 
 	// Args 节点执行时候的参数。节点执行时也会传递给节点执行期
-	Args map[string][]string `msg:"args,omitempty" json:"args,omitempty"`
+	Args Args `msg:"args,omitempty" json:"args,omitempty"`
 
 	// InDegree 节点的入度。当运行时入度为0时，则该节点可以被调度执行。
+	//          入度是Inputs和Dependencies去重后的并集的大小。
 	InDegree int `msg:"in_degree" json:"in_degree"`
 
 	// Inputs 这个节点依赖的其他节点的输出。int为其他节点在Graph中的Offset。
-	// 需要注意的是，输入数量不一定和入度一样。如果一个节点只需要部分输入，则InDegree小于inputs的数量。
+	// 需要注意的是，输入数量不一定和入度一样。重复的输入，或者同时也是依赖的输入，只计算一次入度。
 	// 这个输入会归并成 json array传递给节点执行器
 	Inputs []int `msg:"inputs,omitempty" json:"inputs,omitempty"`
 
@@ -35,8 +36,79 @@ type Node struct {
 	// 需要注意的是，图的IsResponse节点不一定是图的最后一个节点。在返回Response之后，系统
 	// 还可以继续执行一些操作。
 	IsResponse bool `msg:"is_response,omitempty" json:"is_response,omitempty"`
+
+	// Name 节点在图中唯一的名字，可以用于运行时的日志和监控。
+	//      被赋值给变量的节点以变量名命名，其他节点以任务名命名。内联函数中的节点以函数名限定，如 setCache.cacheReq
+	//      重名时第一个节点不加后缀，之后的节点加上生成它的main函数中语句的行号，如重新赋值的变量 input@18，
+	//      内联函数中的节点是 @call 的行号。同一行有多个重名的节点时再以出现顺序区分，如 jq@18-2
+	Name string `msg:"name,omitempty" json:"name,omitempty"`
+
+	// Source 生成这个节点的dagl源码位置。只有生成器打开了源码信息时才会填充。
+	Source *Source `msg:"source,omitempty" json:"source,omitempty"`
+
+	// Scope 生成这个节点时所在的内联函数调用和if分支，由外到内。只在编译时使用，不会被序列化。
+	Scope []Scope `msg:"-" json:"-"`
+}
+
+// Source is the position in dagl source that a node was generated from
+type Source struct {
+	File   string `msg:"file,omitempty" json:"file,omitempty"`
+	Line   int    `msg:"line" json:"line"`
+	Column int    `msg:"column" json:"column"`
+
+	// CallStack 展开这个节点的 @call 调用位置，由外到内
+	CallStack []CallSite `msg:"call_stack,omitempty" json:"call_stack,omitempty"`
+}
+
+// CallSite is the position of an @call that inlined a function
+type CallSite struct {
+	Func   string `msg:"func" json:"func"`
+	File   string `msg:"file,omitempty" json:"file,omitempty"`
+	Line   int    `msg:"line" json:"line"`
+	Column int    `msg:"column" json:"column"`
+}
+
+type ScopeKind int
+
+const (
+	ScopeCall        ScopeKind = iota // 函数调用
+	ScopeTrueBranch                   // if 的 true 分支
+	ScopeFalseBranch                  // if 的 else 分支
+)
+
+// Scope is an inlined function call or an if branch that nodes are generated in
+type Scope struct {
+	// ID 在一个图中唯一标识一次函数调用或者一个分支
+	ID   int
+	Kind ScopeKind
+	// Name 函数调用时是函数名，分支时是if的条件
+	Name string
+	// Pos 函数调用时是 @call 的位置，分支时是if语句的位置
+	Pos parser.Pos
 }
 
+func (s Scope) String() string {
+	switch s.Kind {
+	case ScopeCall:
+		return "@call " + s.Name
+	case ScopeTrueBranch:
+		return "if " + s.Name
+	case ScopeFalseBranch:
+		return "else " + s.Name
+	default:
+		return "unknown"
+	}
+}
+
+// isRoot checks if a scope is the call of main, which is not expanded by @call
+// and has no call position
+func (s Scope) isRoot() bool {
+	return s.Kind == ScopeCall && !s.Pos.IsValid()
+}
+
+// Args are the args of a node by name
+type Args map[string][]string
+
 type Graph struct {
 	// 图只由节点构成。每个节点只有一个输出。每个节点可以是其他节点的输入。
 	Nodes []Node `msg:"nodes" json:"nodes"`
@@ -44,34 +116,52 @@ type Graph struct {
 
 // NewNode creates a new node
 func (g *Graph) AddNode(node Node) int {
-	if node.InDegree == 0 {
-		if len(node.Dependencies) == 0 {
-			node.InDegree = len(node.Inputs)
-		} else {
-			node.InDegree = len(node.Dependencies)
-		}
-	}
+	node.InDegree = inDegree(&node)
 	g.Nodes = append(g.Nodes, node)
 	return len(g.Nodes) - 1
 }
 
-// MarshalToJson marshals a graph to json
+// inDegree computes the in degree of a node from the deduplicated union of
+// its inputs and dependencies
+func inDegree(node *Node) int {
+	return len(node.Upstreams())
+}
+
+// Upstreams returns the deduplicated union of the inputs and dependencies of
+// a node, inputs first. A node runs after all of its upstreams.
+func (node *Node) Upstreams() []int {
+	return unionInts(node.Inputs, node.Dependencies)
+}
+
+// MarshalToJson marshals a graph to json, and panics on error
 func (g *Graph) MarshalToJson() []byte {
-	js, err := json.Marshal(g)
+	js, err := g.EncodeJSON()
 	emperror.Panic(err)
 	return js
 }
 
 // Stack is a map of variables and their values
-type Stack map[string]interface{}
+type Stack struct {
+	values map[string]interface{}
+	// origins 记录名字的定义位置，用于错误信息
+	origins map[string]string
+}
+
+// newStack creates an empty stack
+func newStack() Stack {
+	return Stack{values: make(map[string]interface{}), origins: make(map[string]string)}
+}
 
 // Copy copies a stack
 func (s Stack) Copy() Stack {
-	newStack := make(Stack)
-	for k, v := range s {
-		newStack[k] = v
+	copied := newStack()
+	for k, v := range s.values {
+		copied.values[k] = v
+	}
+	for k, v := range s.origins {
+		copied.origins[k] = v
 	}
-	return newStack
+	return copied
 }
 
 // GFGenerator is a gflow generator
@@ -80,6 +170,18 @@ func (s Stack) Copy() Stack {
 type GFGenerator struct {
 	statements []parser.Statement
 	graph      *Graph
+	optimize   OptimizeOptions
+	// scopes 是当前正在展开的函数调用和分支，由外到内
+	scopes  []Scope
+	scopeID int
+	// withSource 为true时在节点上记录源码位置
+	withSource bool
+	sourceFile string
+	// names 是已经被使用的节点名字，named 是已经以变量名命名的节点
+	names map[string]bool
+	named map[int]bool
+	// constPos 是每个常量的字符串字面量的位置，常量引用常量时是被引用的字符串的位置
+	constPos map[string]parser.Pos
 }
 
 // NewGFGenerator creates a new gflow generator
@@ -89,26 +191,114 @@ func NewGFGenerator(statements []parser.Statement) *GFGenerator {
 		graph: &Graph{Nodes: []Node{{
 			Type: "builtin.start",
 		}}},
+		names:    make(map[string]bool),
+		named:    make(map[int]bool),
+		constPos: make(map[string]parser.Pos),
 	}
 }
 
-// reportError reports an error
+// WithOptimizeOptions sets the optimizations applied to the generated graph
+func (g *GFGenerator) WithOptimizeOptions(opts OptimizeOptions) *GFGenerator {
+	g.optimize = opts
+	return g
+}
+
+// WithSource records the source position and the inline call stack on every node.
+// file is the name of the dagl file the statements were parsed from.
+func (g *GFGenerator) WithSource(file string) *GFGenerator {
+	g.withSource = true
+	g.sourceFile = file
+	return g
+}
+
+// reportErrorf reports an error at a statement and stops generating
 func (g *GFGenerator) reportErrorf(stmt parser.Statement, format string, args ...interface{}) {
-	ctx := fmt.Sprintf("current statement: %s\n", stmt)
-	msg := fmt.Sprintf(format, args...)
-	log.Fatalf("generator error: %s\n%s", msg, ctx)
+	panic(&parser.Error{Pos: stmtPos(stmt), Msg: fmt.Sprintf(format, args...)})
+}
+
+// reportErrorAt reports an error at a position in a statement, or at the statement if the position is unknown
+func (g *GFGenerator) reportErrorAt(stmt parser.Statement, pos parser.Pos, format string, args ...interface{}) {
+	if !pos.IsValid() {
+		pos = stmtPos(stmt)
+	}
+	panic(&parser.Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// stmtPos returns the position of a statement
+func stmtPos(stmt parser.Statement) parser.Pos {
+	switch v := stmt.(type) {
+	case parser.AssignStmt:
+		return v.Pos
+	case *parser.AssignStmt:
+		return v.Pos
+	case parser.NodeAssignStmt:
+		return v.Pos
+	case *parser.NodeAssignStmt:
+		return v.Pos
+	case parser.FuncCallStmt:
+		return v.Pos
+	case *parser.FuncCallStmt:
+		return v.Pos
+	case parser.IfStmt:
+		return v.Pos
+	case *parser.IfStmt:
+		return v.Pos
+	case parser.FuncStmt:
+		return v.Pos
+	case parser.NodeValStmt:
+		return v.Pos
+	case parser.CommentStmt:
+		return v.Pos
+	case parser.TestStmt:
+		return v.Pos
+	}
+	return parser.Pos{}
+}
+
+// at describes a position in an origin message
+func at(pos parser.Pos) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	return " at " + pos.String()
 }
 
-// GenerateGraph generates a gflow graph
+// GenerateGraph generates a gflow graph, and exits the process on errors
 func (g *GFGenerator) GenerateGraph() *Graph {
-	stack := Stack{}
+	graph, err := g.Generate()
+	if err != nil {
+		if pos := err.(*parser.Error).Pos; pos.IsValid() {
+			log.Fatalf("generator error at %s: %s", pos, err.(*parser.Error).Msg)
+		}
+		log.Fatalf("generator error: %s", err)
+	}
+	return graph
+}
+
+// Generate generates a gflow graph, and returns the first error as a *parser.Error
+func (g *GFGenerator) Generate() (graph *Graph, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*parser.Error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	stack := newStack()
 	for _, statement := range g.statements {
 		switch v := statement.(type) {
 		case parser.AssignStmt: // const definition
-			stack[v.VarName] = v.Value
+			stack.define(v.VarName, g.resolveConst(&v, v.Value, stack), "constant defined"+at(v.Pos))
+			if v.Value.Type == parser.StrValTypeLiteral {
+				g.constPos[v.VarName] = v.Value.Pos
+			} else {
+				g.constPos[v.VarName] = g.constPos[v.Value.Value]
+			}
 			break
 		case parser.FuncStmt: // func definition
-			stack[v.Name] = v
+			stack.define(v.Name, v, "function defined"+at(v.Pos))
 			break
 		case parser.FuncCallStmt: // func call
 			g.newFuncCallNode(&v, stack, nil)
@@ -119,28 +309,36 @@ func (g *GFGenerator) GenerateGraph() *Graph {
 		case parser.IfStmt:
 			g.newIfNode(&v, stack, nil)
 			break
-		case parser.CommentStmt:
+		case parser.CommentStmt, parser.TestStmt:
+			// 测试由 daglc test 执行，不生成节点
 			continue
 		default:
 			g.reportErrorf(statement, "unknown statement type")
 		}
 	}
-	mainFunc, ok := stack["main"].(parser.FuncStmt)
+	mainFunc, ok := stack.values["main"].(parser.FuncStmt)
 	if !ok {
-		log.Fatalf("main function not found")
+		g.reportErrorf(nil, "main function not found")
 	}
 	if len(mainFunc.Inputs) != 1 {
-		log.Fatalf("main function should have only one input")
+		g.reportErrorf(mainFunc, "main function should have only one input")
+	}
+	stack.define(mainFunc.Inputs[0], 0, "parameter of func main"+at(mainFunc.Pos))
+	g.nameNode(0, mainFunc.Inputs[0], mainFunc.Pos, true)
+	if g.withSource {
+		g.graph.Nodes[0].Source = g.source(mainFunc.Pos)
 	}
-	stack[mainFunc.Inputs[0]] = 0
-	g.newInlineFuncCallNode(&parser.FuncCallStmt{
+	responseID := g.newInlineFuncCallNode(&parser.FuncCallStmt{
 		FuncName: mainFunc.Name,
 		Inputs: []parser.NodeExp{{
 			Type:  parser.NodeExpTypeVar,
 			Value: mainFunc.Inputs[0],
 		}},
 	}, stack, nil)
-	return g.graph
+	// main 函数的最后一个节点即为图的Response
+	g.graph.Nodes[responseID].IsResponse = true
+	g.graph.Optimize(g.optimize)
+	return g.graph, nil
 }
 
 // generateWithDependency generates a node with dependency
@@ -151,6 +349,7 @@ func (g *GFGenerator) generateWithDependency(stmt parser.Statement, stack Stack,
 			Type:     parser.FuncCallTypeBuiltin,
 			FuncName: "identity",
 			Inputs:   []parser.NodeExp{{Type: parser.NodeExpTypeVar, Value: v.Name}},
+			Pos:      v.Pos,
 		}, stack, dependencies)
 	case parser.FuncCallStmt:
 		return g.newFuncCallNode(&v, stack, dependencies)
@@ -180,7 +379,7 @@ func (gf *GFGenerator) newFuncCallNode(stmt *parser.FuncCallStmt, stack Stack, d
 	}
 	node := Node{
 		Type:         nodeType,
-		Args:         make(map[string][]string),
+		Args:         make(Args),
 		Dependencies: dependencies,
 	}
 	// fill inputs
@@ -191,9 +390,9 @@ func (gf *GFGenerator) newFuncCallNode(stmt *parser.FuncCallStmt, stack Stack, d
 			if !ok {
 				gf.reportErrorf(stmt, "invalid input value %v", input.Value)
 			}
-			inputNode, ok := stack[nodeVar].(int)
+			inputNode, ok := stack.values[nodeVar].(int)
 			if !ok {
-				gf.reportErrorf(stmt, "invalid input node %v", input.Value)
+				gf.reportErrorf(stmt, "invalid input node: %s", stack.undefined(nodeVar, symbolVar))
 			}
 			node.Inputs = append(node.Inputs, inputNode)
 			break
@@ -205,43 +404,168 @@ func (gf *GFGenerator) newFuncCallNode(stmt *parser.FuncCallStmt, stack Stack, d
 	// fill args
 	for _, arg := range stmt.Args {
 		switch arg.Value.Type {
-		case parser.StrValTypeConst:
-			v, ok := stack[arg.Value.Value].(string)
-			if !ok {
-				gf.reportErrorf(stmt, "const string not found: %v", arg.Value.Value)
-			}
-			node.Args[arg.Name] = append(node.Args[arg.Name], v)
-			break
-		case parser.StrValTypeLiteral:
-			node.Args[arg.Name] = append(node.Args[arg.Name], arg.Value.Value)
+		case parser.StrValTypeConst, parser.StrValTypeLiteral:
+			node.Args[arg.Name] = append(node.Args[arg.Name], gf.resolveConst(stmt, arg.Value, stack))
 			break
 		default:
 			gf.reportErrorf(stmt, "unknown arg type %v", arg.Value.Type)
 		}
 	}
-	return gf.graph.AddNode(node)
+	if nodeType == "builtin.jq" {
+		gf.checkJqFilters(stmt, stack)
+	}
+	return gf.addNode(node, stmt.Pos)
+}
+
+// addNode adds a node generated at pos in the current scope
+func (gf *GFGenerator) addNode(node Node, pos parser.Pos) int {
+	node.Scope = append([]Scope(nil), gf.scopes...)
+	if gf.withSource {
+		node.Source = gf.source(pos)
+	}
+	id := gf.graph.AddNode(node)
+	// 没有被赋值给变量的节点以任务名命名
+	opName := node.Type
+	if i := strings.Index(opName, "."); i >= 0 {
+		opName = opName[i+1:]
+	}
+	gf.nameNode(id, gf.qualify(opName), pos, false)
+	return id
+}
+
+// nameNode names a node generated at pos. A node assigned to a variable keeps
+// the first variable name, other nodes are named after their op until
+// assigned. The first node of a name is not suffixed, later ones are suffixed
+// with the line of the statement of main generating them, which is the @call
+// for the nodes of inline functions, and a counter if that is taken too.
+func (gf *GFGenerator) nameNode(id int, name string, pos parser.Pos, assigned bool) {
+	node := &gf.graph.Nodes[id]
+	if gf.named[id] || node.Name != "" && !assigned {
+		return
+	}
+	delete(gf.names, node.Name)
+	unique := name
+	if gf.names[unique] {
+		// 后缀是源码的行号，比如重新赋值的变量 input@18，不取决于之前生成了多少个重名的节点。
+		// 多次调用的内联函数中的节点以调用的行号区分，如 lookupCache.cacheKey@8
+		for _, scope := range gf.scopes {
+			if scope.Kind == ScopeCall && !scope.isRoot() {
+				pos = scope.Pos
+				break
+			}
+		}
+		base := name
+		if pos.IsValid() {
+			base = fmt.Sprintf("%s@%d", name, pos.Line)
+		}
+		unique = base
+		for i := 2; gf.names[unique]; i++ {
+			unique = fmt.Sprintf("%s-%d", base, i)
+		}
+	}
+	gf.names[unique] = true
+	node.Name = unique
+	gf.named[id] = assigned
+}
+
+// qualify qualifies a name with the inline functions being expanded
+func (gf *GFGenerator) qualify(name string) string {
+	var names []string
+	for _, scope := range gf.scopes {
+		// main 函数不是由 @call 展开的，不作为限定
+		if scope.Kind == ScopeCall && !scope.isRoot() {
+			names = append(names, scope.Name)
+		}
+	}
+	return strings.Join(append(names, name), ".")
+}
+
+// source returns the source of a node generated at pos in the current scope
+func (gf *GFGenerator) source(pos parser.Pos) *Source {
+	source := &Source{File: gf.sourceFile, Line: pos.Line, Column: pos.Column}
+	for _, scope := range gf.scopes {
+		// main 函数不是由 @call 展开的，没有调用位置
+		if scope.Kind == ScopeCall && !scope.isRoot() {
+			source.CallStack = append(source.CallStack, CallSite{
+				Func:   scope.Name,
+				File:   gf.sourceFile,
+				Line:   scope.Pos.Line,
+				Column: scope.Pos.Column,
+			})
+		}
+	}
+	return source
+}
+
+// pushScope enters a function call or a branch
+func (gf *GFGenerator) pushScope(kind ScopeKind, name string, pos parser.Pos) {
+	gf.scopeID++
+	gf.scopes = append(gf.scopes, Scope{ID: gf.scopeID, Kind: kind, Name: name, Pos: pos})
+}
+
+// popScope leaves the innermost function call or branch
+func (gf *GFGenerator) popScope() {
+	gf.scopes = gf.scopes[:len(gf.scopes)-1]
+}
+
+// currentFunc returns the name of the innermost function being inlined
+func (gf *GFGenerator) currentFunc() string {
+	for i := len(gf.scopes) - 1; i >= 0; i-- {
+		if gf.scopes[i].Kind == ScopeCall {
+			return gf.scopes[i].Name
+		}
+	}
+	return ""
+}
+
+// resolveConst resolves a string value to its literal
+func (gf *GFGenerator) resolveConst(stmt parser.Statement, val parser.StrVal, stack Stack) string {
+	if val.Type == parser.StrValTypeLiteral {
+		return val.Value
+	}
+	v, ok := stack.values[val.Value].(string)
+	if !ok {
+		gf.reportErrorf(stmt, "const string not found: %s", stack.undefined(val.Value, symbolConst))
+	}
+	return v
 }
 
 // newNodeAssignNode creates a new node assign node
 func (gf *GFGenerator) newNodeAssignNode(stmt *parser.NodeAssignStmt, stack Stack, dependencies []int) int {
 	nodeID := gf.newFuncCallNode(&stmt.Value, stack, dependencies)
-	stack[stmt.VarName] = nodeID
+	origin := "variable assigned at top level"
+	if name := gf.currentFunc(); name != "" {
+		origin = "variable assigned in func " + name
+	}
+	origin += at(stmt.Pos)
+	stack.define(stmt.VarName, nodeID, origin)
+	gf.nameNode(nodeID, gf.qualify(stmt.VarName), stmt.Pos, true)
 	return nodeID
 }
 
 // newIfNode creates a new if node
 func (gf *GFGenerator) newIfNode(stmt *parser.IfStmt, stack Stack, dependencies []int) int {
 	var condNodeID int
+	var condName string
 	switch stmt.Cond.Type {
 	case parser.NodeExpTypeVar:
 		var ok bool
-		condNodeID, ok = stack[stmt.Cond.Value.(string)].(int)
+		condNodeID, ok = stack.values[stmt.Cond.Value.(string)].(int)
 		if !ok {
-			gf.reportErrorf(stmt, "invalid cond value of Node Type Var %v", stmt.Cond.Value)
+			gf.reportErrorf(stmt, "invalid cond value of Node Type Var: %s", stack.undefined(stmt.Cond.Value.(string), symbolVar))
 		}
+		condName = stmt.Cond.Value.(string)
 		break
 	case parser.NodeExpTypeFuncCall:
-		condNodeID = gf.newFuncCallNode(stmt.Cond.Value.(*parser.FuncCallStmt), stack, dependencies)
+		var call parser.FuncCallStmt
+		switch v := stmt.Cond.Value.(type) {
+		case parser.FuncCallStmt:
+			call = v
+		case *parser.FuncCallStmt:
+			call = *v
+		}
+		condNodeID = gf.newFuncCallNode(&call, stack, dependencies)
+		condName = call.FuncName + "(...)"
 		break
 	default:
 		gf.reportErrorf(stmt, "unknown cond type %v", stmt.Cond.Type)
@@ -252,45 +576,52 @@ func (gf *GFGenerator) newIfNode(stmt *parser.IfStmt, stack Stack, dependencies
 		return -1
 	}
 	// create when_true node
+	// 外层分支没有执行时，守卫节点也不能执行，所以守卫节点继承外层的依赖
 	trueNode := Node{
-		Type: "builtin.when_true",
+		Type:         "builtin.when_true",
+		Dependencies: dependencies,
 	}
 	trueNode.Inputs = append(trueNode.Inputs, condNodeID)
-	trueNodeID := gf.graph.AddNode(trueNode)
+	trueNodeID := gf.addNode(trueNode, stmt.Pos)
 
 	trueStack := stack.Copy()
 	var trueEndID int
+	gf.pushScope(ScopeTrueBranch, condName, stmt.Pos)
 	for _, statement := range stmt.True {
 		if id := gf.generateWithDependency(statement, trueStack, []int{trueNodeID}); id >= 0 {
 			trueEndID = id
 		}
 	}
+	gf.popScope()
 	if stmt.False != nil {
 		falseNode := Node{
-			Type: "builtin.when_false",
+			Type:         "builtin.when_false",
+			Dependencies: dependencies,
 		}
 		falseNode.Inputs = append(falseNode.Inputs, condNodeID)
-		falseNodeID := gf.graph.AddNode(falseNode)
+		falseNodeID := gf.addNode(falseNode, stmt.Pos)
 		var falseEndID int
+		gf.pushScope(ScopeFalseBranch, condName, stmt.Pos)
 		for _, statement := range stmt.False {
 			if id := gf.generateWithDependency(statement, stack, []int{falseNodeID}); id >= 0 {
 				falseEndID = id
 			}
 		}
+		gf.popScope()
 		anyNode := Node{
 			Type: "builtin.when_any",
 		}
 		anyNode.Inputs = append(anyNode.Inputs, trueEndID, falseEndID)
-		return gf.graph.AddNode(anyNode)
+		return gf.addNode(anyNode, stmt.Pos)
 	} else {
 		return trueEndID
 	}
 }
 
 func (gf *GFGenerator) newInlineFuncCallNode(stmt *parser.FuncCallStmt, stack Stack, dependencies []int) int {
-	funcStmt, ok := stack[stmt.FuncName].(parser.FuncStmt)
+	funcStmt, ok := stack.values[stmt.FuncName].(parser.FuncStmt)
 	if !ok {
-		gf.reportErrorf(stmt, "inline function not found: %v", stmt.FuncName)
+		gf.reportErrorf(stmt, "inline function not found: %s", stack.undefined(stmt.FuncName, symbolFunc))
 		return -1
 	}
 	// create a new stack
@@ -304,11 +635,11 @@ func (gf *GFGenerator) newInlineFuncCallNode(stmt *parser.FuncCallStmt, stack St
 		switch input.Type {
 		case parser.NodeExpTypeVar:
 			nodeVar, ok := input.Value.(string)
-			v, ok := stack[nodeVar].(int)
+			v, ok := stack.values[nodeVar].(int)
 			if !ok {
-				gf.reportErrorf(stmt, "const string not found: %v", nodeVar)
+				gf.reportErrorf(stmt, "invalid input node: %s", stack.undefined(nodeVar, symbolVar))
 			}
-			newStack[funcStmt.Inputs[i]] = v
+			newStack.define(funcStmt.Inputs[i], v, "parameter of func "+funcStmt.Name+at(funcStmt.Pos))
 			break
 		default:
 			gf.reportErrorf(stmt, "unknown input type %v", input.Type)
@@ -318,6 +649,8 @@ func (gf *GFGenerator) newInlineFuncCallNode(stmt *parser.FuncCallStmt, stack St
 		gf.reportErrorf(stmt, "empty function body: %v", stmt.FuncName)
 		return -1
 	}
+	gf.pushScope(ScopeCall, funcStmt.Name, stmt.Pos)
+	defer gf.popScope()
 	var lastNodeID int
 	for _, stmt := range funcStmt.Body {
 		if id := gf.generateWithDependency(stmt, newStack, dependencies); id >= 0 {
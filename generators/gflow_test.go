@@ -1,6 +1,7 @@
 package generators
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -21,8 +22,8 @@ func TestGenerateBuiltinIdentity(t *testing.T) {
 	code := `func main(input) {builtin("identity", [input]);}`
 	expected := &Graph{
 		Nodes: []Node{
-			{Type: "builtin.start"},
-			{Type: "builtin.identity", Inputs: []int{0}, InDegree: 1},
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.identity", Name: "identity", Inputs: []int{0}, InDegree: 1, IsResponse: true},
 		},
 	}
 	testWithCodeAndGraph(t, code, expected)
@@ -41,10 +42,10 @@ func TestGenerateInlineFunc(t *testing.T) {
 	}`
 	expected := &Graph{
 		Nodes: []Node{
-			{Type: "builtin.start"},
-			{Type: "builtin.jq", Inputs: []int{0}, Args: map[string][]string{"filter": {"{\"key\": .key, \"payload\": .payload}"}}, InDegree: 1},
-			{Type: "builtin.jq", Inputs: []int{0, 1}, Args: map[string][]string{"filter": {"{\"key\": .[0], \"payload\": .[1], \"ttl\": 259200000}"}}, InDegree: 2},
-			{Type: "builtin.set_cache", Inputs: []int{2}, Args: map[string][]string{"prefix": {"ime_rec_bert_ner_v1"}}, InDegree: 1},
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.jq", Name: "result", Inputs: []int{0}, Args: map[string][]string{"filter": {"{\"key\": .key, \"payload\": .payload}"}}, InDegree: 1},
+			{Type: "builtin.jq", Name: "setCache.cacheReq", Inputs: []int{0, 1}, Args: map[string][]string{"filter": {"{\"key\": .[0], \"payload\": .[1], \"ttl\": 259200000}"}}, InDegree: 2},
+			{Type: "builtin.set_cache", Name: "setCache.set_cache", Inputs: []int{2}, Args: map[string][]string{"prefix": {"ime_rec_bert_ner_v1"}}, InDegree: 1, IsResponse: true},
 		},
 	}
 	testWithCodeAndGraph(t, code, expected)
@@ -85,20 +86,207 @@ func TestGenerateFullGraph(t *testing.T) {
 `
 	expected := &Graph{
 		Nodes: []Node{
-			{Type: "builtin.start"},
-			{Type: "builtin.jq", Inputs: []int{0}, Args: map[string][]string{"filter": {".payload | fromjson"}}, InDegree: 1},
-			{Type: "builtin.jq", Inputs: []int{1}, Args: map[string][]string{"filter": {".suggestion_type+\"##\"+(.filter_retrievers//[]|join(\"#\"))+\"##\"+(.context//[]|join(\"#\"))+\"##\"+.query"}}, InDegree: 1},
-			{Type: "builtin.lookup_cache", Inputs: []int{2}, Args: map[string][]string{"prefix": {"ime_rec_bert_ner_v1"}}, InDegree: 1},
-			{Type: "builtin.http", Inputs: []int{1}, Args: map[string][]string{"endpoint": {"http://xxxxx.Production/suggestion/"}, "method": {"post"}, "max_retry_times": {"3"}, "default_value": {"{\"actions\":[]}"}, "timeout": {"800ms"}}, InDegree: 1},
-			{Type: "builtin.jq", Inputs: []int{2, 4}, Args: map[string][]string{"filter": {"{\"key\": .[0], \"payload\": .[1], \"ttl\": 259200000}"}}, InDegree: 2},
-			{Type: "builtin.set_cache", Inputs: []int{5}, Args: map[string][]string{"prefix": {"ime_rec_bert_ner_v1"}}, InDegree: 1},
-			{Type: "builtin.jq", Inputs: []int{3}, Args: map[string][]string{"filter": {".found | not"}}, InDegree: 1},
-			{Type: "builtin.when_true", Inputs: []int{7}, InDegree: 1},
-			{Type: "builtin.identity", Inputs: []int{4}, Dependencies: []int{8}, InDegree: 1},
-			{Type: "builtin.when_false", Inputs: []int{7}, InDegree: 1},
-			{Type: "builtin.jq", Inputs: []int{3}, Args: map[string][]string{"filter": {".payload"}}, Dependencies: []int{10}, InDegree: 1},
-			{Type: "builtin.when_any", Inputs: []int{9, 11}, InDegree: 2},
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.jq", Name: "input@16", Inputs: []int{0}, Args: map[string][]string{"filter": {".payload | fromjson"}}, InDegree: 1},
+			{Type: "builtin.jq", Name: "key", Inputs: []int{1}, Args: map[string][]string{"filter": {".suggestion_type+\"##\"+(.filter_retrievers//[]|join(\"#\"))+\"##\"+(.context//[]|join(\"#\"))+\"##\"+.query"}}, InDegree: 1},
+			{Type: "builtin.lookup_cache", Name: "cacheRes", Inputs: []int{2}, Args: map[string][]string{"prefix": {"ime_rec_bert_ner_v1"}}, InDegree: 1},
+			{Type: "builtin.http", Name: "result", Inputs: []int{1}, Args: map[string][]string{"endpoint": {"http://192002625-146479.Production/suggestion/"}, "method": {"post"}, "max_retry_times": {"3"}, "default_value": {"{\"actions\":[]}"}, "timeout": {"800ms"}}, InDegree: 1},
+			{Type: "builtin.jq", Name: "setCache.cacheReq", Inputs: []int{2, 4}, Args: map[string][]string{"filter": {"{\"key\": .[0], \"payload\": .[1], \"ttl\": 259200000}"}}, InDegree: 2},
+			{Type: "builtin.set_cache", Name: "setCache.set_cache", Inputs: []int{5}, Args: map[string][]string{"prefix": {"ime_rec_bert_ner_v1"}}, InDegree: 1},
+			{Type: "builtin.jq", Name: "cacheMiss", Inputs: []int{3}, Args: map[string][]string{"filter": {".found | not"}}, InDegree: 1},
+			{Type: "builtin.when_true", Name: "when_true", Inputs: []int{7}, InDegree: 1},
+			{Type: "builtin.identity", Name: "identity", Inputs: []int{4}, Dependencies: []int{8}, InDegree: 2},
+			{Type: "builtin.when_false", Name: "when_false", Inputs: []int{7}, InDegree: 1},
+			{Type: "builtin.jq", Name: "jq", Inputs: []int{3}, Args: map[string][]string{"filter": {".payload"}}, Dependencies: []int{10}, InDegree: 2},
+			{Type: "builtin.when_any", Name: "when_any", Inputs: []int{9, 11}, InDegree: 2, IsResponse: true},
 		},
 	}
 	testWithCodeAndGraph(t, code, expected)
 }
+
+// TestGenerateConstArg tests the generator's ability to resolve constants in args
+func TestGenerateConstArg(t *testing.T) {
+	code := `
+	@prefix='ime_rec_bert_ner_v1';
+	@cachePrefix=@prefix;
+	func main(input) {
+		builtin("lookup_cache", input, prefix=@cachePrefix);
+	}`
+	expected := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.lookup_cache", Name: "lookup_cache", Inputs: []int{0}, Args: map[string][]string{"prefix": {"ime_rec_bert_ner_v1"}}, InDegree: 1, IsResponse: true},
+		},
+	}
+	testWithCodeAndGraph(t, code, expected)
+}
+
+// TestGenerateIgnoresTests tests that tests of the main function generate no nodes
+func TestGenerateIgnoresTests(t *testing.T) {
+	code := `
+	func main(input) {
+		builtin("lookup_cache", input, prefix='p');
+	}
+	test "miss" {
+		mock lookup_cache = '{"found":false}';
+		expect = @undefined;
+	}`
+	expected := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.lookup_cache", Name: "lookup_cache", Inputs: []int{0}, Args: map[string][]string{"prefix": {"p"}}, InDegree: 1, IsResponse: true},
+		},
+	}
+	testWithCodeAndGraph(t, code, expected)
+}
+
+// TestGenerateSource tests recording the source position and inline call stack of nodes
+func TestGenerateSource(t *testing.T) {
+	code := `inline func lookupCache(key) {
+	builtin("lookup_cache", key, prefix='p');
+}
+inline func cached(key) {
+	@call(lookupCache, [key]);
+}
+func main(input) {
+	cacheRes = @call(cached, [input]);
+	if (cacheRes) {
+		cacheRes;
+	}
+}`
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).WithSource("main.dagl").GenerateGraph()
+	require.Equal(t, &Source{File: "main.dagl", Line: 7, Column: 1}, graph.Nodes[0].Source)
+	require.Equal(t, &Source{File: "main.dagl", Line: 2, Column: 2, CallStack: []CallSite{
+		{Func: "cached", File: "main.dagl", Line: 8, Column: 13},
+		{Func: "lookupCache", File: "main.dagl", Line: 5, Column: 2},
+	}}, graph.Nodes[1].Source)
+	require.Equal(t, "builtin.when_true", graph.Nodes[2].Type)
+	require.Equal(t, &Source{File: "main.dagl", Line: 9, Column: 2}, graph.Nodes[2].Source)
+	require.Equal(t, "builtin.identity", graph.Nodes[3].Type)
+	require.Equal(t, &Source{File: "main.dagl", Line: 10, Column: 3}, graph.Nodes[3].Source)
+	require.Contains(t, string(graph.MarshalToJson()), `"source":{"file":"main.dagl","line":2,"column":2,"call_stack":[{"func":"cached"`)
+
+	// 默认不记录源码位置
+	graph = NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph()
+	require.Nil(t, graph.Nodes[1].Source)
+}
+
+// TestGenerateNodeNames tests naming nodes after variables qualified by inline functions
+func TestGenerateNodeNames(t *testing.T) {
+	code := `
+	inline func lookupCache(key) {
+		cacheKey = builtin("jq", key, filter='.key');
+		builtin("lookup_cache", cacheKey, prefix='p');
+	}
+	func main(input) {
+		cacheRes = @call(lookupCache, [input]);
+		other = @call(lookupCache, [cacheRes]);
+		builtin("jq", [cacheRes, other], filter='.[0]');
+	}`
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph()
+	var names []string
+	for _, node := range graph.Nodes {
+		names = append(names, node.Name)
+	}
+	require.Equal(t, []string{
+		"input",
+		"lookupCache.cacheKey", "cacheRes",
+		"lookupCache.cacheKey@8", "other",
+		"jq",
+	}, names)
+}
+
+// TestGenerateNodeNamesStable tests that reassigned variables are named after their lines
+func TestGenerateNodeNamesStable(t *testing.T) {
+	// names returns the node names by filter
+	names := func(code string) map[string]string {
+		graph := NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph()
+		names := make(map[string]string)
+		for _, node := range graph.Nodes {
+			names[strings.Join(node.Args["filter"], "")] = node.Name
+		}
+		return names
+	}
+	before := names(`
+	func main(input) {
+		input = builtin("jq", input, filter='.payload');
+		a = builtin("jq", input, filter='.a');
+		a = builtin("jq", a, filter='.b');
+	}`)
+	require.Equal(t, map[string]string{"": "input", ".payload": "input@3", ".a": "a", ".b": "a@5"}, before)
+	// 在后面增加节点不改变已有节点的名字
+	after := names(`
+	func main(input) {
+		input = builtin("jq", input, filter='.payload');
+		a = builtin("jq", input, filter='.a');
+		a = builtin("jq", a, filter='.b');
+		a = builtin("jq", a, filter='.c');
+		builtin("jq", [input, a], filter='.d');
+	}`)
+	for filter, name := range before {
+		require.Equal(t, name, after[filter], filter)
+	}
+	require.Equal(t, "a@6", after[".c"])
+
+	// 同一行中重名的节点以出现顺序区分
+	graph := NewGFGenerator(parser.NewParser(`
+	func main(input) {
+		builtin("jq", input, filter='.a');
+		builtin("jq", input, filter='.a'); builtin("jq", input, filter='.a');
+	}`).Parse()).GenerateGraph()
+	require.Equal(t, "jq", graph.Nodes[1].Name)
+	require.Equal(t, "jq@4", graph.Nodes[2].Name)
+	require.Equal(t, "jq@4-2", graph.Nodes[3].Name)
+}
+
+// TestGenerateNestedIf tests that the guards of a nested if statement depend on the enclosing branch
+func TestGenerateNestedIf(t *testing.T) {
+	code := `
+	func main(input) {
+		a = builtin("jq", input, filter='.a');
+		if (input) {
+			if (a) {
+				builtin("jq", input, filter='.b');
+			} else {
+				a;
+			}
+		}
+	}`
+	expected := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.jq", Name: "a", Inputs: []int{0}, Args: map[string][]string{"filter": {".a"}}, InDegree: 1},
+			{Type: "builtin.when_true", Name: "when_true", Inputs: []int{0}, InDegree: 1},
+			{Type: "builtin.when_true", Name: "when_true@5", Inputs: []int{1}, Dependencies: []int{2}, InDegree: 2},
+			{Type: "builtin.jq", Name: "jq", Inputs: []int{0}, Dependencies: []int{3}, Args: map[string][]string{"filter": {".b"}}, InDegree: 2},
+			{Type: "builtin.when_false", Name: "when_false", Inputs: []int{1}, Dependencies: []int{2}, InDegree: 2},
+			{Type: "builtin.identity", Name: "identity", Inputs: []int{1}, Dependencies: []int{5}, InDegree: 2},
+			{Type: "builtin.when_any", Name: "when_any", Inputs: []int{4, 6}, InDegree: 2, IsResponse: true},
+		},
+	}
+	testWithCodeAndGraph(t, code, expected)
+}
+
+// TestGenerateErrors tests returning generator errors with their positions
+func TestGenerateErrors(t *testing.T) {
+	for _, c := range []struct {
+		code string
+		err  string
+	}{
+		{"func main(input) {\n  builtin(\"jq\", cachRes, filter='.a');\n}", `2:3: invalid input node: undefined variable "cachRes"`},
+		{"func main(input) {\n  @call(lookup, [input]);\n}", `2:3: inline function not found: undefined inline function "lookup"`},
+		{"inline func f(a) {\n  builtin(\"jq\", a, prefix=@prefix);\n}\nfunc main(input) {\n  @call(f, [input]);\n}", `2:3: const string not found: undefined constant "prefix"`},
+		{"func other(input) {\n  input;\n}", "main function not found"},
+		{"func main(a, b) {\n  a;\n}", "1:1: main function should have only one input"},
+	} {
+		_, err := NewGFGenerator(parser.NewParser(c.code).Parse()).Generate()
+		require.EqualError(t, err, c.err, c.code)
+	}
+}
+
+// TestNodeUpstreams tests that the upstreams of a node are deduplicated, inputs first
+func TestNodeUpstreams(t *testing.T) {
+	node := &Node{Inputs: []int{3, 1, 3}, Dependencies: []int{2, 1}}
+	require.Equal(t, []int{3, 1, 2}, node.Upstreams())
+	require.Empty(t, (&Node{}).Upstreams())
+}
@@ -0,0 +1,54 @@
+package generators
+
+import (
+	"github.com/vuuihc/gfc/jq"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// checkJqFilters parses the filter args of a builtin.jq call. A call with
+// several inputs gets them as an array, so the filter can only index them
+// with .[0] through .[n-1].
+func (gf *GFGenerator) checkJqFilters(stmt *parser.FuncCallStmt, stack Stack) {
+	for _, arg := range stmt.Args {
+		if arg.Name != "filter" {
+			continue
+		}
+		filter := gf.resolveConst(stmt, arg.Value, stack)
+		pos, used := arg.Value.Pos, ""
+		if arg.Value.Type == parser.StrValTypeConst {
+			// 错误报告在常量的字符串中
+			pos, used = gf.constPos[arg.Value.Value], " (filter @"+arg.Value.Value+" used"+at(arg.Value.Pos)+")"
+		}
+		q, err := jq.Parse(filter)
+		if err != nil {
+			e := err.(*jq.Error)
+			gf.reportErrorAt(stmt, stringPos(pos, filter, e.Offset), "invalid jq filter: %s%s", e.Msg, used)
+		}
+		if n := len(stmt.Inputs); n > 1 {
+			for _, index := range q.InputIndexes() {
+				if index.Index >= n || index.Index < -n {
+					gf.reportErrorAt(stmt, stringPos(pos, filter, index.Offset), "jq filter indexes .[%d] of %d inputs%s", index.Index, n, used)
+				}
+			}
+		}
+	}
+}
+
+// stringPos returns the position of a byte offset in the content of a string
+// literal at pos. Strings have no escapes, so the content is the source text.
+func stringPos(pos parser.Pos, content string, offset int) parser.Pos {
+	if !pos.IsValid() {
+		return pos
+	}
+	// 跳过开头的引号
+	pos.Column++
+	for i := 0; i < offset && i < len(content); i++ {
+		if content[i] == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
@@ -0,0 +1,46 @@
+package generators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// TestGenerateJqFilters tests reporting invalid jq filters at their positions in the strings
+func TestGenerateJqFilters(t *testing.T) {
+	for _, c := range []struct {
+		code string
+		err  string
+	}{
+		{"func main(input) {\n  builtin(\"jq\", input, filter='.a |');\n}", "2:36: invalid jq filter: unexpected end of filter"},
+		{"func main(input) {\n  builtin(\"jq\", input, filter=`.a\n  | joni(\",\")`);\n}", "3:5: invalid jq filter: joni/1 is not defined"},
+		{
+			"func main(input) {\n  a = builtin(\"identity\", input);\n  builtin(\"jq\", [input, a], filter='{\"key\": .[0], \"payload\": .[2]}');\n}",
+			"3:62: jq filter indexes .[2] of 2 inputs",
+		},
+		{
+			"func main(input) {\n  a = builtin(\"identity\", input);\n  builtin(\"jq\", [input, a], filter='.[-3]');\n}",
+			"3:37: jq filter indexes .[-3] of 2 inputs",
+		},
+		{
+			"@f = `.[0]`;\n@g = @f;\ninline func f(a, b) {\n  builtin(\"jq\", [a, b, b], filter='.[1]');\n  builtin(\"jq\", [a, b], filter=@g);\n  builtin(\"jq\", a, filter=@g);\n}\nfunc main(input) {\n  @call(f, [input, input]);\n}",
+			"",
+		},
+		{
+			"@f = `.[0] + .[1] | .[2]`;\n@g = `.[1] + .[2]`;\nfunc main(input) {\n  a = builtin(\"jq\", [input, input], filter=@f);\n  builtin(\"jq\", [input, a], filter=@g);\n}",
+			"2:14: jq filter indexes .[2] of 2 inputs (filter @g used at 5:37)",
+		},
+		{
+			"@f = `{`;\nfunc main(input) {\n  builtin(\"jq\", input, filter=@f);\n}",
+			"1:8: invalid jq filter: unexpected end of filter in object (filter @f used at 3:32)",
+		},
+	} {
+		_, err := NewGFGenerator(parser.NewParser(c.code).Parse()).Generate()
+		if c.err == "" {
+			require.NoError(t, err, c.code)
+			continue
+		}
+		require.EqualError(t, err, c.err, c.code)
+	}
+}
@@ -0,0 +1,102 @@
+package generators
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// mermaidShapes 是分支相关节点在Mermaid中的形状，%s 为节点标签
+var mermaidShapes = map[string]string{
+	"builtin.start":      `(["%s"])`,
+	"builtin.when_true":  `{"%s"}`,
+	"builtin.when_false": `{{"%s"}}`,
+	"builtin.when_any":   `[/"%s"\]`,
+}
+
+// mermaidCluster is a subgraph of the nodes generated in a scope
+type mermaidCluster struct {
+	scope    Scope
+	nodes    []int
+	children []*mermaidCluster
+}
+
+// child returns the subgraph of a nested scope, creating it on first use
+func (c *mermaidCluster) child(scope Scope) *mermaidCluster {
+	for _, child := range c.children {
+		if child.scope.ID == scope.ID {
+			return child
+		}
+	}
+	child := &mermaidCluster{scope: scope}
+	c.children = append(c.children, child)
+	return child
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart. Nodes generated by
+// the same inlined function call or if branch are clustered in a subgraph,
+// the nodes of main are not. Scopes are not serialized, so graphs loaded from
+// json or msgpack are written without subgraphs.
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	root := &mermaidCluster{}
+	for id := range g.Nodes {
+		cluster := root
+		for _, scope := range g.Nodes[id].Scope {
+			// main 函数的节点在最外层，不放进子图
+			if scope.isRoot() {
+				continue
+			}
+			cluster = cluster.child(scope)
+		}
+		cluster.nodes = append(cluster.nodes, id)
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "flowchart TD")
+	g.writeMermaidCluster(bw, root, "    ")
+	var responses []string
+	for id := range g.Nodes {
+		node := &g.Nodes[id]
+		for i, input := range node.Inputs {
+			if len(node.Inputs) > 1 {
+				fmt.Fprintf(bw, "    n%d -->|%d| n%d\n", input, i, id)
+			} else {
+				fmt.Fprintf(bw, "    n%d --> n%d\n", input, id)
+			}
+		}
+		for _, dependency := range node.Dependencies {
+			fmt.Fprintf(bw, "    n%d -.-> n%d\n", dependency, id)
+		}
+		if node.IsResponse {
+			responses = append(responses, fmt.Sprintf("n%d", id))
+		}
+	}
+	if len(responses) > 0 {
+		fmt.Fprintln(bw, "    classDef response stroke-width:3px,fill:#ffd")
+		fmt.Fprintf(bw, "    class %s response\n", strings.Join(responses, ","))
+	}
+	return bw.Flush()
+}
+
+// writeMermaidCluster writes the nodes of a cluster and its nested subgraphs
+func (g *Graph) writeMermaidCluster(w io.Writer, cluster *mermaidCluster, indent string) {
+	for _, id := range cluster.nodes {
+		shape, ok := mermaidShapes[g.Nodes[id].Type]
+		if !ok {
+			shape = `["%s"]`
+		}
+		label := mermaidEscape(nodeLabel(id, &g.Nodes[id]))
+		fmt.Fprintf(w, "%sn%d%s\n", indent, id, fmt.Sprintf(shape, label))
+	}
+	for _, child := range cluster.children {
+		fmt.Fprintf(w, "%ssubgraph s%d [\"%s\"]\n", indent, child.scope.ID, mermaidEscape(child.scope.String()))
+		g.writeMermaidCluster(w, child, indent+"    ")
+		fmt.Fprintf(w, "%send\n", indent)
+	}
+}
+
+// mermaidEscape escapes a label for a quoted Mermaid string
+func mermaidEscape(s string) string {
+	r := strings.NewReplacer("#", "#35;", `"`, "#quot;", "<", "#lt;", ">", "#gt;", "\n", "<br/>")
+	return r.Replace(s)
+}
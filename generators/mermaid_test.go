@@ -0,0 +1,105 @@
+package generators
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// TestWriteMermaid tests clustering nodes by inlined function call and if branch
+func TestWriteMermaid(t *testing.T) {
+	code := `
+	inline func lookupCache(key){
+		builtin("lookup_cache", key, prefix='p');
+	}
+	func main(input) {
+		cacheRes=@call(lookupCache, [input]);
+		cacheMiss=builtin("jq", cacheRes, filter='.found | not');
+		if(cacheMiss){
+			builtin("http", [input, cacheRes], endpoint="http://localhost/");
+		}else{
+			@call(lookupCache, [cacheRes]);
+		}
+	}`
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph()
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteMermaid(&buf))
+	expected := `flowchart TD
+    n0(["0: input = builtin.start"])
+    n2["2: cacheMiss = builtin.jq<br/>filter=.found | not"]
+    n3{"3: when_true = builtin.when_true"}
+    n5{{"5: when_false = builtin.when_false"}}
+    n7[/"7: when_any = builtin.when_any"\]
+    subgraph s2 ["@call lookupCache"]
+        n1["1: cacheRes = builtin.lookup_cache<br/>prefix=p"]
+    end
+    subgraph s3 ["if cacheMiss"]
+        n4["4: http = builtin.http<br/>endpoint=http://localhost/"]
+    end
+    subgraph s4 ["else cacheMiss"]
+        subgraph s5 ["@call lookupCache"]
+            n6["6: lookupCache.lookup_cache = builtin.lookup_cache<br/>prefix=p"]
+        end
+    end
+    n0 --> n1
+    n1 --> n2
+    n2 --> n3
+    n0 -->|0| n4
+    n1 -->|1| n4
+    n3 -.-> n4
+    n2 --> n5
+    n1 --> n6
+    n5 -.-> n6
+    n4 -->|0| n7
+    n6 -->|1| n7
+    classDef response stroke-width:3px,fill:#ffd
+    class n7 response
+`
+	require.Equal(t, expected, buf.String())
+}
+
+// TestWriteMermaidMainOnly tests that the nodes of main are not put in a subgraph
+func TestWriteMermaidMainOnly(t *testing.T) {
+	code := `func main(input) { builtin("jq", input, filter='.a'); }`
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph()
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteMermaid(&buf))
+	require.Equal(t, `flowchart TD
+    n0(["0: input = builtin.start"])
+    n1["1: jq = builtin.jq<br/>filter=.a"]
+    n0 --> n1
+    classDef response stroke-width:3px,fill:#ffd
+    class n1 response
+`, buf.String())
+}
+
+// TestWriteMermaidLoaded tests that graphs loaded from json are not clustered
+func TestWriteMermaidLoaded(t *testing.T) {
+	code := `
+	inline func lookupCache(key){
+		builtin("lookup_cache", key, prefix='p');
+	}
+	func main(input) {
+		@call(lookupCache, [input]);
+	}`
+	data, err := NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph().EncodeJSON()
+	require.NoError(t, err)
+	graph, err := UnmarshalGraphJSON(data)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteMermaid(&buf))
+	require.Equal(t, `flowchart TD
+    n0(["0: input = builtin.start"])
+    n1["1: lookupCache.lookup_cache = builtin.lookup_cache<br/>prefix=p"]
+    n0 --> n1
+    classDef response stroke-width:3px,fill:#ffd
+    class n1 response
+`, buf.String())
+}
+
+// TestMermaidEscape tests escaping labels
+func TestMermaidEscape(t *testing.T) {
+	require.Equal(t, "filter={#quot;a#quot;: .[0]} #35;x<br/>#lt;b#gt;", mermaidEscape("filter={\"a\": .[0]} #x\n<b>"))
+}
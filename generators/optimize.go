@@ -0,0 +1,413 @@
+package generators
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PureOps 是没有副作用的节点类型。这些节点的输出如果没有被使用，就可以被删除。
+// 不在列表中的节点类型一律视为有副作用。
+var PureOps = map[string]bool{
+	"builtin.start":      true,
+	"builtin.identity":   true,
+	"builtin.jq":         true,
+	"builtin.when_true":  true,
+	"builtin.when_false": true,
+	"builtin.when_any":   true,
+}
+
+// OptimizeOptions switches the optimization passes applied to a graph
+type OptimizeOptions struct {
+	// EliminateDeadNodes 删除Response和有副作用的节点都不依赖的节点
+	EliminateDeadNodes bool
+	// EliminateCommonSubexpressions 合并重复执行相同计算的无副作用节点
+	EliminateCommonSubexpressions bool
+	// FuseJqNodes 把只有一个消费者的jq节点合并到它的消费者中
+	FuseJqNodes bool
+	// EliminateIdentityNodes 删除消费者可以直接引用其输入的builtin.identity节点。
+	// 分支中引用共享的或者有副作用的节点时(比如README示例中http节点的 result;)，
+	// 分支守卫无处可移，identity节点会保留
+	EliminateIdentityNodes bool
+}
+
+// Optimize applies the enabled optimization passes to the graph. The passes
+// expect a graph passing Validate: they don't panic on references out of
+// range, but drop them or leave the graph as it is.
+func (g *Graph) Optimize(opts OptimizeOptions) {
+	if opts.EliminateCommonSubexpressions {
+		g.EliminateCommonSubexpressions()
+	}
+	if opts.EliminateIdentityNodes {
+		g.EliminateIdentityNodes()
+	}
+	if opts.FuseJqNodes {
+		g.FuseJqNodes()
+	}
+	if opts.EliminateDeadNodes {
+		g.EliminateDeadNodes()
+	}
+}
+
+// EliminateDeadNodes removes the nodes that neither the response node nor
+// any side-effecting node depends on
+func (g *Graph) EliminateDeadNodes() {
+	live := make([]bool, len(g.Nodes))
+	var queue []int
+	mark := func(id int) {
+		if id >= 0 && id < len(g.Nodes) && !live[id] {
+			live[id] = true
+			queue = append(queue, id)
+		}
+	}
+	for id, node := range g.Nodes {
+		// builtin.start 是图的入口，始终保留
+		if id == 0 || node.IsResponse || !PureOps[node.Type] {
+			mark(id)
+		}
+	}
+	for len(queue) > 0 {
+		node := g.Nodes[queue[0]]
+		queue = queue[1:]
+		for _, input := range node.Inputs {
+			mark(input)
+		}
+		for _, dependency := range node.Dependencies {
+			mark(dependency)
+		}
+	}
+	g.compact(live)
+}
+
+// compact removes the nodes not kept, renumbers Inputs and Dependencies and
+// recomputes InDegree. References to removed nodes and references out of
+// range are dropped, so callers must redirect them to kept nodes first.
+func (g *Graph) compact(keep []bool) {
+	offsets := make([]int, len(g.Nodes))
+	nodes := make([]Node, 0, len(g.Nodes))
+	for id, node := range g.Nodes {
+		offsets[id] = -1
+		if keep[id] {
+			offsets[id] = len(nodes)
+			nodes = append(nodes, node)
+		}
+	}
+	renumber := func(ids []int) []int {
+		var renumbered []int
+		for _, id := range ids {
+			if id >= 0 && id < len(offsets) && offsets[id] >= 0 {
+				renumbered = append(renumbered, offsets[id])
+			}
+		}
+		return renumbered
+	}
+	for i := range nodes {
+		nodes[i].Inputs = renumber(nodes[i].Inputs)
+		nodes[i].Dependencies = renumber(nodes[i].Dependencies)
+		nodes[i].InDegree = inDegree(&nodes[i])
+	}
+	g.Nodes = nodes
+}
+
+// EliminateCommonSubexpressions merges pure nodes with identical Type, Args,
+// Inputs and Dependencies into the first of them
+func (g *Graph) EliminateCommonSubexpressions() {
+	order, err := g.topoOrder()
+	if err != nil {
+		return
+	}
+	replace := make([]int, len(g.Nodes))
+	keep := make([]bool, len(g.Nodes))
+	for id := range g.Nodes {
+		replace[id] = id
+		keep[id] = true
+	}
+	seen := make(map[string]int)
+	for _, id := range order {
+		node := &g.Nodes[id]
+		// 拓扑序保证输入节点已经被替换过
+		for i, input := range node.Inputs {
+			node.Inputs[i] = replace[input]
+		}
+		for i, dependency := range node.Dependencies {
+			node.Dependencies[i] = replace[dependency]
+		}
+		if id == 0 || !PureOps[node.Type] {
+			continue
+		}
+		key := nodeKey(node)
+		if first, ok := seen[key]; ok {
+			replace[id] = first
+			keep[id] = false
+			if node.IsResponse {
+				g.Nodes[first].IsResponse = true
+			}
+			continue
+		}
+		seen[key] = id
+	}
+	g.compact(keep)
+}
+
+// nodeKey returns a key identifying the computation of a node
+func nodeKey(node *Node) string {
+	dependencies := append([]int(nil), node.Dependencies...)
+	sort.Ints(dependencies)
+	key, _ := json.Marshal(struct {
+		Type         string
+		Args         map[string][]string
+		Inputs       []int
+		Dependencies []int
+	}{node.Type, node.Args, node.Inputs, dependencies})
+	return string(key)
+}
+
+// topoOrder returns the node offsets in topological order
+func (g *Graph) topoOrder() ([]int, error) {
+	degrees := make([]int, len(g.Nodes))
+	consumers := make([][]int, len(g.Nodes))
+	for id, node := range g.Nodes {
+		for _, upstream := range node.Upstreams() {
+			if upstream < 0 || upstream >= len(g.Nodes) {
+				return nil, fmt.Errorf("node %d: reference %d out of range", id, upstream)
+			}
+			degrees[id]++
+			consumers[upstream] = append(consumers[upstream], id)
+		}
+	}
+	var order []int
+	for id, degree := range degrees {
+		if degree == 0 {
+			order = append(order, id)
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		for _, consumer := range consumers[order[i]] {
+			if degrees[consumer]--; degrees[consumer] == 0 {
+				order = append(order, consumer)
+			}
+		}
+	}
+	if len(order) != len(g.Nodes) {
+		var cycle []int
+		for id, degree := range degrees {
+			if degree > 0 {
+				cycle = append(cycle, id)
+			}
+		}
+		return nil, fmt.Errorf("graph has a cycle through nodes %v", cycle)
+	}
+	return order, nil
+}
+
+// FuseJqNodes merges a builtin.jq node into the builtin.jq node consuming it
+// by composing their filters, when nothing else uses the intermediate value
+func (g *Graph) FuseJqNodes() {
+	order, err := g.topoOrder()
+	if err != nil {
+		return
+	}
+	keep := make([]bool, len(g.Nodes))
+	for id := range keep {
+		keep[id] = true
+	}
+	for fused := true; fused; {
+		fused = false
+		references := g.countReferences()
+		for _, id := range order {
+			if !keep[id] || !isFusableJq(&g.Nodes[id]) {
+				continue
+			}
+			for position, input := range g.Nodes[id].Inputs {
+				producer := &g.Nodes[input]
+				if references[input] != 1 || producer.IsResponse || len(producer.Inputs) == 0 || !isFusableJq(producer) {
+					continue
+				}
+				g.fuseJq(producer, &g.Nodes[id], position)
+				keep[input] = false
+				fused = true
+				break
+			}
+			if fused {
+				break
+			}
+		}
+	}
+	g.compact(keep)
+}
+
+// isFusableJq checks if a node is a builtin.jq node with a single filter arg
+func isFusableJq(node *Node) bool {
+	return node.Type == "builtin.jq" && len(node.Args) == 1 && len(node.Args["filter"]) == 1
+}
+
+// countReferences counts how many times each node is used as input or
+// dependency, skipping references out of range
+func (g *Graph) countReferences() []int {
+	references := make([]int, len(g.Nodes))
+	for _, node := range g.Nodes {
+		for _, list := range [][]int{node.Inputs, node.Dependencies} {
+			for _, id := range list {
+				if id >= 0 && id < len(references) {
+					references[id]++
+				}
+			}
+		}
+	}
+	return references
+}
+
+// fuseJq merges the producer into the consumer, which uses it as the input at position.
+// 单输入时节点收到的是输入本身，多输入时收到的是输入组成的json array。
+func (g *Graph) fuseJq(producer, consumer *Node, position int) {
+	producerFilter := producer.Args["filter"][0]
+	consumerFilter := consumer.Args["filter"][0]
+	var inputs []int
+	var filter string
+	if len(consumer.Inputs) == 1 {
+		inputs = append(inputs, producer.Inputs...)
+		filter = fmt.Sprintf("(%s) | (%s)", producerFilter, consumerFilter)
+	} else {
+		offsets := make(map[int]int)
+		offsetOf := func(id int) int {
+			if _, ok := offsets[id]; !ok {
+				offsets[id] = len(inputs)
+				inputs = append(inputs, id)
+			}
+			return offsets[id]
+		}
+		// 先确定合并后的输入，再生成取输入的表达式
+		elements := make([][]int, len(consumer.Inputs))
+		for i, id := range consumer.Inputs {
+			if i != position {
+				elements[i] = []int{offsetOf(id)}
+				continue
+			}
+			for _, producerInput := range producer.Inputs {
+				elements[i] = append(elements[i], offsetOf(producerInput))
+			}
+		}
+		ref := func(offset int) string {
+			if len(inputs) == 1 {
+				return "."
+			}
+			return fmt.Sprintf(".[%d]", offset)
+		}
+		exps := make([]string, len(elements))
+		for i, offsets := range elements {
+			switch {
+			case i != position:
+				exps[i] = ref(offsets[0])
+			case len(offsets) == 1:
+				exps[i] = fmt.Sprintf("(%s | %s)", ref(offsets[0]), producerFilter)
+			default:
+				refs := make([]string, len(offsets))
+				for j, offset := range offsets {
+					refs[j] = ref(offset)
+				}
+				exps[i] = fmt.Sprintf("([%s] | %s)", strings.Join(refs, ", "), producerFilter)
+			}
+		}
+		filter = fmt.Sprintf("[%s] | (%s)", strings.Join(exps, ", "), consumerFilter)
+	}
+	consumer.Inputs = inputs
+	consumer.Args = map[string][]string{"filter": {filter}}
+	consumer.Dependencies = unionInts(consumer.Dependencies, producer.Dependencies)
+}
+
+// unionInts returns the deduplicated union of two lists, keeping the order
+func unionInts(a, b []int) []int {
+	var union []int
+	seen := make(map[int]bool)
+	for _, list := range [][]int{a, b} {
+		for _, id := range list {
+			if !seen[id] {
+				seen[id] = true
+				union = append(union, id)
+			}
+		}
+	}
+	return union
+}
+
+// EliminateIdentityNodes removes builtin.identity nodes and lets their consumers
+// reference the input directly. An identity node guarded by a branch is only
+// removed when its input is guarded by the same branch already, or when the
+// input is a pure node used by nothing else, so the guard can move onto it.
+// 这样when_any仍然只会收到被选中分支的输出。Identity nodes over shared or
+// side-effecting inputs in a branch, like result; over an http node also
+// written to the cache, are kept: guarding the input would change what runs.
+func (g *Graph) EliminateIdentityNodes() {
+	keep := make([]bool, len(g.Nodes))
+	for id := range keep {
+		keep[id] = true
+	}
+	for removed := true; removed; {
+		removed = false
+		references := g.countReferences()
+		for id := range g.Nodes {
+			identity := &g.Nodes[id]
+			if !keep[id] || identity.Type != "builtin.identity" || len(identity.Args) > 0 || len(identity.Inputs) != 1 {
+				continue
+			}
+			inputID := identity.Inputs[0]
+			if inputID < 0 || inputID >= len(g.Nodes) {
+				continue
+			}
+			input := &g.Nodes[inputID]
+			if !containsAll(input.Dependencies, identity.Dependencies) {
+				if references[inputID] != 1 || inputID == 0 || input.IsResponse || !PureOps[input.Type] {
+					continue
+				}
+				input.Dependencies = unionInts(input.Dependencies, identity.Dependencies)
+			}
+			if identity.IsResponse {
+				input.IsResponse = true
+			}
+			g.redirect(id, inputID)
+			keep[id] = false
+			removed = true
+			break
+		}
+	}
+	g.compact(keep)
+}
+
+// redirect replaces all references to a node with another node
+func (g *Graph) redirect(from, to int) {
+	for i := range g.Nodes {
+		node := &g.Nodes[i]
+		for j, id := range node.Inputs {
+			if id == from {
+				node.Inputs[j] = to
+			}
+		}
+		// 依赖的值不传递给节点，去重不影响执行
+		var dependencies []int
+		for _, id := range node.Dependencies {
+			if id == from {
+				id = to
+			}
+			dependencies = append(dependencies, id)
+		}
+		node.Dependencies = unionInts(dependencies, nil)
+	}
+}
+
+// containsAll checks if list contains every element of elements
+func containsAll(list, elements []int) bool {
+	for _, e := range elements {
+		found := false
+		for _, id := range list {
+			if id == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,235 @@
+package generators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// testOptimizeWithCodeAndGraph generates an optimized graph and compares it with the expected one
+func testOptimizeWithCodeAndGraph(t *testing.T, code string, opts OptimizeOptions, expected *Graph) {
+	statements := parser.NewParser(code).Parse()
+	graph := NewGFGenerator(statements).WithOptimizeOptions(opts).GenerateGraph()
+	require.Equal(t, expected.MarshalToJson(), graph.MarshalToJson(), "expected %s \nactual %s \n", expected.MarshalToJson(), graph.MarshalToJson())
+}
+
+// TestEliminateDeadNodes tests removing nodes that nothing consumes
+func TestEliminateDeadNodes(t *testing.T) {
+	code := `
+	func main(input) {
+		unused=builtin("jq", input, filter='.unused');
+		payload=builtin("jq", input, filter='.payload');
+		builtin("set_cache", payload, prefix='p');
+		alsoUnused=builtin("jq", unused, filter='.a');
+		builtin("jq", payload, filter='.key');
+	}`
+	expected := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.jq", Name: "payload", Inputs: []int{0}, Args: map[string][]string{"filter": {".payload"}}, InDegree: 1},
+			{Type: "builtin.set_cache", Name: "set_cache", Inputs: []int{1}, Args: map[string][]string{"prefix": {"p"}}, InDegree: 1},
+			{Type: "builtin.jq", Name: "jq", Inputs: []int{1}, Args: map[string][]string{"filter": {".key"}}, InDegree: 1, IsResponse: true},
+		},
+	}
+	testOptimizeWithCodeAndGraph(t, code, OptimizeOptions{EliminateDeadNodes: true}, expected)
+}
+
+// TestEliminateDeadNodesKeepsBranches tests that guards of live branch nodes are kept
+func TestEliminateDeadNodesKeepsBranches(t *testing.T) {
+	code := `
+	func main(input) {
+		cond=builtin("jq", input, filter='.found');
+		if(cond){
+			builtin("jq", input, filter='.payload');
+			builtin("jq", input, filter='.unused');
+		}
+	}`
+	expected := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.jq", Name: "cond", Inputs: []int{0}, Args: map[string][]string{"filter": {".found"}}, InDegree: 1},
+			{Type: "builtin.when_true", Name: "when_true", Inputs: []int{1}, InDegree: 1},
+			// 分支的最后一个节点是Response，第一个节点没有被使用
+			{Type: "builtin.jq", Name: "jq@6", Inputs: []int{0}, Args: map[string][]string{"filter": {".unused"}}, Dependencies: []int{2}, InDegree: 2, IsResponse: true},
+		},
+	}
+	testOptimizeWithCodeAndGraph(t, code, OptimizeOptions{EliminateDeadNodes: true}, expected)
+
+	// 关闭优化时不删除节点
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph()
+	require.Len(t, graph.Nodes, 5)
+}
+
+// TestEliminateCommonSubexpressions tests merging duplicate pure nodes
+func TestEliminateCommonSubexpressions(t *testing.T) {
+	code := `
+	inline func getCacheKey(input) {
+		builtin("jq", input, filter='.query');
+	}
+	func main(input) {
+		key=@call(getCacheKey, [input]);
+		cacheRes=builtin("lookup_cache", key, prefix='p');
+		sameKey=@call(getCacheKey, [input]);
+		builtin("set_cache", [sameKey, cacheRes], prefix='p');
+		builtin("set_cache", [sameKey, cacheRes], prefix='p');
+		builtin("jq", [key, cacheRes], filter='.[1]');
+	}`
+	expected := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.jq", Name: "key", Inputs: []int{0}, Args: map[string][]string{"filter": {".query"}}, InDegree: 1},
+			{Type: "builtin.lookup_cache", Name: "cacheRes", Inputs: []int{1}, Args: map[string][]string{"prefix": {"p"}}, InDegree: 1},
+			// set_cache 有副作用，不会被合并
+			{Type: "builtin.set_cache", Name: "set_cache", Inputs: []int{1, 2}, Args: map[string][]string{"prefix": {"p"}}, InDegree: 2},
+			{Type: "builtin.set_cache", Name: "set_cache@10", Inputs: []int{1, 2}, Args: map[string][]string{"prefix": {"p"}}, InDegree: 2},
+			{Type: "builtin.jq", Name: "jq", Inputs: []int{1, 2}, Args: map[string][]string{"filter": {".[1]"}}, InDegree: 2, IsResponse: true},
+		},
+	}
+	testOptimizeWithCodeAndGraph(t, code, OptimizeOptions{EliminateCommonSubexpressions: true}, expected)
+}
+
+// TestEliminateCommonSubexpressionsInBranches tests that nodes guarded by different branches are not merged
+func TestEliminateCommonSubexpressionsInBranches(t *testing.T) {
+	code := `
+	func main(input) {
+		cond=builtin("jq", input, filter='.found');
+		if(cond){
+			builtin("jq", input, filter='.payload');
+		}else{
+			builtin("jq", input, filter='.payload');
+		}
+	}`
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).
+		WithOptimizeOptions(OptimizeOptions{EliminateCommonSubexpressions: true}).
+		GenerateGraph()
+	require.Len(t, graph.Nodes, 7)
+}
+
+// TestFuseJqNodes tests composing the filters of a chain of jq nodes
+func TestFuseJqNodes(t *testing.T) {
+	code := `
+	func main(input) {
+		input=builtin("jq", input, filter='.payload | fromjson');
+		query=builtin("jq", input, filter='.query');
+		builtin("jq", query, filter='ascii_downcase');
+	}`
+	expected := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.jq", Name: "jq", Inputs: []int{0}, Args: map[string][]string{"filter": {"((.payload | fromjson) | (.query)) | (ascii_downcase)"}}, InDegree: 1, IsResponse: true},
+		},
+	}
+	testOptimizeWithCodeAndGraph(t, code, OptimizeOptions{FuseJqNodes: true}, expected)
+}
+
+// TestFuseJqNodesWithMultipleInputs tests fusing jq nodes into a jq node with multiple inputs
+func TestFuseJqNodesWithMultipleInputs(t *testing.T) {
+	code := `
+	func main(input) {
+		key=builtin("jq", input, filter='.key');
+		result=builtin("http", input, endpoint='http://localhost/');
+		cacheReq=builtin("jq", [key, result], filter='{"key": .[0], "payload": .[1]}');
+		builtin("set_cache", cacheReq, prefix='p');
+		query=builtin("jq", input, filter='.query');
+		builtin("jq", [input, query], filter='.[0].id + .[1]');
+	}`
+	expected := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.http", Name: "result", Inputs: []int{0}, Args: map[string][]string{"endpoint": {"http://localhost/"}}, InDegree: 1},
+			{Type: "builtin.jq", Name: "cacheReq", Inputs: []int{0, 1}, Args: map[string][]string{"filter": {`[(.[0] | .key), .[1]] | ({"key": .[0], "payload": .[1]})`}}, InDegree: 2},
+			{Type: "builtin.set_cache", Name: "set_cache", Inputs: []int{2}, Args: map[string][]string{"prefix": {"p"}}, InDegree: 1},
+			// 两个输入来自同一个节点，合并后只剩一个输入
+			{Type: "builtin.jq", Name: "jq", Inputs: []int{0}, Args: map[string][]string{"filter": {"[., (. | .query)] | (.[0].id + .[1])"}}, InDegree: 1, IsResponse: true},
+		},
+	}
+	testOptimizeWithCodeAndGraph(t, code, OptimizeOptions{FuseJqNodes: true}, expected)
+}
+
+// TestFuseJqNodesKeepsSharedValues tests that jq nodes used by several nodes are not fused
+func TestFuseJqNodesKeepsSharedValues(t *testing.T) {
+	code := `
+	func main(input) {
+		input=builtin("jq", input, filter='.payload | fromjson');
+		builtin("http", input, endpoint='http://localhost/');
+		builtin("jq", input, filter='.query');
+	}`
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).
+		WithOptimizeOptions(OptimizeOptions{FuseJqNodes: true}).
+		GenerateGraph()
+	require.Len(t, graph.Nodes, 4)
+}
+
+// TestEliminateIdentityNodes tests removing identity nodes in branches
+func TestEliminateIdentityNodes(t *testing.T) {
+	code := `
+	func main(input) {
+		cond=builtin("jq", input, filter='.found');
+		fallback=builtin("jq", input, filter='.fallback');
+		if(cond){
+			payload=builtin("jq", input, filter='.payload');
+			payload;
+		}else{
+			fallback;
+		}
+	}`
+	expected := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.jq", Name: "cond", Inputs: []int{0}, Args: map[string][]string{"filter": {".found"}}, InDegree: 1},
+			// 分支守卫移动到了只被分支使用的节点上
+			{Type: "builtin.jq", Name: "fallback", Inputs: []int{0}, Args: map[string][]string{"filter": {".fallback"}}, Dependencies: []int{5}, InDegree: 2},
+			{Type: "builtin.when_true", Name: "when_true", Inputs: []int{1}, InDegree: 1},
+			{Type: "builtin.jq", Name: "payload", Inputs: []int{0}, Args: map[string][]string{"filter": {".payload"}}, Dependencies: []int{3}, InDegree: 2},
+			{Type: "builtin.when_false", Name: "when_false", Inputs: []int{1}, InDegree: 1},
+			{Type: "builtin.when_any", Name: "when_any", Inputs: []int{4, 2}, InDegree: 2, IsResponse: true},
+		},
+	}
+	testOptimizeWithCodeAndGraph(t, code, OptimizeOptions{EliminateIdentityNodes: true}, expected)
+}
+
+// TestEliminateIdentityNodesKeepsSharedInputs tests that identity nodes guarding shared values are kept
+func TestEliminateIdentityNodesKeepsSharedInputs(t *testing.T) {
+	code := `
+	func main(input) {
+		cond=builtin("jq", input, filter='.found');
+		result=builtin("http", input, endpoint='http://localhost/');
+		builtin("set_cache", result, prefix='p');
+		if(cond){
+			result;
+		}else{
+			builtin("jq", input, filter='.payload');
+		}
+	}`
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).
+		WithOptimizeOptions(OptimizeOptions{EliminateIdentityNodes: true}).
+		GenerateGraph()
+	require.Len(t, graph.Nodes, 9)
+	require.Equal(t, "builtin.identity", graph.Nodes[5].Type)
+}
+
+// TestOptimizeReferencesOutOfRange tests that the passes don't panic on graphs that were never validated
+func TestOptimizeReferencesOutOfRange(t *testing.T) {
+	newGraph := func() *Graph {
+		return &Graph{Nodes: []Node{
+			{Type: "builtin.start", Name: "input"},
+			{Type: "builtin.jq", Name: "jq", Inputs: []int{5}, Dependencies: []int{-1}, Args: map[string][]string{"filter": {"."}}, InDegree: 2, IsResponse: true},
+			{Type: "builtin.identity", Name: "identity", Inputs: []int{7}, InDegree: 1},
+		}}
+	}
+	for _, pass := range []func(*Graph){
+		(*Graph).EliminateDeadNodes,
+		(*Graph).EliminateCommonSubexpressions,
+		(*Graph).FuseJqNodes,
+		(*Graph).EliminateIdentityNodes,
+	} {
+		graph := newGraph()
+		require.NotPanics(t, func() { pass(graph) })
+	}
+	// 死节点删除后越界的引用被丢弃
+	graph := newGraph()
+	graph.EliminateDeadNodes()
+	require.Empty(t, graph.Nodes[1].Inputs)
+	require.Empty(t, graph.Nodes[1].Dependencies)
+}
@@ -0,0 +1,146 @@
+package generators
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vuuihc/gfc/parser"
+)
+
+// symbolKind is the kind of a name bound in a Stack
+type symbolKind int
+
+const (
+	symbolVar   symbolKind = iota // node variable, the value is the node offset
+	symbolConst                   // constant, the value is the resolved string
+	symbolFunc                    // function, the value is the parser.FuncStmt
+)
+
+func (k symbolKind) String() string {
+	switch k {
+	case symbolVar:
+		return "variable"
+	case symbolConst:
+		return "constant"
+	case symbolFunc:
+		return "inline function"
+	default:
+		return "unknown"
+	}
+}
+
+// kindOf returns the kind of a value stored in a Stack
+func kindOf(v interface{}) (symbolKind, bool) {
+	switch v.(type) {
+	case int:
+		return symbolVar, true
+	case string:
+		return symbolConst, true
+	case parser.FuncStmt:
+		return symbolFunc, true
+	default:
+		return 0, false
+	}
+}
+
+// define binds a name and records where it was defined
+func (s Stack) define(name string, value interface{}, origin string) {
+	s.values[name] = value
+	s.origins[name] = origin
+}
+
+// origin returns where a name was defined
+func (s Stack) origin(name string) string {
+	return s.origins[name]
+}
+
+// maxSuggestions 最多给出的候选名字数量
+const maxSuggestions = 3
+
+// suggest returns the names of the given kind nearest to name by edit distance,
+// nearest first
+func (s Stack) suggest(name string, kind symbolKind) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	// 距离过大的名字不会被当作拼写错误
+	maxDistance := len([]rune(name))/2 + 1
+	var candidates []candidate
+	for k, v := range s.values {
+		if k == name {
+			continue
+		}
+		if kk, ok := kindOf(v); !ok || kk != kind {
+			continue
+		}
+		if d := editDistance(name, k); d <= maxDistance {
+			candidates = append(candidates, candidate{k, d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	var names []string
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		names = append(names, candidates[i].name)
+	}
+	return names
+}
+
+// undefined describes a name that can not be resolved as the given kind,
+// with the nearest names in scope as suggestions
+func (s Stack) undefined(name string, kind symbolKind) string {
+	msg := fmt.Sprintf("undefined %s %q", kind, name)
+	if v, ok := s.values[name]; ok {
+		if actual, ok := kindOf(v); ok {
+			msg = fmt.Sprintf("%q is a %s, not a %s", name, actual, kind)
+			if origin := s.origin(name); origin != "" {
+				msg += fmt.Sprintf(" (%s)", origin)
+			}
+		}
+	}
+	suggestions := s.suggest(name, kind)
+	if len(suggestions) == 0 {
+		return msg
+	}
+	msg += fmt.Sprintf("; did you mean %q", suggestions[0])
+	if origin := s.origin(suggestions[0]); origin != "" {
+		msg += fmt.Sprintf(" (%s)", origin)
+	}
+	for _, other := range suggestions[1:] {
+		msg += fmt.Sprintf(", %q", other)
+	}
+	return msg + "?"
+}
+
+// editDistance returns the levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j] + 1
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+			if prev[j-1]+cost < curr[j] {
+				curr[j] = prev[j-1] + cost
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
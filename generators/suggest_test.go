@@ -0,0 +1,36 @@
+package generators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// TestEditDistance tests the levenshtein distance between names
+func TestEditDistance(t *testing.T) {
+	require.Equal(t, 0, editDistance("cacheRes", "cacheRes"))
+	require.Equal(t, 1, editDistance("cachRes", "cacheRes"))
+	require.Equal(t, 1, editDistance("cacheReq", "cacheRes"))
+	require.Equal(t, 3, editDistance("", "key"))
+	require.Equal(t, 2, editDistance("红楼梦", "红"))
+}
+
+// TestStackUndefined tests the suggestions for undefined names
+func TestStackUndefined(t *testing.T) {
+	stack := newStack()
+	stack.define("cacheKey", "key", "constant defined at top level")
+	stack.define("getCacheKey", parser.FuncStmt{Name: "getCacheKey"}, "function defined at top level")
+	stack.define("cacheRes", 3, "variable assigned in func main")
+	stack.define("cacheReq", 5, "variable assigned in func setCache")
+
+	require.Equal(t, `undefined variable "cachRes"; did you mean "cacheRes" (variable assigned in func main), "cacheReq"?`,
+		stack.undefined("cachRes", symbolVar))
+	require.Equal(t, `undefined constant "cacheKy"; did you mean "cacheKey" (constant defined at top level)?`,
+		stack.undefined("cacheKy", symbolConst))
+	require.Equal(t, `undefined inline function "getCachKey"; did you mean "getCacheKey" (function defined at top level)?`,
+		stack.undefined("getCachKey", symbolFunc))
+	require.Equal(t, `"cacheKey" is a constant, not a variable (constant defined at top level); did you mean "cacheReq" (variable assigned in func setCache), "cacheRes"?`,
+		stack.undefined("cacheKey", symbolVar))
+	require.Equal(t, `undefined variable "payload"`, stack.undefined("payload", symbolVar))
+}
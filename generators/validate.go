@@ -0,0 +1,126 @@
+package generators
+
+import (
+	"fmt"
+
+	"emperror.dev/errors"
+)
+
+// ValidateStructure checks what every consumer of a graph relies on: the
+// references are in range, there is no cycle, there is one builtin.start node
+// without inputs, and builtin.when_any nodes have 2 inputs. Graphs of older
+// compilers pass it, although they count InDegree differently and mark no
+// response node. All problems found are combined into the returned error.
+func (g *Graph) ValidateStructure() error {
+	return errors.Combine(g.structureErrors()...)
+}
+
+// Validate checks the invariants of the graphs this compiler generates, for
+// example of a graph loaded from json: the structure checked by
+// ValidateStructure, the InDegree of every node, which counts its distinct
+// inputs and dependencies, and a single response node. The executor runs only
+// graphs passing it, since it schedules nodes by InDegree; graphs of older
+// compilers pass it after Normalize. All problems found are combined into the
+// returned error.
+func (g *Graph) Validate() error {
+	errs := g.structureErrors()
+	var responses []int
+	for id := range g.Nodes {
+		node := &g.Nodes[id]
+		if expected := inDegree(node); node.InDegree != expected {
+			errs = append(errs, fmt.Errorf("node %d: in_degree is %d, expected %d", id, node.InDegree, expected))
+		}
+		if node.IsResponse {
+			responses = append(responses, id)
+		}
+	}
+	switch len(responses) {
+	case 0:
+		errs = append(errs, fmt.Errorf("response node not found"))
+	case 1:
+	default:
+		errs = append(errs, fmt.Errorf("several response nodes %v", responses))
+	}
+	return errors.Combine(errs...)
+}
+
+// structureErrors returns the problems found by ValidateStructure
+func (g *Graph) structureErrors() []error {
+	var errs []error
+	var starts []int
+	inRange := true
+	for id := range g.Nodes {
+		node := &g.Nodes[id]
+		for _, list := range []struct {
+			name string
+			ids  []int
+		}{{"inputs", node.Inputs}, {"dependencies", node.Dependencies}} {
+			for _, ref := range list.ids {
+				if ref < 0 || ref >= len(g.Nodes) {
+					errs = append(errs, fmt.Errorf("node %d: %s reference %d out of range [0, %d)", id, list.name, ref, len(g.Nodes)))
+					inRange = false
+				}
+			}
+		}
+		switch node.Type {
+		case "builtin.start":
+			starts = append(starts, id)
+			if len(node.Inputs) > 0 || len(node.Dependencies) > 0 {
+				errs = append(errs, fmt.Errorf("node %d: builtin.start should have no inputs or dependencies", id))
+			}
+		case "builtin.when_any":
+			// when_any 汇合if语句的两个分支
+			if len(node.Inputs) != 2 {
+				errs = append(errs, fmt.Errorf("node %d: builtin.when_any should have 2 inputs, got %d", id, len(node.Inputs)))
+			}
+		}
+	}
+	switch len(starts) {
+	case 0:
+		errs = append(errs, fmt.Errorf("builtin.start node not found"))
+	case 1:
+	default:
+		errs = append(errs, fmt.Errorf("duplicate builtin.start nodes %v", starts))
+	}
+	// 引用越界时无法检查环
+	if inRange {
+		if _, err := g.topoOrder(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Normalize upgrades a graph of an older compiler passing ValidateStructure
+// to pass Validate. Older compilers counted only the dependencies in the
+// InDegree of a node having some, and marked no response node, so Normalize
+// recomputes InDegree, and marks the only node nothing uses as the response
+// node, or the last node if there are several.
+func (g *Graph) Normalize() {
+	used := make([]bool, len(g.Nodes))
+	response := false
+	for id := range g.Nodes {
+		node := &g.Nodes[id]
+		node.InDegree = inDegree(node)
+		for _, upstream := range node.Upstreams() {
+			if upstream >= 0 && upstream < len(used) {
+				used[upstream] = true
+			}
+		}
+		response = response || node.IsResponse
+	}
+	if response || len(g.Nodes) == 0 {
+		return
+	}
+	sink := len(g.Nodes) - 1
+	var sinks []int
+	for id := range g.Nodes {
+		if !used[id] {
+			sinks = append(sinks, id)
+		}
+	}
+	if len(sinks) == 1 {
+		sink = sinks[0]
+	}
+	g.Nodes[sink].IsResponse = true
+}
@@ -0,0 +1,178 @@
+package generators
+
+import (
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// TestValidateGeneratedGraph tests that generated graphs are valid
+func TestValidateGeneratedGraph(t *testing.T) {
+	code := `
+	func main(input) {
+		cond=builtin("jq", input, filter='.found');
+		result=builtin("http", input, endpoint='http://localhost/');
+		if(cond){
+			builtin("jq", [result, result], filter='.[0]');
+		}else{
+			builtin("jq", input, filter='.payload');
+		}
+	}`
+	graph := NewGFGenerator(parser.NewParser(code).Parse()).GenerateGraph()
+	require.NoError(t, graph.Validate())
+	// 分支节点的输入在分支外，入度同时包含输入和依赖
+	require.Equal(t, 2, graph.Nodes[4].InDegree)
+}
+
+// TestValidateInDegree tests detecting in degree mismatches
+func TestValidateInDegree(t *testing.T) {
+	graph := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start"},
+			{Type: "builtin.when_true", Inputs: []int{0}, InDegree: 1},
+			{Type: "builtin.jq", Inputs: []int{0}, Dependencies: []int{1}, InDegree: 1, IsResponse: true},
+		},
+	}
+	require.EqualError(t, graph.Validate(), "node 2: in_degree is 1, expected 2")
+}
+
+// TestValidateStructure tests that graphs of older compilers have a valid structure
+func TestValidateStructure(t *testing.T) {
+	// 旧的编译器中分支节点的入度只计算依赖，也没有响应节点
+	graph := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start"},
+			{Type: "builtin.when_true", Inputs: []int{0}, InDegree: 1},
+			{Type: "builtin.jq", Inputs: []int{0}, Dependencies: []int{1}, InDegree: 1},
+		},
+	}
+	require.NoError(t, graph.ValidateStructure())
+	require.EqualError(t, graph.Validate(), "node 2: in_degree is 1, expected 2; response node not found")
+
+	graph.Nodes[2].Inputs = []int{3}
+	require.EqualError(t, graph.ValidateStructure(), "node 2: inputs reference 3 out of range [0, 3)")
+}
+
+// TestNormalize tests upgrading graphs of older compilers
+func TestNormalize(t *testing.T) {
+	graph := &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start"},
+			{Type: "builtin.when_true", Inputs: []int{0}, InDegree: 1},
+			{Type: "builtin.jq", Inputs: []int{0}, Dependencies: []int{1}, InDegree: 1},
+		},
+	}
+	graph.Normalize()
+	require.NoError(t, graph.Validate())
+	require.Equal(t, 2, graph.Nodes[2].InDegree)
+	require.True(t, graph.Nodes[2].IsResponse)
+
+	// 有多个没有被使用的节点时，最后一个节点是响应节点
+	graph = &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start"},
+			{Type: "builtin.jq", Inputs: []int{0}},
+			{Type: "builtin.set_cache", Inputs: []int{0}},
+			{Type: "builtin.jq", Inputs: []int{1}},
+		},
+	}
+	graph.Normalize()
+	require.NoError(t, graph.Validate())
+	require.True(t, graph.Nodes[3].IsResponse)
+
+	// 只有一个节点没有被使用时，它是响应节点
+	graph = &Graph{
+		Nodes: []Node{
+			{Type: "builtin.start"},
+			{Type: "builtin.jq", Inputs: []int{2}},
+			{Type: "builtin.jq", Inputs: []int{0}},
+		},
+	}
+	graph.Normalize()
+	require.True(t, graph.Nodes[1].IsResponse)
+	require.False(t, graph.Nodes[2].IsResponse)
+}
+
+// TestValidateErrors tests detecting malformed graphs
+func TestValidateErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		graph  *Graph
+		errors []string
+	}{
+		{
+			name: "cycle",
+			graph: &Graph{Nodes: []Node{
+				{Type: "builtin.start"},
+				{Type: "builtin.jq", Inputs: []int{0, 2}, InDegree: 2},
+				{Type: "builtin.jq", Inputs: []int{1}, InDegree: 1, IsResponse: true},
+			}},
+			errors: []string{"graph has a cycle through nodes [1 2]"},
+		},
+		{
+			name: "out of range",
+			graph: &Graph{Nodes: []Node{
+				{Type: "builtin.start"},
+				{Type: "builtin.jq", Inputs: []int{3}, Dependencies: []int{-1}, InDegree: 2, IsResponse: true},
+			}},
+			errors: []string{
+				"node 1: inputs reference 3 out of range [0, 2)",
+				"node 1: dependencies reference -1 out of range [0, 2)",
+			},
+		},
+		{
+			name: "start",
+			graph: &Graph{Nodes: []Node{
+				{Type: "builtin.jq", IsResponse: true},
+			}},
+			errors: []string{"builtin.start node not found"},
+		},
+		{
+			name: "duplicate start",
+			graph: &Graph{Nodes: []Node{
+				{Type: "builtin.start"},
+				{Type: "builtin.start", Inputs: []int{0}, InDegree: 1, IsResponse: true},
+			}},
+			errors: []string{
+				"node 1: builtin.start should have no inputs or dependencies",
+				"duplicate builtin.start nodes [0 1]",
+			},
+		},
+		{
+			name: "when_any",
+			graph: &Graph{Nodes: []Node{
+				{Type: "builtin.start"},
+				{Type: "builtin.when_any", Inputs: []int{0}, InDegree: 1, IsResponse: true},
+			}},
+			errors: []string{"node 1: builtin.when_any should have 2 inputs, got 1"},
+		},
+		{
+			name: "no response",
+			graph: &Graph{Nodes: []Node{
+				{Type: "builtin.start"},
+			}},
+			errors: []string{"response node not found"},
+		},
+		{
+			name: "several responses",
+			graph: &Graph{Nodes: []Node{
+				{Type: "builtin.start", IsResponse: true},
+				{Type: "builtin.jq", Inputs: []int{0}, InDegree: 1, IsResponse: true},
+			}},
+			errors: []string{"several response nodes [0 1]"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.graph.Validate()
+			require.Error(t, err)
+			var messages []string
+			for _, e := range errors.GetErrors(err) {
+				messages = append(messages, e.Error())
+			}
+			require.Equal(t, c.errors, messages)
+		})
+	}
+}
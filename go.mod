@@ -2,18 +2,22 @@ module github.com/vuuihc/gfc
 
 go 1.18
 
-require emperror.dev/emperror v0.33.0
+require (
+	emperror.dev/emperror v0.33.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 )
 
 require (
-	emperror.dev/errors v0.8.0 // indirect
+	emperror.dev/errors v0.8.0
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/stretchr/testify v1.8.1
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,793 @@
+package jq
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// function is a builtin function, args are the unevaluated arguments
+type function func(e *env, in interface{}, args []node, emit emitter) error
+
+// functions are the builtin functions by name/arity
+var functions = map[string]function{
+	"empty/0":          func(*env, interface{}, []node, emitter) error { return nil },
+	"not/0":            simple(func(in interface{}) (interface{}, error) { return !truthy(in), nil }),
+	"length/0":         simple(length),
+	"utf8bytelength/0": simple(utf8ByteLength),
+	"type/0":           simple(func(in interface{}) (interface{}, error) { return typeName(in), nil }),
+	"keys/0":           simple(keys),
+	"keys_unsorted/0":  simple(keys),
+	"has/1":            withArg(has),
+	"contains/1":       withArg(func(in, b interface{}) (interface{}, error) { return contains(in, b) }),
+	"add/0":            simple(addAll),
+	"any/0":            simple(func(in interface{}) (interface{}, error) { return anyAll(in, true) }),
+	"all/0":            simple(func(in interface{}) (interface{}, error) { return anyAll(in, false) }),
+	"flatten/0":        simple(func(in interface{}) (interface{}, error) { return flatten(in, 1e9) }),
+	"flatten/1":        withArg(flattenDepth),
+	"range/1":          rangeN,
+	"range/2":          rangeFromTo,
+	"floor/0":          math1(math.Floor),
+	"ceil/0":           math1(math.Ceil),
+	"round/0":          math1(math.Round),
+	"sqrt/0":           math1(math.Sqrt),
+	"fabs/0":           math1(math.Abs),
+	"tostring/0":       simple(func(in interface{}) (interface{}, error) { return toText(in), nil }),
+	"tonumber/0":       simple(toNumber),
+	"tojson/0":         simple(func(in interface{}) (interface{}, error) { return toJSON(in), nil }),
+	"fromjson/0":       simple(fromJSON),
+	"ascii_downcase/0": stringFunc(strings.ToLower),
+	"ascii_upcase/0":   stringFunc(strings.ToUpper),
+	"reverse/0":        simple(reverse),
+	"sort/0":           simple(func(in interface{}) (interface{}, error) { return sortBy(in, nil, nil) }),
+	"sort_by/1":        byFunc(func(in []interface{}, keys []interface{}) (interface{}, error) { return sortBy(in, keys, nil) }),
+	"group_by/1":       byFunc(groupBy),
+	"unique/0":         simple(func(in interface{}) (interface{}, error) { return uniqueBy(in, nil) }),
+	"unique_by/1":      byFunc(func(in []interface{}, keys []interface{}) (interface{}, error) { return uniqueBy(in, keys) }),
+	"min/0":            simple(func(in interface{}) (interface{}, error) { return extreme(in, nil, -1) }),
+	"max/0":            simple(func(in interface{}) (interface{}, error) { return extreme(in, nil, 1) }),
+	"min_by/1":         byFunc(func(in []interface{}, keys []interface{}) (interface{}, error) { return extreme(in, keys, -1) }),
+	"max_by/1":         byFunc(func(in []interface{}, keys []interface{}) (interface{}, error) { return extreme(in, keys, 1) }),
+	"first/0":          simple(func(in interface{}) (interface{}, error) { return index(in, 0.0) }),
+	"last/0":           simple(func(in interface{}) (interface{}, error) { return index(in, -1.0) }),
+	"first/1":          first,
+	"last/1":           last,
+	"limit/2":          limit,
+	"map/1":            mapFunc,
+	"map_values/1":     mapValues,
+	"select/1":         selectFunc,
+	"recurse/0":        func(_ *env, in interface{}, _ []node, emit emitter) error { return recurse(in, emit) },
+	"to_entries/0":     simple(toEntries),
+	"from_entries/0":   simple(fromEntries),
+	"with_entries/1":   withEntries,
+	"join/1":           withArg(join),
+	"split/1":          withArg(splitFunc),
+	"ltrimstr/1":       withArg(trimFunc(strings.HasPrefix, strings.TrimPrefix)),
+	"rtrimstr/1":       withArg(trimFunc(strings.HasSuffix, strings.TrimSuffix)),
+	"startswith/1":     withArg(affixFunc("startswith", strings.HasPrefix)),
+	"endswith/1":       withArg(affixFunc("endswith", strings.HasSuffix)),
+	"test/1":           withArg(test),
+	"getpath/1":        withArg(getPath),
+	"error/0":          simple(func(in interface{}) (interface{}, error) { return nil, &ValueError{Value: in} }),
+	"error/1":          withArg(func(_, msg interface{}) (interface{}, error) { return nil, &ValueError{Value: msg} }),
+}
+
+// formats are the @ formats converting values to strings
+var formats = map[string]func(v interface{}) (string, error){
+	"text": func(v interface{}) (string, error) { return toText(v), nil },
+	"json": func(v interface{}) (string, error) { return toJSON(v), nil },
+	"html": func(v interface{}) (string, error) { return html.EscapeString(toText(v)), nil },
+	"uri":  func(v interface{}) (string, error) { return url.QueryEscape(toText(v)), nil },
+	"base64": func(v interface{}) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(toText(v))), nil
+	},
+	"base64d": func(v interface{}) (string, error) {
+		data, err := base64.StdEncoding.DecodeString(toText(v))
+		if err != nil {
+			return "", errorf("%s is not valid base64 data", brief(v))
+		}
+		return string(data), nil
+	},
+	"csv": func(v interface{}) (string, error) { return joinRow(v, "csv", ",") },
+	"tsv": func(v interface{}) (string, error) { return joinRow(v, "tsv", "\t") },
+}
+
+// simple is a function without arguments
+func simple(f func(in interface{}) (interface{}, error)) function {
+	return func(_ *env, in interface{}, _ []node, emit emitter) error {
+		v, err := f(in)
+		if err != nil {
+			return err
+		}
+		return emit(v)
+	}
+}
+
+// withArg is a function of one argument, called for each output of the argument
+func withArg(f func(in, arg interface{}) (interface{}, error)) function {
+	return func(e *env, in interface{}, args []node, emit emitter) error {
+		return args[0].eval(e, in, func(arg interface{}) error {
+			v, err := f(in, arg)
+			if err != nil {
+				return err
+			}
+			return emit(v)
+		})
+	}
+}
+
+// byFunc is a function of an array and the keys of its elements, the
+// outputs of the argument collected into an array for each element
+func byFunc(f func(in []interface{}, keys []interface{}) (interface{}, error)) function {
+	return func(e *env, in interface{}, args []node, emit emitter) error {
+		array, ok := in.([]interface{})
+		if !ok {
+			return errorf("cannot sort %s, as it is not an array", typeName(in))
+		}
+		keys := make([]interface{}, len(array))
+		for i, elem := range array {
+			outputs, err := collect(args[0], e, elem)
+			if err != nil {
+				return err
+			}
+			keys[i] = append([]interface{}{}, outputs...)
+		}
+		v, err := f(array, keys)
+		if err != nil {
+			return err
+		}
+		return emit(v)
+	}
+}
+
+func math1(f func(float64) float64) function {
+	return simple(func(in interface{}) (interface{}, error) {
+		n, ok := in.(float64)
+		if !ok {
+			return nil, errorf("%s (%s) number required", typeName(in), brief(in))
+		}
+		return f(n), nil
+	})
+}
+
+func stringFunc(f func(string) string) function {
+	return simple(func(in interface{}) (interface{}, error) {
+		s, ok := in.(string)
+		if !ok {
+			return nil, errorf("%s (%s) cannot be converted, as it is not a string", typeName(in), brief(in))
+		}
+		return f(s), nil
+	})
+}
+
+func length(in interface{}) (interface{}, error) {
+	switch in := in.(type) {
+	case nil:
+		return 0.0, nil
+	case float64:
+		return math.Abs(in), nil
+	case string:
+		return float64(utf8.RuneCountInString(in)), nil
+	case []interface{}:
+		return float64(len(in)), nil
+	case map[string]interface{}:
+		return float64(len(in)), nil
+	}
+	return nil, errorf("%s (%s) has no length", typeName(in), brief(in))
+}
+
+func utf8ByteLength(in interface{}) (interface{}, error) {
+	s, ok := in.(string)
+	if !ok {
+		return nil, errorf("%s (%s) only strings have UTF-8 byte length", typeName(in), brief(in))
+	}
+	return float64(len(s)), nil
+}
+
+func keys(in interface{}) (interface{}, error) {
+	switch in := in.(type) {
+	case map[string]interface{}:
+		return stringsToValues(sortedKeys(in)), nil
+	case []interface{}:
+		indices := make([]interface{}, len(in))
+		for i := range in {
+			indices[i] = float64(i)
+		}
+		return indices, nil
+	}
+	return nil, errorf("%s (%s) has no keys", typeName(in), brief(in))
+}
+
+func has(in, k interface{}) (interface{}, error) {
+	switch in := in.(type) {
+	case map[string]interface{}:
+		if k, ok := k.(string); ok {
+			_, found := in[k]
+			return found, nil
+		}
+	case []interface{}:
+		if k, ok := k.(float64); ok {
+			return k >= 0 && k < float64(len(in)), nil
+		}
+	}
+	return nil, errorf("cannot check whether %s has a %s key", typeName(in), typeName(k))
+}
+
+// contains checks if b is in a: substrings, elements contained by any element, and objects recursively
+func contains(a, b interface{}) (bool, error) {
+	if typeOrder(a) != typeOrder(b) && !(isBool(a) && isBool(b)) {
+		return false, errorf("%s (%s) and %s (%s) cannot have their containment checked", typeName(a), brief(a), typeName(b), brief(b))
+	}
+	switch a := a.(type) {
+	case string:
+		return strings.Contains(a, b.(string)), nil
+	case []interface{}:
+	next:
+		for _, bv := range b.([]interface{}) {
+			for _, av := range a {
+				if ok, err := contains(av, bv); err == nil && ok {
+					continue next
+				}
+			}
+			return false, nil
+		}
+		return true, nil
+	case map[string]interface{}:
+		for k, bv := range b.(map[string]interface{}) {
+			av, found := a[k]
+			if !found {
+				return false, nil
+			}
+			ok, err := contains(av, bv)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return compare(a, b) == 0, nil
+}
+
+func isBool(v interface{}) bool {
+	_, ok := v.(bool)
+	return ok
+}
+
+// values returns the elements of an array or the values of an object by key order
+func values(in interface{}) ([]interface{}, error) {
+	var vs []interface{}
+	err := iterate(in, func(v interface{}) error {
+		vs = append(vs, v)
+		return nil
+	})
+	return vs, err
+}
+
+func addAll(in interface{}) (interface{}, error) {
+	vs, err := values(in)
+	if err != nil {
+		return nil, err
+	}
+	var sum interface{}
+	for _, v := range vs {
+		if sum, err = add(sum, v); err != nil {
+			return nil, err
+		}
+	}
+	return sum, nil
+}
+
+func anyAll(in interface{}, isAny bool) (interface{}, error) {
+	vs, err := values(in)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vs {
+		if truthy(v) == isAny {
+			return isAny, nil
+		}
+	}
+	return !isAny, nil
+}
+
+func flattenDepth(in, depth interface{}) (interface{}, error) {
+	d, ok := depth.(float64)
+	if !ok || d < 0 {
+		return nil, errorf("flatten depth must not be negative")
+	}
+	return flatten(in, d)
+}
+
+func flatten(in interface{}, depth float64) (interface{}, error) {
+	array, ok := in.([]interface{})
+	if !ok {
+		return nil, errorf("cannot flatten %s", typeName(in))
+	}
+	flat := []interface{}{}
+	for _, v := range array {
+		if inner, ok := v.([]interface{}); ok && depth > 0 {
+			f, _ := flatten(inner, depth-1)
+			flat = append(flat, f.([]interface{})...)
+		} else {
+			flat = append(flat, v)
+		}
+	}
+	return flat, nil
+}
+
+func rangeN(e *env, in interface{}, args []node, emit emitter) error {
+	return args[0].eval(e, in, func(n interface{}) error {
+		return emitRange(0.0, n, emit)
+	})
+}
+
+func rangeFromTo(e *env, in interface{}, args []node, emit emitter) error {
+	return args[0].eval(e, in, func(from interface{}) error {
+		return args[1].eval(e, in, func(upto interface{}) error {
+			return emitRange(from, upto, emit)
+		})
+	})
+}
+
+func emitRange(from, upto interface{}, emit emitter) error {
+	f, ok1 := from.(float64)
+	u, ok2 := upto.(float64)
+	if !ok1 || !ok2 {
+		return errorf("range bounds must be numbers")
+	}
+	for i := f; i < u; i++ {
+		if err := emit(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toNumber(in interface{}) (interface{}, error) {
+	switch in := in.(type) {
+	case float64:
+		return in, nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(in), 64)
+		if err != nil {
+			return nil, errorf("cannot parse %q as a number", in)
+		}
+		return n, nil
+	}
+	return nil, errorf("%s (%s) cannot be parsed as a number", typeName(in), brief(in))
+}
+
+func fromJSON(in interface{}) (interface{}, error) {
+	s, ok := in.(string)
+	if !ok {
+		return nil, errorf("%s (%s) cannot be parsed as json, as it is not a string", typeName(in), brief(in))
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, errorf("%s cannot be parsed as json: %v", brief(in), err)
+	}
+	return v, nil
+}
+
+func reverse(in interface{}) (interface{}, error) {
+	switch in := in.(type) {
+	case nil:
+		return []interface{}{}, nil
+	case string:
+		runes := []rune(in)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	case []interface{}:
+		reversed := make([]interface{}, len(in))
+		for i, v := range in {
+			reversed[len(in)-1-i] = v
+		}
+		return reversed, nil
+	}
+	return nil, errorf("cannot reverse %s", typeName(in))
+}
+
+// sortBy sorts an array stably by the keys of its elements, or by the
+// elements themselves if keys is nil. indices gets the sorted order.
+func sortBy(in interface{}, keys []interface{}, indices *[]int) (interface{}, error) {
+	array, ok := in.([]interface{})
+	if !ok {
+		return nil, errorf("%s (%s) cannot be sorted, as it is not an array", typeName(in), brief(in))
+	}
+	if keys == nil {
+		keys = array
+	}
+	order := make([]int, len(array))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return compare(keys[order[i]], keys[order[j]]) < 0
+	})
+	sorted := make([]interface{}, len(array))
+	for i, j := range order {
+		sorted[i] = array[j]
+	}
+	if indices != nil {
+		*indices = order
+	}
+	return sorted, nil
+}
+
+func groupBy(in []interface{}, keys []interface{}) (interface{}, error) {
+	var order []int
+	sorted, err := sortBy(in, keys, &order)
+	if err != nil {
+		return nil, err
+	}
+	groups := []interface{}{}
+	var group []interface{}
+	for i, v := range sorted.([]interface{}) {
+		if i > 0 && compare(keys[order[i-1]], keys[order[i]]) != 0 {
+			groups = append(groups, group)
+			group = nil
+		}
+		group = append(group, v)
+	}
+	if group != nil {
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func uniqueBy(in interface{}, keys []interface{}) (interface{}, error) {
+	var order []int
+	sorted, err := sortBy(in, keys, &order)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = in.([]interface{})
+	}
+	unique := []interface{}{}
+	for i, v := range sorted.([]interface{}) {
+		if i == 0 || compare(keys[order[i-1]], keys[order[i]]) != 0 {
+			unique = append(unique, v)
+		}
+	}
+	return unique, nil
+}
+
+// extreme returns the element with the minimum key if sign is -1, or the maximum if sign is 1
+func extreme(in interface{}, keys []interface{}, sign int) (interface{}, error) {
+	array, ok := in.([]interface{})
+	if !ok {
+		return nil, errorf("%s (%s) has no minimum or maximum, as it is not an array", typeName(in), brief(in))
+	}
+	if keys == nil {
+		keys = array
+	}
+	best := -1
+	for i := range array {
+		if best < 0 {
+			best = i
+			continue
+		}
+		// 相等时 max 取后面的，min 取前面的，和jq一致
+		if c := compare(keys[i], keys[best]) * sign; c > 0 || c == 0 && sign > 0 {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, nil
+	}
+	return array[best], nil
+}
+
+// stop is returned to stop a filter after enough outputs. Each call uses its own stop.
+type stop struct{}
+
+func (*stop) Error() string {
+	return "stop"
+}
+
+func limit(e *env, in interface{}, args []node, emit emitter) error {
+	return args[0].eval(e, in, func(n interface{}) error {
+		count, ok := n.(float64)
+		if !ok {
+			return errorf("invalid limit %s", brief(n))
+		}
+		return emitLimit(e, in, args[1], int(count), emit)
+	})
+}
+
+func emitLimit(e *env, in interface{}, f node, n int, emit emitter) error {
+	if n <= 0 {
+		return nil
+	}
+	done := &stop{}
+	emitted := 0
+	err := f.eval(e, in, func(v interface{}) error {
+		if err := emit(v); err != nil {
+			return err
+		}
+		if emitted++; emitted >= n {
+			return done
+		}
+		return nil
+	})
+	if err == done {
+		return nil
+	}
+	return err
+}
+
+func first(e *env, in interface{}, args []node, emit emitter) error {
+	return emitLimit(e, in, args[0], 1, emit)
+}
+
+func last(e *env, in interface{}, args []node, emit emitter) error {
+	var v interface{}
+	found := false
+	err := args[0].eval(e, in, func(output interface{}) error {
+		v, found = output, true
+		return nil
+	})
+	if err != nil || !found {
+		return err
+	}
+	return emit(v)
+}
+
+// mapFunc is map(f), collecting the outputs of f on each element into an array
+func mapFunc(e *env, in interface{}, args []node, emit emitter) error {
+	vs, err := values(in)
+	if err != nil {
+		return err
+	}
+	mapped := []interface{}{}
+	for _, v := range vs {
+		outputs, err := collect(args[0], e, v)
+		if err != nil {
+			return err
+		}
+		mapped = append(mapped, outputs...)
+	}
+	return emit(mapped)
+}
+
+// mapValues is map_values(f), replacing each value of an array or object by
+// the first output of f, or removing it if f has no output
+func mapValues(e *env, in interface{}, args []node, emit emitter) error {
+	firstOf := func(v interface{}) (interface{}, bool, error) {
+		var output interface{}
+		found := false
+		err := emitLimit(e, v, args[0], 1, func(o interface{}) error {
+			output, found = o, true
+			return nil
+		})
+		return output, found, err
+	}
+	switch in := in.(type) {
+	case map[string]interface{}:
+		mapped := make(map[string]interface{}, len(in))
+		for k, v := range in {
+			output, found, err := firstOf(v)
+			if err != nil {
+				return err
+			}
+			if found {
+				mapped[k] = output
+			}
+		}
+		return emit(mapped)
+	case []interface{}:
+		mapped := []interface{}{}
+		for _, v := range in {
+			output, found, err := firstOf(v)
+			if err != nil {
+				return err
+			}
+			if found {
+				mapped = append(mapped, output)
+			}
+		}
+		return emit(mapped)
+	}
+	return errorf("cannot iterate over %s", typeName(in))
+}
+
+func selectFunc(e *env, in interface{}, args []node, emit emitter) error {
+	return args[0].eval(e, in, func(v interface{}) error {
+		if truthy(v) {
+			return emit(in)
+		}
+		return nil
+	})
+}
+
+func toEntries(in interface{}) (interface{}, error) {
+	obj, ok := in.(map[string]interface{})
+	if !ok {
+		return nil, errorf("%s (%s) has no keys", typeName(in), brief(in))
+	}
+	entries := []interface{}{}
+	for _, k := range sortedKeys(obj) {
+		entries = append(entries, map[string]interface{}{"key": k, "value": obj[k]})
+	}
+	return entries, nil
+}
+
+func fromEntries(in interface{}) (interface{}, error) {
+	vs, err := values(in)
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	for _, v := range vs {
+		entry, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errorf("cannot use %s (%s) as an entry", typeName(v), brief(v))
+		}
+		var key, value interface{}
+		for _, name := range []string{"key", "k", "name", "Name", "Key", "K"} {
+			if k, found := entry[name]; found && truthy(k) {
+				key = k
+				break
+			}
+		}
+		for _, name := range []string{"value", "v", "Value", "V"} {
+			if v, found := entry[name]; found {
+				value = v
+				break
+			}
+		}
+		switch k := key.(type) {
+		case string:
+			obj[k] = value
+		case float64, bool:
+			obj[toJSON(k)] = value
+		case nil:
+			obj["null"] = value
+		default:
+			return nil, errorf("cannot use %s (%s) as an object key", typeName(k), brief(k))
+		}
+	}
+	return obj, nil
+}
+
+func withEntries(e *env, in interface{}, args []node, emit emitter) error {
+	entries, err := toEntries(in)
+	if err != nil {
+		return err
+	}
+	mapped := []interface{}{}
+	for _, entry := range entries.([]interface{}) {
+		outputs, err := collect(args[0], e, entry)
+		if err != nil {
+			return err
+		}
+		mapped = append(mapped, outputs...)
+	}
+	obj, err := fromEntries(mapped)
+	if err != nil {
+		return err
+	}
+	return emit(obj)
+}
+
+func join(in, sep interface{}) (interface{}, error) {
+	s, ok := sep.(string)
+	if !ok {
+		return nil, errorf("join separator should be a string, got %s", typeName(sep))
+	}
+	vs, err := values(in)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(vs))
+	for i, v := range vs {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			parts[i] = v
+		case float64, bool:
+			parts[i] = toJSON(v)
+		default:
+			return nil, errorf("cannot join with %s (%s)", typeName(v), brief(v))
+		}
+	}
+	return strings.Join(parts, s), nil
+}
+
+func splitFunc(in, sep interface{}) (interface{}, error) {
+	s, ok1 := in.(string)
+	sepStr, ok2 := sep.(string)
+	if !ok1 || !ok2 {
+		return nil, errorf("split input and separator must be strings")
+	}
+	return split(s, sepStr), nil
+}
+
+// trimFunc removes a prefix or suffix, other inputs are returned as they are
+func trimFunc(match func(s, affix string) bool, trim func(s, affix string) string) func(in, arg interface{}) (interface{}, error) {
+	return func(in, arg interface{}) (interface{}, error) {
+		s, ok1 := in.(string)
+		affix, ok2 := arg.(string)
+		if !ok1 || !ok2 || !match(s, affix) {
+			return in, nil
+		}
+		return trim(s, affix), nil
+	}
+}
+
+func affixFunc(name string, match func(s, affix string) bool) func(in, arg interface{}) (interface{}, error) {
+	return func(in, arg interface{}) (interface{}, error) {
+		s, ok1 := in.(string)
+		affix, ok2 := arg.(string)
+		if !ok1 || !ok2 {
+			return nil, errorf("%s() requires string inputs", name)
+		}
+		return match(s, affix), nil
+	}
+}
+
+func test(in, re interface{}) (interface{}, error) {
+	s, ok1 := in.(string)
+	pattern, ok2 := re.(string)
+	if !ok1 || !ok2 {
+		return nil, errorf("%s (%s) cannot be matched, as it is not a string", typeName(in), brief(in))
+	}
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errorf("%s (at offset 0) is not a valid regex: %v", pattern, err)
+	}
+	return r.MatchString(s), nil
+}
+
+func getPath(in, path interface{}) (interface{}, error) {
+	keys, ok := path.([]interface{})
+	if !ok {
+		return nil, errorf("path must be specified as an array")
+	}
+	v := in
+	for _, k := range keys {
+		if v == nil {
+			return nil, nil
+		}
+		var err error
+		if v, err = index(v, k); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// joinRow formats an array as a csv or tsv row
+func joinRow(v interface{}, format, sep string) (string, error) {
+	array, ok := v.([]interface{})
+	if !ok {
+		return "", errorf("%s (%s) cannot be %s-formatted, only an array can be", typeName(v), brief(v), format)
+	}
+	fields := make([]string, len(array))
+	for i, elem := range array {
+		switch elem := elem.(type) {
+		case nil:
+		case bool, float64:
+			fields[i] = toJSON(elem)
+		case string:
+			if format == "csv" {
+				fields[i] = `"` + strings.ReplaceAll(elem, `"`, `""`) + `"`
+			} else {
+				fields[i] = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\r", "\\r", "\n", "\\n").Replace(elem)
+			}
+		default:
+			return "", errorf("%s (%s) is not valid in a %s row", typeName(elem), brief(elem), format)
+		}
+	}
+	return strings.Join(fields, sep), nil
+}
@@ -0,0 +1,529 @@
+// Package jq is a pure Go implementation of a subset of jq, enough for the
+// filters of builtin.jq nodes: paths, pipes, //, arithmetic, array and object
+// construction, conditionals, variables, reduce, try and the common builtins.
+package jq
+
+import (
+	"encoding/json"
+
+	"emperror.dev/errors"
+)
+
+// emitter receives the outputs of a filter one by one. An error stops the filter.
+type emitter func(v interface{}) error
+
+// node is a parsed filter
+type node interface {
+	eval(e *env, in interface{}, emit emitter) error
+}
+
+// env holds the variables bound by `as` and reduce
+type env struct {
+	name   string
+	value  interface{}
+	parent *env
+}
+
+func (e *env) lookup(name string) (interface{}, bool) {
+	for ; e != nil; e = e.parent {
+		if e.name == name {
+			return e.value, true
+		}
+	}
+	return nil, false
+}
+
+func (e *env) bind(name string, value interface{}) *env {
+	return &env{name: name, value: value, parent: e}
+}
+
+// Eval parses a filter and evaluates it on an input decoded by encoding/json
+func Eval(filter string, input interface{}) ([]interface{}, error) {
+	q, err := Parse(filter)
+	if err != nil {
+		return nil, err
+	}
+	return q.Run(input)
+}
+
+// Run evaluates the query on an input decoded by encoding/json, and returns all the outputs
+func (q *Query) Run(input interface{}) ([]interface{}, error) {
+	outputs := []interface{}{}
+	err := q.root.eval(nil, input, func(v interface{}) error {
+		outputs = append(outputs, v)
+		return nil
+	})
+	return outputs, err
+}
+
+// RunJSON evaluates the query on a json input, and returns all the outputs as json
+func (q *Query) RunJSON(input []byte) ([]json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(input, &v); err != nil {
+		return nil, errors.WrapIf(err, "invalid json input")
+	}
+	outputs, err := q.Run(v)
+	if err != nil {
+		return nil, err
+	}
+	raws := make([]json.RawMessage, len(outputs))
+	for i, output := range outputs {
+		raws[i] = json.RawMessage(toJSON(output))
+	}
+	return raws, nil
+}
+
+// collect returns all the outputs of a node
+func collect(n node, e *env, in interface{}) ([]interface{}, error) {
+	var outputs []interface{}
+	err := n.eval(e, in, func(v interface{}) error {
+		outputs = append(outputs, v)
+		return nil
+	})
+	return outputs, err
+}
+
+// tracked wraps an emitter to tell the errors returned by it from the errors of
+// the filter emitting to it, which try and // should not catch
+func tracked(emit emitter) (emitter, func(error) bool) {
+	var downstream error
+	return func(v interface{}) error {
+			err := emit(v)
+			if err != nil {
+				downstream = err
+			}
+			return err
+		}, func(err error) bool {
+			return err != nil && err == downstream
+		}
+}
+
+type identityNode struct{}
+
+func (identityNode) eval(_ *env, in interface{}, emit emitter) error {
+	return emit(in)
+}
+
+// recurseNode is .., emitting a value and all the values in it
+type recurseNode struct{}
+
+func (recurseNode) eval(_ *env, in interface{}, emit emitter) error {
+	return recurse(in, emit)
+}
+
+func recurse(v interface{}, emit emitter) error {
+	if err := emit(v); err != nil {
+		return err
+	}
+	switch v.(type) {
+	case []interface{}, map[string]interface{}:
+		return iterate(v, func(elem interface{}) error {
+			return recurse(elem, emit)
+		})
+	}
+	return nil
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(_ *env, _ interface{}, emit emitter) error {
+	return emit(n.value)
+}
+
+// stringNode is a string with interpolations, like "a\(.b)". A format like
+// @base64 is applied to the interpolated values.
+type stringNode struct {
+	parts  []stringPart
+	format string
+}
+
+// stringPart 是字符串的一段，expr 为 nil 时是字面量
+type stringPart struct {
+	text string
+	expr node
+}
+
+func (n *stringNode) add(text string, expr node) {
+	if expr == nil && text == "" {
+		return
+	}
+	n.parts = append(n.parts, stringPart{text: text, expr: expr})
+}
+
+func (n *stringNode) isLiteral() bool {
+	for _, part := range n.parts {
+		if part.expr != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *stringNode) literal() string {
+	var s string
+	for _, part := range n.parts {
+		s += part.text
+	}
+	return s
+}
+
+func (n *stringNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.evalParts(e, in, 0, "", emit)
+}
+
+func (n *stringNode) evalParts(e *env, in interface{}, i int, prefix string, emit emitter) error {
+	if i == len(n.parts) {
+		return emit(prefix)
+	}
+	part := n.parts[i]
+	if part.expr == nil {
+		return n.evalParts(e, in, i+1, prefix+part.text, emit)
+	}
+	return part.expr.eval(e, in, func(v interface{}) error {
+		text := toText(v)
+		if n.format != "" {
+			s, err := formats[n.format](v)
+			if err != nil {
+				return err
+			}
+			text = s
+		}
+		return n.evalParts(e, in, i+1, prefix+text, emit)
+	})
+}
+
+// indexNode is term[key], also .foo and ."foo". key is evaluated on the input of the term.
+type indexNode struct {
+	term node
+	key  node
+	// offset 是 term[key] 在filter中的位置，只在 InputIndexes 中使用
+	offset int
+}
+
+func (n *indexNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.term.eval(e, in, func(v interface{}) error {
+		return n.key.eval(e, in, func(k interface{}) error {
+			elem, err := index(v, k)
+			if err != nil {
+				return err
+			}
+			return emit(elem)
+		})
+	})
+}
+
+// sliceNode is term[from:to], from or to can be nil
+type sliceNode struct {
+	term     node
+	from, to node
+}
+
+func (n *sliceNode) eval(e *env, in interface{}, emit emitter) error {
+	bound := func(b node, f func(interface{}) error) error {
+		if b == nil {
+			return f(nil)
+		}
+		return b.eval(e, in, f)
+	}
+	return n.term.eval(e, in, func(v interface{}) error {
+		return bound(n.from, func(from interface{}) error {
+			return bound(n.to, func(to interface{}) error {
+				s, err := slice(v, from, to)
+				if err != nil {
+					return err
+				}
+				return emit(s)
+			})
+		})
+	})
+}
+
+// iterateNode is term[]
+type iterateNode struct {
+	term node
+}
+
+func (n *iterateNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.term.eval(e, in, func(v interface{}) error {
+		return iterate(v, emit)
+	})
+}
+
+// tryNode is try body catch handler, and body? without the handler
+type tryNode struct {
+	body    node
+	handler node
+}
+
+func (n *tryNode) eval(e *env, in interface{}, emit emitter) error {
+	emit, isDownstream := tracked(emit)
+	err := n.body.eval(e, in, emit)
+	if err == nil || isDownstream(err) {
+		return err
+	}
+	if n.handler == nil {
+		return nil
+	}
+	var value interface{} = err.Error()
+	var valueErr *ValueError
+	if errors.As(err, &valueErr) {
+		value = valueErr.Value
+	}
+	return n.handler.eval(e, value, emit)
+}
+
+type varNode struct {
+	name string
+}
+
+func (n *varNode) eval(e *env, _ interface{}, emit emitter) error {
+	v, ok := e.lookup(n.name)
+	if !ok {
+		return errorf("$%s is not defined", n.name)
+	}
+	return emit(v)
+}
+
+// formatNode is a format like @base64 applied to the input
+type formatNode struct {
+	name string
+}
+
+func (n *formatNode) eval(_ *env, in interface{}, emit emitter) error {
+	s, err := formats[n.name](in)
+	if err != nil {
+		return err
+	}
+	return emit(s)
+}
+
+// arrayNode is [body], collecting the outputs of body into an array
+type arrayNode struct {
+	body node
+}
+
+func (n *arrayNode) eval(e *env, in interface{}, emit emitter) error {
+	array := []interface{}{}
+	if n.body != nil {
+		outputs, err := collect(n.body, e, in)
+		if err != nil {
+			return err
+		}
+		array = append(array, outputs...)
+	}
+	return emit(array)
+}
+
+// objectNode constructs objects, one for each combination of the outputs of the keys and values
+type objectNode struct {
+	entries []objectEntry
+}
+
+type objectEntry struct {
+	key   node
+	value node
+}
+
+func (n *objectNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.evalEntries(e, in, 0, map[string]interface{}{}, emit)
+}
+
+func (n *objectNode) evalEntries(e *env, in interface{}, i int, obj map[string]interface{}, emit emitter) error {
+	if i == len(n.entries) {
+		return emit(obj)
+	}
+	entry := n.entries[i]
+	return entry.key.eval(e, in, func(k interface{}) error {
+		key, ok := k.(string)
+		if !ok {
+			return errorf("object keys should be strings, got %s", typeName(k))
+		}
+		return entry.value.eval(e, in, func(v interface{}) error {
+			// 每个组合用一个新的对象
+			next := make(map[string]interface{}, len(obj)+1)
+			for k, v := range obj {
+				next[k] = v
+			}
+			next[key] = v
+			return n.evalEntries(e, in, i+1, next, emit)
+		})
+	})
+}
+
+type negNode struct {
+	x node
+}
+
+func (n *negNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.x.eval(e, in, func(v interface{}) error {
+		f, ok := v.(float64)
+		if !ok {
+			return errorf("%s (%s) cannot be negated", typeName(v), brief(v))
+		}
+		return emit(-f)
+	})
+}
+
+// binaryNode applies an arithmetic or comparison operator to each combination of the outputs of both sides
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(e *env, in interface{}, emit emitter) error {
+	rights, err := collect(n.right, e, in)
+	if err != nil {
+		return err
+	}
+	lefts, err := collect(n.left, e, in)
+	if err != nil {
+		return err
+	}
+	// 和jq一样，右边的输出在外层
+	for _, r := range rights {
+		for _, l := range lefts {
+			v, err := binary(n.op, l, r)
+			if err != nil {
+				return err
+			}
+			if err := emit(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// logicNode is and/or, the right side is only evaluated when needed
+type logicNode struct {
+	and         bool
+	left, right node
+}
+
+func (n *logicNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.left.eval(e, in, func(l interface{}) error {
+		if truthy(l) != n.and {
+			return emit(!n.and)
+		}
+		return n.right.eval(e, in, func(r interface{}) error {
+			return emit(truthy(r))
+		})
+	})
+}
+
+// altNode is left // right. It outputs the truthy outputs of left, or the
+// outputs of right if there isn't any. Errors of left are ignored.
+type altNode struct {
+	left, right node
+}
+
+func (n *altNode) eval(e *env, in interface{}, emit emitter) error {
+	emitLeft, isDownstream := tracked(emit)
+	any := false
+	err := n.left.eval(e, in, func(v interface{}) error {
+		if !truthy(v) {
+			return nil
+		}
+		any = true
+		return emitLeft(v)
+	})
+	if isDownstream(err) {
+		return err
+	}
+	if any {
+		return nil
+	}
+	return n.right.eval(e, in, emit)
+}
+
+type commaNode struct {
+	left, right node
+}
+
+func (n *commaNode) eval(e *env, in interface{}, emit emitter) error {
+	if err := n.left.eval(e, in, emit); err != nil {
+		return err
+	}
+	return n.right.eval(e, in, emit)
+}
+
+type pipeNode struct {
+	left, right node
+}
+
+func (n *pipeNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.left.eval(e, in, func(v interface{}) error {
+		return n.right.eval(e, v, emit)
+	})
+}
+
+// bindNode is source as $name | body. body runs on the input for each output of source.
+type bindNode struct {
+	source node
+	name   string
+	body   node
+}
+
+func (n *bindNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.source.eval(e, in, func(v interface{}) error {
+		return n.body.eval(e.bind(n.name, v), in, emit)
+	})
+}
+
+// reduceNode is reduce source as $name (init; update)
+type reduceNode struct {
+	source       node
+	name         string
+	init, update node
+}
+
+func (n *reduceNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.init.eval(e, in, func(acc interface{}) error {
+		err := n.source.eval(e, in, func(v interface{}) error {
+			outputs, err := collect(n.update, e.bind(n.name, v), acc)
+			if err != nil {
+				return err
+			}
+			// 取最后一个输出，没有输出时为null
+			acc = nil
+			if len(outputs) > 0 {
+				acc = outputs[len(outputs)-1]
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return emit(acc)
+	})
+}
+
+// ifNode is if cond then then else otherwise end, otherwise is nil without else
+type ifNode struct {
+	cond, then, otherwise node
+}
+
+func (n *ifNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.cond.eval(e, in, func(c interface{}) error {
+		if truthy(c) {
+			return n.then.eval(e, in, emit)
+		}
+		if n.otherwise == nil {
+			return emit(in)
+		}
+		return n.otherwise.eval(e, in, emit)
+	})
+}
+
+// callNode calls a builtin function
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n *callNode) eval(e *env, in interface{}, emit emitter) error {
+	return n.fn(e, in, n.args, emit)
+}
@@ -0,0 +1,196 @@
+package jq
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// run evaluates a filter on a json input and returns the outputs as json
+func run(t *testing.T, filter, input string) ([]string, error) {
+	t.Helper()
+	q, err := Parse(filter)
+	require.NoError(t, err, filter)
+	raws, err := q.RunJSON([]byte(input))
+	outputs := make([]string, len(raws))
+	for i, raw := range raws {
+		outputs[i] = string(raw)
+	}
+	return outputs, err
+}
+
+// TestEvalReadme tests the filters of the README example
+func TestEvalReadme(t *testing.T) {
+	request := `{"payload": "{\"request_id\":\"1674\",\"context\":[\"a\",\"b\"],\"query\":\"红楼梦\",\"suggestion_type\":\"bert\"}"}`
+	for _, c := range []struct {
+		filter, input string
+		outputs       []string
+	}{
+		{".payload | fromjson", request, []string{`{"context":["a","b"],"query":"红楼梦","request_id":"1674","suggestion_type":"bert"}`}},
+		{
+			`.suggestion_type+"##"+(.filter_retrievers//[]|join("#"))+"##"+(.context//[]|join("#"))+"##"+.query`,
+			`{"context":["a","b"],"query":"红楼梦","suggestion_type":"bert"}`,
+			[]string{`"bert####a#b##红楼梦"`},
+		},
+		{
+			`.suggestion_type+"##"+(.filter_retrievers//[]|join("#"))+"##"+(.context//[]|join("#"))+"##"+.query`,
+			`{"context":[],"query":"红楼梦"}`,
+			[]string{`"######红楼梦"`},
+		},
+		{`{"key": .[0], "payload": .[1], "ttl": 259200000}`, `["k", {"actions": []}]`, []string{`{"key":"k","payload":{"actions":[]},"ttl":259200000}`}},
+		{".found | not", `{"found": false}`, []string{"true"}},
+		{".found | not", `{"found": true, "payload": 1}`, []string{"false"}},
+		{".payload", `{"found": true, "payload": {"actions": ["a"]}}`, []string{`{"actions":["a"]}`}},
+		// optimize 合并的 filter
+		{`(.payload | fromjson) | (.query)`, request, []string{`"红楼梦"`}},
+		{`[.[0], .[1]] | (.[1])`, `[1, 2]`, []string{"2"}},
+	} {
+		outputs, err := run(t, c.filter, c.input)
+		require.NoError(t, err, c.filter)
+		require.Equal(t, c.outputs, outputs, c.filter)
+	}
+}
+
+func TestEval(t *testing.T) {
+	for _, c := range []struct {
+		filter, input string
+		outputs       []string
+	}{
+		// 路径
+		{".", `{"a":1}`, []string{`{"a":1}`}},
+		{".a.b", `{"a":{"b":"x"}}`, []string{`"x"`}},
+		{`."a b"`, `{"a b":1}`, []string{"1"}},
+		{`.["a"]`, `{"a":1}`, []string{"1"}},
+		{".a", `null`, []string{"null"}},
+		{".missing", `{}`, []string{"null"}},
+		{".[0], .[-1], .[5]", `[1,2,3]`, []string{"1", "3", "null"}},
+		{".[1:], .[:-1], .[1:2]", `[1,2,3]`, []string{"[2,3]", "[1,2]", "[2]"}},
+		{".[2:]", `"红楼梦小姐姐"`, []string{`"梦小姐姐"`}},
+		{".[]", `[1,[2]]`, []string{"1", "[2]"}},
+		{".[]", `{"b":2,"a":1}`, []string{"1", "2"}},
+		{".a[].b", `{"a":[{"b":1},{"b":2}]}`, []string{"1", "2"}},
+		{".[.i]", `{"i":"j","j":3}`, []string{"3"}},
+		{"[..]", `[[1]]`, []string{"[[[1]],[1],1]"}},
+		// 管道、逗号和 //
+		{".a | .b", `{"a":{"b":1}}`, []string{"1"}},
+		{".a, .b", `{"a":1,"b":2}`, []string{"1", "2"}},
+		{".a // .b", `{"a":null,"b":2}`, []string{"2"}},
+		{".a // .b", `{"a":false,"b":2}`, []string{"2"}},
+		{".a // .b", `{"a":0,"b":2}`, []string{"0"}},
+		{"(.[] | select(. > 1)) // 0", `[1,2,3]`, []string{"2", "3"}},
+		{".a.b // 1", `{"a":"x"}`, []string{"1"}},
+		{"empty // 1", `null`, []string{"1"}},
+		// 运算
+		{"1 + 2 * 3 - 4 / 2", `null`, []string{"5"}},
+		{"7 % 3, -.a", `{"a":1}`, []string{"1", "-1"}},
+		{`"a" + "b", [1] + [2], {"a":1} + {"b":2}, null + 1`, `null`, []string{`"ab"`, "[1,2]", `{"a":1,"b":2}`, "1"}},
+		{"[1,2,3,2] - [2]", `null`, []string{"[1,3]"}},
+		{`{"a":{"b":1}} * {"a":{"c":2}}`, `null`, []string{`{"a":{"b":1,"c":2}}`}},
+		{`"a,b" / ","`, `null`, []string{`["a","b"]`}},
+		{"(1,2) + (10,20)", `null`, []string{"11", "12", "21", "22"}},
+		{".a == 1, .a != 1, .a < 2, .a >= 2", `{"a":1}`, []string{"true", "false", "true", "false"}},
+		{"null < false, false < 0, 0 < \"\", \"\" < [], [] < {}", `null`, []string{"true", "true", "true", "true", "true"}},
+		{".a and .b, .a or .b", `{"a":true,"b":null}`, []string{"false", "true"}},
+		{"not, (1 | not), ([] | not)", `false`, []string{"true", "false", "false"}},
+		// 构造
+		{"[.[] | . * 2]", `[1,2]`, []string{"[2,4]"}},
+		{"[]", `null`, []string{"[]"}},
+		{`{a, "b": .c, (.k): 1}`, `{"a":1,"c":3,"k":"d"}`, []string{`{"a":1,"b":3,"d":1}`}},
+		{`{a: (1,2)}`, `null`, []string{`{"a":1}`, `{"a":2}`}},
+		{`{"x\(.a)": .a | . + 1}`, `{"a":1}`, []string{`{"x1":2}`}},
+		{`"a\(.b)c\(1 + 1)"`, `{"b":[1]}`, []string{`"a[1]c2"`}},
+		{`@base64 "x\(.)"`, `"hi"`, []string{`"xaGk="`}},
+		{`@json, @text, @csv`, `[1,"a\"b",null]`, []string{`"[1,\"a\\\"b\",null]"`, `"[1,\"a\\\"b\",null]"`, `"1,\"a\"\"b\","`}},
+		// 条件、变量、reduce 和 try
+		{`if . > 1 then "big" elif . > 0 then "small" else "none" end`, `1`, []string{`"small"`}},
+		{`if . then 1 end`, `false`, []string{"false"}},
+		{". as $x | [$x, .]", `1`, []string{"[1,1]"}},
+		{".[] as $x | $x * 2", `[1,2]`, []string{"2", "4"}},
+		{"reduce .[] as $x (0; . + $x)", `[1,2,3]`, []string{"6"}},
+		{`try error("x") catch .`, `null`, []string{`"x"`}},
+		{`try (1, error("x"), 3)`, `null`, []string{"1"}},
+		{`.[] | .a?`, `[1,{"a":2}]`, []string{"2"}},
+		{`[.[] | tonumber?]`, `["1","x"]`, []string{"[1]"}},
+		// 函数
+		{`.a | join("#")`, `{"a":["x",1,null,true]}`, []string{`"x#1##true"`}},
+		{"length", `"红楼梦"`, []string{"3"}},
+		{"[.[] | length]", `[null,-2,[1],{"a":1}]`, []string{"[0,2,1,1]"}},
+		{"keys, has(\"a\"), has(\"z\")", `{"b":1,"a":2}`, []string{`["a","b"]`, "true", "false"}},
+		{"map(. + 1), map_values(empty)", `[1,2]`, []string{"[2,3]", "[]"}},
+		{"map(select(. > 1))", `[1,2,3]`, []string{"[2,3]"}},
+		{"add, any, all", `[1,null]`, []string{"1", "true", "false"}},
+		{"sort, unique, min, max, reverse", `[3,1,3]`, []string{"[1,3,3]", "[1,3]", "1", "3", "[3,1,3]"}},
+		{"sort_by(.a) | map(.b)", `[{"a":2,"b":"x"},{"a":1,"b":"y"}]`, []string{`["y","x"]`}},
+		{"group_by(.a) | map(length)", `[{"a":2},{"a":1},{"a":2}]`, []string{"[1,2]"}},
+		{"to_entries", `{"a":1}`, []string{`[{"key":"a","value":1}]`}},
+		{`to_entries | map(.value + 1) | add`, `{"a":1,"b":2}`, []string{"5"}},
+		{`from_entries`, `[{"key":"a","value":1},{"k":"b","v":2},{"name":1,"value":3}]`, []string{`{"1":3,"a":1,"b":2}`}},
+		{`with_entries(select(.value > 1))`, `{"a":1,"b":2}`, []string{`{"b":2}`}},
+		{`split(","), ascii_upcase, ltrimstr("a"), startswith("a"), test("^a,")`, `"a,b"`, []string{`["a","b"]`, `"A,B"`, `",b"`, "true", "true"}},
+		{"tostring, tojson, (tojson | fromjson)", `{"a":1}`, []string{`"{\"a\":1}"`, `"{\"a\":1}"`, `{"a":1}`}},
+		{`"1.5" | tonumber`, `null`, []string{"1.5"}},
+		{"[range(3)], [range(1; 3)], [limit(2; .[])], first(.[]), last(.[])", `[4,5,6]`, []string{"[0,1,2]", "[1,2]", "[4,5]", "4", "6"}},
+		{"first, last, flatten, contains([[1]])", `[[1],[2,[3]]]`, []string{"[1]", "[2,[3]]", "[1,2,3]", "true"}},
+		{`contains("bar"), contains({"a":"x"})?`, `"foobar"`, []string{"true"}},
+		{`getpath(["a","b"]), type, (.a | floor?)`, `{"a":{"b":1}}`, []string{"1", `"object"`}},
+		{"1.5 | floor, ceil, round", `null`, []string{"1", "2", "2"}},
+		{"# 注释\n.a # 取a", `{"a":1}`, []string{"1"}},
+	} {
+		outputs, err := run(t, c.filter, c.input)
+		require.NoError(t, err, c.filter)
+		require.Equal(t, c.outputs, outputs, c.filter)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, c := range []struct {
+		filter, input, err string
+	}{
+		{".a", `[1]`, `cannot index array with "a"`},
+		{".[0]", `{"a":1}`, "cannot index object with number"},
+		{".[]", `1`, "cannot iterate over number"},
+		{`.a + 1`, `{"a":"x"}`, `string ("x") and number (1) cannot be added`},
+		{"1 / 0", `null`, "number (1) and number (0) cannot be divided because the divisor is zero"},
+		{"fromjson", `"{"`, `"{" cannot be parsed as json: unexpected end of JSON input`},
+		{`join(",")`, `[[1]]`, "cannot join with array ([1])"},
+		{`error("boom")`, `null`, "boom"},
+		{`error({"a":1})`, `null`, `{"a":1} (not a string)`},
+		{`{(.a): 1}`, `{"a":1}`, "object keys should be strings, got number"},
+		{`try error("x") catch error("y")`, `null`, "y"},
+	} {
+		outputs, err := run(t, c.filter, c.input)
+		require.EqualError(t, err, c.err, c.filter)
+		require.Empty(t, outputs, c.filter)
+	}
+	// 错误之前的输出仍然返回
+	outputs, err := Eval(".[] | .a", []interface{}{map[string]interface{}{"a": 1.0}, 2.0})
+	require.EqualError(t, err, "cannot index number with \"a\"")
+	require.Equal(t, []interface{}{1.0}, outputs)
+	var valueErr *ValueError
+	_, err = Eval(`error({"a":1})`, nil)
+	require.ErrorAs(t, err, &valueErr)
+	require.Equal(t, map[string]interface{}{"a": 1.0}, valueErr.Value)
+}
+
+// TestEvalDownstreamErrors tests that try and // don't catch the errors after them in a pipe
+func TestEvalDownstreamErrors(t *testing.T) {
+	_, err := run(t, `try .a | error("after")`, `{"a":1}`)
+	require.EqualError(t, err, "after")
+	_, err = run(t, `(.a // 1) | error("after")`, `{"a":1}`)
+	require.EqualError(t, err, "after")
+	outputs, err := run(t, `first(.[] | try error("x") catch .), [limit(2; .[] | . * 10)]`, `[1,2,3]`)
+	require.NoError(t, err)
+	require.Equal(t, []string{`"x"`, "[10,20]"}, outputs)
+}
+
+func TestRunJSON(t *testing.T) {
+	q, err := Parse(".a")
+	require.NoError(t, err)
+	_, err = q.RunJSON([]byte("{"))
+	require.EqualError(t, err, "invalid json input: unexpected end of JSON input")
+	outputs, err := q.RunJSON([]byte(`{"a":"<&>"}`))
+	require.NoError(t, err)
+	require.Equal(t, []json.RawMessage{json.RawMessage(`"<&>"`)}, outputs)
+	require.Equal(t, ".a", q.String())
+}
@@ -0,0 +1,89 @@
+package jq
+
+import "math"
+
+// InputIndex is a constant index into the input of a query, like .[1]
+type InputIndex struct {
+	Index int
+	// Offset 是 .[n] 在filter中的字节偏移
+	Offset int
+}
+
+// InputIndexes returns the constant indexes applied to the input of the query
+// itself, not to the values piped or iterated from it. Indexes in the
+// arguments of functions are not included.
+func (q *Query) InputIndexes() []InputIndex {
+	var indexes []InputIndex
+	walkInput(q.root, true, &indexes)
+	return indexes
+}
+
+// walkInput collects the input indexes in n. onInput is true if n runs on the input of the query.
+func walkInput(n node, onInput bool, indexes *[]InputIndex) {
+	switch n := n.(type) {
+	case *indexNode:
+		if lit, ok := n.key.(*literalNode); ok && onInput {
+			if _, ok := n.term.(identityNode); ok {
+				if f, ok := lit.value.(float64); ok {
+					*indexes = append(*indexes, InputIndex{Index: int(math.Floor(f)), Offset: n.offset})
+				}
+			}
+		}
+		walkInput(n.term, onInput, indexes)
+		walkInput(n.key, onInput, indexes)
+	case *sliceNode:
+		walkInput(n.term, onInput, indexes)
+		walkInput(n.from, onInput, indexes)
+		walkInput(n.to, onInput, indexes)
+	case *iterateNode:
+		walkInput(n.term, onInput, indexes)
+	case *stringNode:
+		for _, part := range n.parts {
+			walkInput(part.expr, onInput, indexes)
+		}
+	case *tryNode:
+		walkInput(n.body, onInput, indexes)
+		// catch 的输入是错误
+		walkInput(n.handler, false, indexes)
+	case *arrayNode:
+		walkInput(n.body, onInput, indexes)
+	case *objectNode:
+		for _, entry := range n.entries {
+			walkInput(entry.key, onInput, indexes)
+			walkInput(entry.value, onInput, indexes)
+		}
+	case *negNode:
+		walkInput(n.x, onInput, indexes)
+	case *binaryNode:
+		walkInput(n.left, onInput, indexes)
+		walkInput(n.right, onInput, indexes)
+	case *logicNode:
+		walkInput(n.left, onInput, indexes)
+		walkInput(n.right, onInput, indexes)
+	case *altNode:
+		walkInput(n.left, onInput, indexes)
+		walkInput(n.right, onInput, indexes)
+	case *commaNode:
+		walkInput(n.left, onInput, indexes)
+		walkInput(n.right, onInput, indexes)
+	case *pipeNode:
+		walkInput(n.left, onInput, indexes)
+		walkInput(n.right, false, indexes)
+	case *bindNode:
+		walkInput(n.source, onInput, indexes)
+		walkInput(n.body, onInput, indexes)
+	case *reduceNode:
+		walkInput(n.source, onInput, indexes)
+		walkInput(n.init, onInput, indexes)
+		walkInput(n.update, false, indexes)
+	case *ifNode:
+		walkInput(n.cond, onInput, indexes)
+		walkInput(n.then, onInput, indexes)
+		walkInput(n.otherwise, onInput, indexes)
+	case *callNode:
+		// 参数可能在元素上执行，例如 map(.[0])
+		for _, arg := range n.args {
+			walkInput(arg, false, indexes)
+		}
+	}
+}
@@ -0,0 +1,698 @@
+package jq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error is a syntax error in a filter
+type Error struct {
+	// Offset 是出错位置在filter中的字节偏移
+	Offset int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokIdent            // 名字和关键字
+	tokField            // .foo
+	tokVar              // $foo
+	tokFormat           // @base64
+	tokNumber
+	tokString
+	tokPunct // 运算符和括号
+)
+
+type token struct {
+	kind tokenKind
+	// text 是名字、运算符，或者字段、变量、格式去掉前缀后的名字
+	text   string
+	num    float64
+	str    *stringNode
+	offset int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokField:
+		return "." + t.text
+	case tokVar:
+		return "$" + t.text
+	case tokFormat:
+		return "@" + t.text
+	case tokNumber:
+		return strconv.FormatFloat(t.num, 'g', -1, 64)
+	case tokString:
+		return "string"
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+// keywords 不能作为函数名
+var keywords = map[string]bool{
+	"if": true, "then": true, "elif": true, "else": true, "end": true,
+	"as": true, "and": true, "or": true, "try": true, "catch": true,
+	"reduce": true, "def": true, "label": true, "import": true, "include": true, "foreach": true,
+}
+
+// punctuations 按长度从长到短匹配
+var punctuations = []string{
+	"?//", "//", "==", "!=", "<=", ">=", "..",
+	"|", ",", ".", "[", "]", "{", "}", "(", ")", ":", ";", "?",
+	"+", "-", "*", "/", "%", "<", ">", "=",
+}
+
+// parser is a recursive descent parser. It scans the next token on demand,
+// so string interpolations can be parsed while scanning a string.
+type parser struct {
+	src string
+	pos int
+	tok token
+	// vars 是当前可见的变量
+	vars []string
+}
+
+// parseBound parses a body with a variable bound
+func (p *parser) parseBound(name string, parse func() node) node {
+	p.vars = append(p.vars, name)
+	defer func() { p.vars = p.vars[:len(p.vars)-1] }()
+	return parse()
+}
+
+func (p *parser) defined(name string) bool {
+	for _, v := range p.vars {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Query is a parsed filter
+type Query struct {
+	src  string
+	root node
+}
+
+func (q *Query) String() string {
+	return q.src
+}
+
+// Parse parses a filter
+func Parse(filter string) (q *Query, err error) {
+	p := &parser{src: filter}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	p.next()
+	root := p.parsePipe()
+	if p.tok.kind != tokEOF {
+		p.errorf("unexpected %s", p.tok)
+	}
+	return &Query{src: filter, root: root}, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) {
+	panic(&Error{Offset: p.tok.offset, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) errorAt(offset int, format string, args ...interface{}) {
+	panic(&Error{Offset: offset, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) is(text string) bool {
+	return (p.tok.kind == tokPunct || p.tok.kind == tokIdent) && p.tok.text == text
+}
+
+func (p *parser) expect(text string) {
+	if !p.is(text) {
+		p.errorf("expect %q, got %s", text, p.tok)
+	}
+	p.next()
+}
+
+// next scans the next token
+func (p *parser) next() {
+	p.skipSpace()
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, offset: start}
+		return
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '"':
+		p.pos++
+		p.tok = token{kind: tokString, str: p.scanString(start), offset: start}
+	case isDigit(c):
+		p.tok = token{kind: tokNumber, num: p.scanNumber(), offset: start}
+	case isIdentStart(c):
+		p.tok = token{kind: tokIdent, text: p.scanIdent(), offset: start}
+	case c == '$' || c == '@':
+		p.pos++
+		if p.pos >= len(p.src) || !isIdentStart(p.src[p.pos]) {
+			p.errorAt(start, "expect a name after %c", c)
+		}
+		kind := tokVar
+		if c == '@' {
+			kind = tokFormat
+		}
+		p.tok = token{kind: kind, text: p.scanIdent(), offset: start}
+	case c == '.' && p.pos+1 < len(p.src) && isIdentStart(p.src[p.pos+1]):
+		p.pos++
+		p.tok = token{kind: tokField, text: p.scanIdent(), offset: start}
+	default:
+		for _, punct := range punctuations {
+			if strings.HasPrefix(p.src[p.pos:], punct) {
+				p.pos += len(punct)
+				p.tok = token{kind: tokPunct, text: punct, offset: start}
+				return
+			}
+		}
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.errorAt(start, "unexpected character %q", r)
+	}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *parser) scanIdent() string {
+	start := p.pos
+	for p.pos < len(p.src) && (isIdentStart(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) scanNumber() float64 {
+	start := p.pos
+	for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+		p.pos++
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	f, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		p.errorAt(start, "invalid number %s", p.src[start:p.pos])
+	}
+	return f
+}
+
+// scanString scans a string after the opening quote at start. \(...) is parsed as an interpolation.
+func (p *parser) scanString(start int) *stringNode {
+	s := &stringNode{}
+	var buf strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			p.errorAt(start, "unterminated string")
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			s.add(buf.String(), nil)
+			return s
+		case c == '\\':
+			if p.pos+1 >= len(p.src) {
+				p.errorAt(start, "unterminated string")
+			}
+			escape := p.src[p.pos+1]
+			p.pos += 2
+			switch escape {
+			case '"', '\\', '/':
+				buf.WriteByte(escape)
+			case 'b':
+				buf.WriteByte('\b')
+			case 'f':
+				buf.WriteByte('\f')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					p.errorAt(p.pos-2, "invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					p.errorAt(p.pos-2, "invalid unicode escape")
+				}
+				p.pos += 4
+				buf.WriteRune(rune(code))
+			case '(':
+				s.add(buf.String(), nil)
+				buf.Reset()
+				p.next()
+				s.add("", p.parsePipe())
+				if !p.is(")") {
+					p.errorf("expect \")\" to end the interpolation, got %s", p.tok)
+				}
+				// ) 之后继续扫描字符串
+			default:
+				p.errorAt(p.pos-2, "invalid escape \\%c", escape)
+			}
+		default:
+			buf.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// parsePipe parses pipes, the lowest precedence: a | b, term as $x | body
+func (p *parser) parsePipe() node {
+	left := p.parseComma()
+	if p.is("as") {
+		p.next()
+		if p.tok.kind != tokVar {
+			p.errorf("expect a variable after as, got %s", p.tok)
+		}
+		name := p.tok.text
+		p.next()
+		p.expect("|")
+		return &bindNode{source: left, name: name, body: p.parseBound(name, p.parsePipe)}
+	}
+	if p.is("|") {
+		p.next()
+		return &pipeNode{left: left, right: p.parsePipe()}
+	}
+	return left
+}
+
+func (p *parser) parseComma() node {
+	left := p.parseAlt()
+	for p.is(",") {
+		p.next()
+		left = &commaNode{left: left, right: p.parseAlt()}
+	}
+	return left
+}
+
+// parseAlt parses a // b, which is right associative
+func (p *parser) parseAlt() node {
+	left := p.parseOr()
+	if p.is("//") {
+		p.next()
+		return &altNode{left: left, right: p.parseAlt()}
+	}
+	return left
+}
+
+func (p *parser) parseOr() node {
+	left := p.parseAnd()
+	for p.is("or") {
+		p.next()
+		left = &logicNode{and: false, left: left, right: p.parseAnd()}
+	}
+	return left
+}
+
+func (p *parser) parseAnd() node {
+	left := p.parseCompare()
+	for p.is("and") {
+		p.next()
+		left = &logicNode{and: true, left: left, right: p.parseCompare()}
+	}
+	return left
+}
+
+func (p *parser) parseCompare() node {
+	left := p.parseAdditive()
+	for _, op := range []string{"==", "!=", "<", "<=", ">", ">="} {
+		if p.is(op) {
+			p.next()
+			return &binaryNode{op: op, left: left, right: p.parseAdditive()}
+		}
+	}
+	if p.is("=") {
+		p.errorf("assignment is not supported")
+	}
+	return left
+}
+
+func (p *parser) parseAdditive() node {
+	left := p.parseMultiplicative()
+	for p.is("+") || p.is("-") {
+		op := p.tok.text
+		p.next()
+		left = &binaryNode{op: op, left: left, right: p.parseMultiplicative()}
+	}
+	return left
+}
+
+func (p *parser) parseMultiplicative() node {
+	left := p.parseUnary()
+	for p.is("*") || p.is("/") || p.is("%") {
+		op := p.tok.text
+		p.next()
+		left = &binaryNode{op: op, left: left, right: p.parseUnary()}
+	}
+	return left
+}
+
+func (p *parser) parseUnary() node {
+	if p.is("-") {
+		p.next()
+		return negate(p.parsePostfix())
+	}
+	return p.parsePostfix()
+}
+
+// negate negates x, folding negative number literals
+func negate(x node) node {
+	if lit, ok := x.(*literalNode); ok {
+		if f, ok := lit.value.(float64); ok {
+			return &literalNode{value: -f}
+		}
+	}
+	return &negNode{x: x}
+}
+
+// parsePostfix parses a term followed by field accesses, indexes, slices, iterations and ?
+func (p *parser) parsePostfix() node {
+	start := p.tok.offset
+	term := p.parsePrimary()
+	for {
+		switch {
+		case p.tok.kind == tokField:
+			term = &indexNode{term: term, key: &literalNode{value: p.tok.text}}
+			p.next()
+		case p.is(".") && p.peekString():
+			p.next()
+			term = &indexNode{term: term, key: p.tok.str}
+			p.next()
+		case p.is("."):
+			// .[ 和 [ 一样
+			offset := p.tok.offset
+			p.next()
+			if !p.is("[") {
+				p.errorAt(offset, "unexpected \".\"")
+			}
+		case p.is("["):
+			// .[n] 的位置是 . 的位置
+			offset := p.tok.offset
+			if _, ok := term.(identityNode); ok {
+				offset = start
+			}
+			term = p.parseBracket(term, offset)
+		case p.is("?"):
+			p.next()
+			term = &tryNode{body: term}
+		default:
+			return term
+		}
+	}
+}
+
+// peekString checks if the token after the current one is a string, as in ."foo"
+func (p *parser) peekString() bool {
+	pos := p.pos
+	for pos < len(p.src) && (p.src[pos] == ' ' || p.src[pos] == '\t') {
+		pos++
+	}
+	return pos < len(p.src) && p.src[pos] == '"'
+}
+
+// parseBracket parses [], [e], [e:], [:e] and [e:e] after a term at offset
+func (p *parser) parseBracket(term node, offset int) node {
+	p.expect("[")
+	if p.is("]") {
+		p.next()
+		return &iterateNode{term: term}
+	}
+	var from, to node
+	if !p.is(":") {
+		from = p.parsePipe()
+	}
+	if p.is(":") {
+		p.next()
+		if !p.is("]") {
+			to = p.parsePipe()
+		}
+		p.expect("]")
+		return &sliceNode{term: term, from: from, to: to}
+	}
+	p.expect("]")
+	return &indexNode{term: term, key: from, offset: offset}
+}
+
+func (p *parser) parsePrimary() node {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		return &literalNode{value: tok.num}
+	case tokString:
+		p.next()
+		if tok.str.isLiteral() {
+			return &literalNode{value: tok.str.literal()}
+		}
+		return tok.str
+	case tokField:
+		p.next()
+		return &indexNode{term: identityNode{}, key: &literalNode{value: tok.text}}
+	case tokVar:
+		if !p.defined(tok.text) {
+			p.errorf("$%s is not defined", tok.text)
+		}
+		p.next()
+		return &varNode{name: tok.text}
+	case tokFormat:
+		p.next()
+		if _, ok := formats[tok.text]; !ok {
+			p.errorAt(tok.offset, "@%s is not a valid format", tok.text)
+		}
+		if p.tok.kind == tokString {
+			str := p.tok.str
+			p.next()
+			return &stringNode{parts: str.parts, format: tok.text}
+		}
+		return &formatNode{name: tok.text}
+	case tokIdent:
+		return p.parseIdent()
+	}
+	switch {
+	case p.is("."):
+		p.next()
+		if p.tok.kind == tokString {
+			key := p.tok.str
+			p.next()
+			return &indexNode{term: identityNode{}, key: key}
+		}
+		return identityNode{}
+	case p.is(".."):
+		p.next()
+		return recurseNode{}
+	case p.is("("):
+		p.next()
+		body := p.parsePipe()
+		p.expect(")")
+		return body
+	case p.is("["):
+		p.next()
+		if p.is("]") {
+			p.next()
+			return &arrayNode{}
+		}
+		body := p.parsePipe()
+		p.expect("]")
+		return &arrayNode{body: body}
+	case p.is("{"):
+		return p.parseObject()
+	case p.is("-"):
+		p.next()
+		return negate(p.parsePostfix())
+	}
+	p.errorf("unexpected %s", tok)
+	return nil
+}
+
+func (p *parser) parseIdent() node {
+	tok := p.tok
+	switch tok.text {
+	case "true", "false":
+		p.next()
+		return &literalNode{value: tok.text == "true"}
+	case "null":
+		p.next()
+		return &literalNode{value: nil}
+	case "if":
+		return p.parseIf()
+	case "try":
+		p.next()
+		body := p.parsePostfix()
+		var handler node
+		if p.is("catch") {
+			p.next()
+			handler = p.parsePostfix()
+		}
+		return &tryNode{body: body, handler: handler}
+	case "reduce":
+		p.next()
+		source := p.parsePostfix()
+		p.expect("as")
+		if p.tok.kind != tokVar {
+			p.errorf("expect a variable after as, got %s", p.tok)
+		}
+		name := p.tok.text
+		p.next()
+		p.expect("(")
+		init := p.parsePipe()
+		p.expect(";")
+		update := p.parseBound(name, p.parsePipe)
+		p.expect(")")
+		return &reduceNode{source: source, name: name, init: init, update: update}
+	}
+	if keywords[tok.text] {
+		p.errorf("%s is not supported here", tok.text)
+	}
+	p.next()
+	var args []node
+	if p.is("(") {
+		p.next()
+		for {
+			args = append(args, p.parsePipe())
+			if p.is(";") {
+				p.next()
+				continue
+			}
+			p.expect(")")
+			break
+		}
+	}
+	fn, ok := functions[fmt.Sprintf("%s/%d", tok.text, len(args))]
+	if !ok {
+		p.errorAt(tok.offset, "%s/%d is not defined", tok.text, len(args))
+	}
+	return &callNode{name: tok.text, fn: fn, args: args}
+}
+
+func (p *parser) parseIf() node {
+	p.expect("if")
+	cond := p.parsePipe()
+	p.expect("then")
+	then := p.parsePipe()
+	n := &ifNode{cond: cond, then: then}
+	switch {
+	case p.is("elif"):
+		// elif 当作 else 中嵌套的 if
+		p.tok.text = "if"
+		n.otherwise = p.parseIf()
+		return n
+	case p.is("else"):
+		p.next()
+		n.otherwise = p.parsePipe()
+	}
+	p.expect("end")
+	return n
+}
+
+// parseObject parses {a, "b": 1, $c, (.d): 2, "\(.e)": 3}
+func (p *parser) parseObject() node {
+	p.expect("{")
+	obj := &objectNode{}
+	for !p.is("}") {
+		var entry objectEntry
+		tok := p.tok
+		switch {
+		case tok.kind == tokIdent:
+			entry.key = &literalNode{value: tok.text}
+			entry.value = &indexNode{term: identityNode{}, key: entry.key}
+			p.next()
+		case tok.kind == tokVar:
+			if !p.defined(tok.text) {
+				p.errorf("$%s is not defined", tok.text)
+			}
+			entry.key = &literalNode{value: tok.text}
+			entry.value = &varNode{name: tok.text}
+			p.next()
+		case tok.kind == tokString:
+			if tok.str.isLiteral() {
+				entry.key = &literalNode{value: tok.str.literal()}
+			} else {
+				entry.key = tok.str
+			}
+			entry.value = &indexNode{term: identityNode{}, key: entry.key}
+			p.next()
+		case tok.kind == tokNumber:
+			p.errorf("object keys should be strings")
+		case p.is("("):
+			p.next()
+			entry.key = p.parsePipe()
+			p.expect(")")
+			entry.value = nil
+		default:
+			p.errorf("unexpected %s in object", tok)
+		}
+		if p.is(":") {
+			p.next()
+			entry.value = p.parseObjectValue()
+		} else if entry.value == nil {
+			p.errorf("expect \":\" after the computed key, got %s", p.tok)
+		}
+		obj.entries = append(obj.entries, entry)
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect("}")
+	return obj
+}
+
+// parseObjectValue parses the value of an object entry, which can't contain
+// commas without parentheses, but can be piped
+func (p *parser) parseObjectValue() node {
+	left := p.parseAlt()
+	if p.is("|") {
+		p.next()
+		return &pipeNode{left: left, right: p.parseObjectValue()}
+	}
+	return left
+}
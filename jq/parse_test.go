@@ -0,0 +1,77 @@
+package jq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for _, filter := range []string{
+		".",
+		".a.b[0][1:][]?",
+		`."a"."b"`,
+		`.a | .["b"] | .[.c]`,
+		`{a, $x, "b": 1, (.c): 2, "\(.d)": 3, e: .f | not}`,
+		"[.[] | select(.a > 1)] | length",
+		`if .a then 1 elif .b then 2 else 3 end`,
+		"reduce .[] as $x (0; . + $x)",
+		"try .a catch .",
+		`@base64 "\(.a)"`,
+		"-.a + -1",
+		"..",
+	} {
+		// $x 在最外层没有定义，用 as 绑定
+		_, err := Parse(". as $x | " + filter)
+		require.NoError(t, err, filter)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct {
+		filter string
+		err    string
+	}{
+		{"", "offset 0: unexpected end of filter"},
+		{".a |", "offset 4: unexpected end of filter"},
+		{".a.", `offset 2: unexpected "."`},
+		{"(.a", `offset 3: expect ")", got end of filter`},
+		{"[.a", `offset 3: expect "]", got end of filter`},
+		{`{"a" 1}`, `offset 5: expect "}", got 1`},
+		{`{1: 2}`, "offset 1: object keys should be strings"},
+		{`{(.a)}`, `offset 5: expect ":" after the computed key, got "}"`},
+		{`"abc`, "offset 0: unterminated string"},
+		{`"a\x"`, `offset 2: invalid escape \x`},
+		{`"\(.a ]"`, `offset 6: expect ")" to end the interpolation, got "]"`},
+		{".a | joni(\",\")", "offset 5: joni/1 is not defined"},
+		{"join", "offset 0: join/0 is not defined"},
+		{"$x", "offset 0: $x is not defined"},
+		{". as $x | $y", "offset 10: $y is not defined"},
+		{"reduce .[] as $x (0; $x) | $x", "offset 27: $x is not defined"},
+		{".a = 1", "offset 3: assignment is not supported"},
+		{"def f: .; f", "offset 0: def is not supported here"},
+		{"if . then 1", `offset 11: expect "end", got end of filter`},
+		{"@foo", "offset 0: @foo is not a valid format"},
+		{".a ! .b", `offset 3: unexpected character '!'`},
+		{".a b", `offset 3: unexpected "b"`},
+	} {
+		_, err := Parse(c.filter)
+		require.EqualError(t, err, c.err, c.filter)
+		var syntaxErr *Error
+		require.ErrorAs(t, err, &syntaxErr)
+	}
+}
+
+func TestInputIndexes(t *testing.T) {
+	for filter, indexes := range map[string][]InputIndex{
+		`{"key": .[0], "payload": .[1], "ttl": 259200000}`: {{Index: 0, Offset: 8}, {Index: 1, Offset: 25}},
+		`[.[0], .[1]] | (.[2])`:                            {{Index: 0, Offset: 1}, {Index: 1, Offset: 7}},
+		`.[-1] // .[3].a, (.[2] as $x | .[4])`:             {{Index: -1, Offset: 0}, {Index: 3, Offset: 9}, {Index: 2, Offset: 18}, {Index: 4, Offset: 31}},
+		`.a[0], .[.i], map(.[5]), .[] | .[6]`:              nil,
+		`reduce .[0][] as $x (.[1]; .[7])`:                 {{Index: 0, Offset: 7}, {Index: 1, Offset: 21}},
+	} {
+		q, err := Parse(filter)
+		require.NoError(t, err)
+		require.Equal(t, indexes, q.InputIndexes(), filter)
+	}
+}
@@ -0,0 +1,492 @@
+package jq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 值都是 encoding/json 解析出的类型：nil, bool, float64, string, []interface{}, map[string]interface{}
+
+// ValueError is an error raised while evaluating a filter. Value is the
+// error value, which try ... catch passes to its handler.
+type ValueError struct {
+	Value interface{}
+}
+
+func (e *ValueError) Error() string {
+	if s, ok := e.Value.(string); ok {
+		return s
+	}
+	return toJSON(e.Value) + " (not a string)"
+}
+
+func errorf(format string, args ...interface{}) error {
+	return &ValueError{Value: fmt.Sprintf(format, args...)}
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("invalid value %T", v)
+}
+
+// typeOrder is the order of types when comparing values of different types
+func typeOrder(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	}
+	return 6
+}
+
+func truthy(v interface{}) bool {
+	return v != nil && v != false
+}
+
+// compare orders values like jq: null < false < true < numbers < strings < arrays < objects.
+// Objects are compared by their sorted keys first, then by the values of the keys.
+func compare(a, b interface{}) int {
+	if ta, tb := typeOrder(a), typeOrder(b); ta != tb {
+		return ta - tb
+	}
+	switch a := a.(type) {
+	case float64:
+		b := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case []interface{}:
+		b := b.([]interface{})
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if c := compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+		return len(a) - len(b)
+	case map[string]interface{}:
+		b := b.(map[string]interface{})
+		ka, kb := sortedKeys(a), sortedKeys(b)
+		if c := compare(stringsToValues(ka), stringsToValues(kb)); c != 0 {
+			return c
+		}
+		for _, k := range ka {
+			if c := compare(a[k], b[k]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringsToValues(s []string) []interface{} {
+	values := make([]interface{}, len(s))
+	for i, v := range s {
+		values[i] = v
+	}
+	return values
+}
+
+// binary applies an arithmetic or comparison operator
+func binary(op string, l, r interface{}) (interface{}, error) {
+	switch op {
+	case "+":
+		return add(l, r)
+	case "-":
+		return subtract(l, r)
+	case "*":
+		return multiply(l, r)
+	case "/":
+		return divide(l, r)
+	case "%":
+		return modulo(l, r)
+	case "==":
+		return compare(l, r) == 0, nil
+	case "!=":
+		return compare(l, r) != 0, nil
+	case "<":
+		return compare(l, r) < 0, nil
+	case "<=":
+		return compare(l, r) <= 0, nil
+	case ">":
+		return compare(l, r) > 0, nil
+	case ">=":
+		return compare(l, r) >= 0, nil
+	}
+	return nil, errorf("unknown operator %s", op)
+}
+
+func operandError(l, r interface{}, verb string) error {
+	return errorf("%s (%s) and %s (%s) cannot be %s", typeName(l), brief(l), typeName(r), brief(r), verb)
+}
+
+// brief returns the json of a value for error messages
+func brief(v interface{}) string {
+	s := toJSON(v)
+	if len(s) > 30 {
+		return s[:27] + "..."
+	}
+	return s
+}
+
+func add(l, r interface{}) (interface{}, error) {
+	if l == nil {
+		return r, nil
+	}
+	if r == nil {
+		return l, nil
+	}
+	switch l := l.(type) {
+	case float64:
+		if r, ok := r.(float64); ok {
+			return l + r, nil
+		}
+	case string:
+		if r, ok := r.(string); ok {
+			return l + r, nil
+		}
+	case []interface{}:
+		if r, ok := r.([]interface{}); ok {
+			sum := make([]interface{}, 0, len(l)+len(r))
+			return append(append(sum, l...), r...), nil
+		}
+	case map[string]interface{}:
+		if r, ok := r.(map[string]interface{}); ok {
+			sum := make(map[string]interface{}, len(l)+len(r))
+			for k, v := range l {
+				sum[k] = v
+			}
+			for k, v := range r {
+				sum[k] = v
+			}
+			return sum, nil
+		}
+	}
+	return nil, operandError(l, r, "added")
+}
+
+func subtract(l, r interface{}) (interface{}, error) {
+	switch l := l.(type) {
+	case float64:
+		if r, ok := r.(float64); ok {
+			return l - r, nil
+		}
+	case []interface{}:
+		if r, ok := r.([]interface{}); ok {
+			diff := []interface{}{}
+		next:
+			for _, v := range l {
+				for _, w := range r {
+					if compare(v, w) == 0 {
+						continue next
+					}
+				}
+				diff = append(diff, v)
+			}
+			return diff, nil
+		}
+	}
+	return nil, operandError(l, r, "subtracted")
+}
+
+func multiply(l, r interface{}) (interface{}, error) {
+	switch l := l.(type) {
+	case float64:
+		switch r := r.(type) {
+		case float64:
+			return l * r, nil
+		case string:
+			return repeat(r, l), nil
+		}
+	case string:
+		if r, ok := r.(float64); ok {
+			return repeat(l, r), nil
+		}
+	case map[string]interface{}:
+		if r, ok := r.(map[string]interface{}); ok {
+			return deepMerge(l, r), nil
+		}
+	}
+	return nil, operandError(l, r, "multiplied")
+}
+
+// repeat repeats a string n times, or returns null if n <= 0
+func repeat(s string, n float64) interface{} {
+	if n <= 0 {
+		return nil
+	}
+	return strings.Repeat(s, int(math.Ceil(n)))
+}
+
+func deepMerge(l, r map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(l)+len(r))
+	for k, v := range l {
+		merged[k] = v
+	}
+	for k, v := range r {
+		lv, lok := merged[k].(map[string]interface{})
+		rv, rok := v.(map[string]interface{})
+		if lok && rok {
+			merged[k] = deepMerge(lv, rv)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func divide(l, r interface{}) (interface{}, error) {
+	switch l := l.(type) {
+	case float64:
+		if r, ok := r.(float64); ok {
+			if r == 0 {
+				return nil, operandError(l, r, "divided because the divisor is zero")
+			}
+			return l / r, nil
+		}
+	case string:
+		if r, ok := r.(string); ok {
+			return split(l, r), nil
+		}
+	}
+	return nil, operandError(l, r, "divided")
+}
+
+func modulo(l, r interface{}) (interface{}, error) {
+	a, lok := l.(float64)
+	b, rok := r.(float64)
+	if !lok || !rok {
+		return nil, operandError(l, r, "divided")
+	}
+	if int64(b) == 0 {
+		return nil, operandError(l, r, "divided because the divisor is zero")
+	}
+	return float64(int64(a) % int64(b)), nil
+}
+
+func split(s, sep string) []interface{} {
+	if s == "" {
+		return []interface{}{}
+	}
+	return stringsToValues(strings.Split(s, sep))
+}
+
+// index returns v[k]
+func index(v, k interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		switch k.(type) {
+		case string, float64, nil:
+			return nil, nil
+		}
+	case map[string]interface{}:
+		if k, ok := k.(string); ok {
+			return v[k], nil
+		}
+	case []interface{}:
+		if k, ok := k.(float64); ok {
+			i := int(math.Floor(k))
+			if i < 0 {
+				i += len(v)
+			}
+			if i < 0 || i >= len(v) {
+				return nil, nil
+			}
+			return v[i], nil
+		}
+	}
+	if k, ok := k.(string); ok {
+		return nil, errorf("cannot index %s with %q", typeName(v), k)
+	}
+	return nil, errorf("cannot index %s with %s", typeName(v), typeName(k))
+}
+
+// slice returns v[from:to], from and to are null or numbers
+func slice(v, from, to interface{}) (interface{}, error) {
+	var length int
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		length = utf8.RuneCountInString(v)
+	case []interface{}:
+		length = len(v)
+	default:
+		return nil, errorf("cannot slice %s", typeName(v))
+	}
+	bound := func(b interface{}, def int, round func(float64) float64) (int, error) {
+		if b == nil {
+			return def, nil
+		}
+		f, ok := b.(float64)
+		if !ok {
+			return 0, errorf("start and end indices of a slice should be numbers")
+		}
+		i := int(round(f))
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			return 0, nil
+		}
+		if i > length {
+			return length, nil
+		}
+		return i, nil
+	}
+	start, err := bound(from, 0, math.Floor)
+	if err != nil {
+		return nil, err
+	}
+	end, err := bound(to, length, math.Ceil)
+	if err != nil {
+		return nil, err
+	}
+	if end < start {
+		end = start
+	}
+	if s, ok := v.(string); ok {
+		runes := []rune(s)
+		return string(runes[start:end]), nil
+	}
+	return append([]interface{}{}, v.([]interface{})[start:end]...), nil
+}
+
+// iterate emits the elements of an array or the values of an object by key order
+func iterate(v interface{}, emit emitter) error {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, elem := range v {
+			if err := emit(elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			if err := emit(v[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errorf("cannot iterate over %s", typeName(v))
+}
+
+// toText returns a string as it is and other values as json
+func toText(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return toJSON(v)
+}
+
+// toJSON encodes a value as compact json with sorted object keys. NaN is
+// encoded as null and infinities as the largest numbers like jq.
+func toJSON(v interface{}) string {
+	var buf bytes.Buffer
+	writeJSON(&buf, v)
+	return buf.String()
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			buf.WriteString("null")
+		case math.IsInf(v, 1):
+			buf.WriteString("1.7976931348623157e+308")
+		case math.IsInf(v, -1):
+			buf.WriteString("-1.7976931348623157e+308")
+		default:
+			data, _ := json.Marshal(v)
+			buf.Write(data)
+		}
+	case string:
+		writeString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSON(buf, elem)
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		buf.WriteByte('{')
+		for i, k := range sortedKeys(v) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeString(buf, k)
+			buf.WriteByte(':')
+			writeJSON(buf, v[k])
+		}
+		buf.WriteByte('}')
+	default:
+		// 不是 encoding/json 解析出的类型，交给 encoding/json
+		data, err := json.Marshal(v)
+		if err != nil {
+			buf.WriteString("null")
+			return
+		}
+		buf.Write(data)
+	}
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	// 不转义 <>&，和jq一致
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	buf.Truncate(buf.Len() - 1)
+}
@@ -0,0 +1,43 @@
+package lsp
+
+import "strings"
+
+// builtinOp describes a builtin op for completion
+type builtinOp struct {
+	name string
+	doc  string
+	args []string
+}
+
+// builtinOps 是 gflow 支持的内建任务，when_true、when_false 和 when_any 由 if 生成，不能直接调用
+var builtinOps = []builtinOp{
+	{"http", "Sends the input to an http endpoint and outputs the response body.",
+		[]string{"endpoint", "method", "max_retry_times", "default_value", "timeout"}},
+	{"identity", "Outputs its input.", nil},
+	{"jq", "Transforms the input with a jq filter. Several inputs are merged into a json array.",
+		[]string{"filter"}},
+	{"lookup_cache", "Looks up the input key in the cache and outputs `{\"found\": bool, \"payload\": ...}`.",
+		[]string{"prefix"}},
+	{"set_cache", "Stores the input `{\"key\", \"payload\", \"ttl\"}` in the cache.",
+		[]string{"prefix"}},
+}
+
+func lookupBuiltin(name string) *builtinOp {
+	for i := range builtinOps {
+		if builtinOps[i].name == name {
+			return &builtinOps[i]
+		}
+	}
+	return nil
+}
+
+// signature returns how the op is called in dagl
+func (op *builtinOp) signature() string {
+	var buf strings.Builder
+	buf.WriteString(`builtin("` + op.name + `", input`)
+	for _, arg := range op.args {
+		buf.WriteString(", " + arg + "=...")
+	}
+	buf.WriteString(")")
+	return buf.String()
+}
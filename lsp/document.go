@@ -0,0 +1,141 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/generators"
+	"github.com/vuuihc/gfc/parser"
+	"github.com/vuuihc/gfc/symbols"
+)
+
+// document is an open dagl file and the result of analyzing it
+type document struct {
+	uri   string
+	text  string
+	lines []string
+	// statements 是解析出的语句，有语法错误时是出错之前的顶层语句
+	statements  []parser.Statement
+	symbols     *symbols.File
+	diagnostics []diagnostic
+}
+
+// newDocument parses and compiles a document, reporting the first error as a diagnostic
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, text: text, lines: strings.Split(text, "\n")}
+	statements, err := parser.NewParser(text).TryParse()
+	d.statements = statements
+	d.symbols = symbols.Resolve(statements)
+	if err == nil {
+		err = generate(statements)
+	}
+	d.diagnostics = []diagnostic{}
+	if err != nil {
+		var pos parser.Pos
+		var e *parser.Error
+		msg := err.Error()
+		if errors.As(err, &e) {
+			pos, msg = e.Pos, e.Msg
+		}
+		d.diagnostics = append(d.diagnostics, diagnostic{
+			Range:    d.tokenRange(pos),
+			Severity: severityError,
+			Source:   "daglc",
+			Message:  msg,
+		})
+	}
+	return d
+}
+
+// generate compiles the statements to find generator errors
+func generate(statements []parser.Statement) (err error) {
+	// 编辑中的代码可能让生成器出现意料之外的错误，不能让服务器退出
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("internal error: %v", r)
+		}
+	}()
+	_, err = generators.NewGFGenerator(statements).Generate()
+	return err
+}
+
+// position converts a parser position to an LSP position, which counts utf-16 code units
+func (d *document) position(pos parser.Pos) position {
+	if !pos.IsValid() || pos.Line > len(d.lines) {
+		return position{}
+	}
+	line := d.lines[pos.Line-1]
+	column := pos.Column - 1
+	if column > len(line) {
+		column = len(line)
+	}
+	return position{Line: pos.Line - 1, Character: len(utf16.Encode([]rune(line[:column])))}
+}
+
+// pos converts an LSP position to a parser position
+func (d *document) pos(p position) parser.Pos {
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return parser.Pos{}
+	}
+	line := d.lines[p.Line]
+	column, units := 0, 0
+	for column < len(line) && units < p.Character {
+		r, size := utf8.DecodeRuneInString(line[column:])
+		column += size
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return parser.Pos{Line: p.Line + 1, Column: column + 1}
+}
+
+// offset returns the byte offset of an LSP position in the text
+func (d *document) offset(p position) int {
+	pos := d.pos(p)
+	if !pos.IsValid() {
+		return len(d.text)
+	}
+	offset := 0
+	for _, line := range d.lines[:pos.Line-1] {
+		offset += len(line) + 1
+	}
+	return offset + pos.Column - 1
+}
+
+// nameRange returns the range of a name at pos
+func (d *document) nameRange(pos parser.Pos, name string) textRange {
+	return textRange{Start: d.position(pos), End: d.position(parser.Pos{Line: pos.Line, Column: pos.Column + len(name)})}
+}
+
+// tokenRange returns the range of the identifier or string starting at pos, or of the character at pos
+func (d *document) tokenRange(pos parser.Pos) textRange {
+	if !pos.IsValid() || pos.Line > len(d.lines) || pos.Column > len(d.lines[pos.Line-1]) {
+		start := d.position(pos)
+		return textRange{Start: start, End: start}
+	}
+	line := d.lines[pos.Line-1][pos.Column-1:]
+	r, size := utf8.DecodeRuneInString(line)
+	end := size
+	switch {
+	case isIdentifier(r):
+		for end < len(line) {
+			r, size := utf8.DecodeRuneInString(line[end:])
+			if !isIdentifier(r) {
+				break
+			}
+			end += size
+		}
+	case r == '\'' || r == '"' || r == '`':
+		if i := strings.IndexRune(line[size:], r); i >= 0 {
+			end = size + i + 1
+		}
+	}
+	return d.nameRange(pos, line[:end])
+}
+
+// isIdentifier checks if r can be part of an identifier, the same as the lexer
+func isIdentifier(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
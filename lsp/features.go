@@ -0,0 +1,259 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/vuuihc/gfc/parser"
+	"github.com/vuuihc/gfc/symbols"
+)
+
+// definition returns the location of the symbol at a position
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	doc, p, err := s.document(params)
+	if err != nil {
+		return nil, err
+	}
+	ref := doc.symbols.RefAt(doc.pos(p.Position))
+	if ref == nil || ref.Symbol == nil {
+		return nil, nil
+	}
+	return location{URI: doc.uri, Range: doc.nameRange(ref.Symbol.Pos, ref.Symbol.Name)}, nil
+}
+
+// hover describes the symbol at a position: the signature and doc comment of a
+// function, the definition of a constant or a variable
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	doc, p, err := s.document(params)
+	if err != nil {
+		return nil, err
+	}
+	ref := doc.symbols.RefAt(doc.pos(p.Position))
+	if ref == nil || ref.Symbol == nil {
+		return nil, nil
+	}
+	r := doc.nameRange(ref.Pos, ref.Name)
+	return hover{Contents: markupContent{Kind: "markdown", Value: describe(ref.Symbol)}, Range: &r}, nil
+}
+
+// describe returns the markdown describing a symbol
+func describe(symbol *symbols.Symbol) string {
+	var code, note string
+	switch symbol.Kind {
+	case symbols.Func:
+		code = signature(symbol.Func)
+	case symbols.Const:
+		code = source(symbol.Stmt)
+	case symbols.Var:
+		if symbol.Param {
+			code = symbol.Name
+			note = "parameter of `" + signature(symbol.Func) + "`"
+		} else {
+			code = source(symbol.Stmt)
+			note = "variable in func " + symbol.Func.Name
+		}
+	}
+	value := "```dagl\n" + code + "\n```"
+	for _, text := range []string{note, symbol.Doc} {
+		if text != "" {
+			value += "\n\n" + text
+		}
+	}
+	return value
+}
+
+// signature returns the first line of a function definition
+func signature(fn *parser.FuncStmt) string {
+	keyword := "func"
+	if fn.Inline {
+		keyword = "inline func"
+	}
+	return fmt.Sprintf("%s %s(%s)", keyword, fn.Name, strings.Join(fn.Inputs, ", "))
+}
+
+// source prints a statement as dagl
+func source(statement parser.Statement) string {
+	var buf bytes.Buffer
+	if err := parser.Fprint(&buf, []parser.Statement{statement}); err != nil {
+		return statement.String()
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// completion completes builtin names, builtin arg names, inline function names and constants
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	doc, p, err := s.document(params)
+	if err != nil {
+		return nil, err
+	}
+	ctx := completionAt(doc.text[:doc.offset(p.Position)])
+	items := []completionItem{}
+	switch ctx.kind {
+	case completeBuiltin:
+		for _, op := range builtinOps {
+			items = append(items, completionItem{
+				Label:         op.name,
+				Kind:          completionFunction,
+				Detail:        op.signature(),
+				Documentation: &markupContent{Kind: "markdown", Value: op.doc},
+			})
+		}
+	case completeArg:
+		if op := lookupBuiltin(ctx.call); op != nil {
+			for _, arg := range op.args {
+				if !ctx.used[arg] {
+					items = append(items, completionItem{Label: arg, Kind: completionField, InsertText: arg + "="})
+				}
+			}
+		}
+	case completeFunc:
+		for _, symbol := range doc.symbols.Globals(symbols.Func) {
+			if symbol.Func.Inline {
+				items = append(items, completionItem{Label: symbol.Name, Kind: completionFunction, Detail: signature(symbol.Func), Documentation: docMarkup(symbol.Doc)})
+			}
+		}
+	case completeConst:
+		items = append(items, completionItem{Label: "call", Kind: completionKeyword, InsertText: "call("})
+		for _, symbol := range doc.symbols.Globals(symbols.Const) {
+			items = append(items, completionItem{Label: symbol.Name, Kind: completionConstant, Detail: source(symbol.Stmt), Documentation: docMarkup(symbol.Doc)})
+		}
+	}
+	return items, nil
+}
+
+func docMarkup(doc string) *markupContent {
+	if doc == "" {
+		return nil
+	}
+	return &markupContent{Kind: "markdown", Value: doc}
+}
+
+// completion contexts
+const (
+	completeNone    = iota
+	completeBuiltin // builtin 的函数名字符串中
+	completeArg     // builtin 的参数名
+	completeFunc    // @call 的函数名
+	completeConst   // @ 之后的常量名
+)
+
+type completionContext struct {
+	kind int
+	// call 是参数所属的 builtin 函数名，used 是已经写过的参数
+	call string
+	used map[string]bool
+}
+
+// completionAt finds what is being typed at the end of the source before the cursor
+func completionAt(prefix string) completionContext {
+	var quote byte
+	quoteStart := 0
+	// calls 是还没有闭合的左括号的位置
+	var calls []int
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		if quote != 0 {
+			// 只有 ` 引起来的字符串可以换行
+			if c == quote || c == '\n' && quote != '`' {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote, quoteStart = c, i
+		case '(':
+			calls = append(calls, i)
+		case ')':
+			if len(calls) > 0 {
+				calls = calls[:len(calls)-1]
+			}
+		case ';', '{', '}':
+			calls = nil
+		case '/':
+			if strings.HasPrefix(prefix[i:], "//") {
+				end := strings.IndexByte(prefix[i:], '\n')
+				if end < 0 {
+					return completionContext{}
+				}
+				i += end
+			}
+		}
+	}
+	if len(calls) == 0 {
+		if quote == 0 && strings.HasSuffix(strings.TrimRightFunc(prefix, isIdentifier), "@") {
+			return completionContext{kind: completeConst}
+		}
+		return completionContext{}
+	}
+	open := calls[len(calls)-1]
+	// callee 是左括号前的 builtin、model 或者 @call
+	before := strings.TrimSpace(prefix[:open])
+	callee := before[len(strings.TrimRightFunc(before, isIdentifier)):]
+	if strings.HasSuffix(before, "@call") {
+		callee = "@call"
+	}
+	args := prefix[open+1:]
+	if quote != 0 {
+		// 函数名是括号后的第一个字符串
+		if callee == "builtin" && strings.TrimSpace(prefix[open+1:quoteStart]) == "" {
+			return completionContext{kind: completeBuiltin}
+		}
+		return completionContext{}
+	}
+	if word := strings.TrimRightFunc(args, isIdentifier); strings.HasSuffix(word, "@") {
+		return completionContext{kind: completeConst}
+	}
+	parts, inBrackets := splitArgs(args)
+	if inBrackets {
+		return completionContext{}
+	}
+	current := strings.TrimSpace(parts[len(parts)-1])
+	switch {
+	case callee == "@call" && len(parts) == 1:
+		return completionContext{kind: completeFunc}
+	case callee == "builtin" && len(parts) >= 3 && strings.TrimRightFunc(current, isIdentifier) == "":
+		ctx := completionContext{kind: completeArg, call: strings.Trim(strings.TrimSpace(parts[0]), "'\"`"), used: make(map[string]bool)}
+		for _, part := range parts[2 : len(parts)-1] {
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				ctx.used[strings.TrimSpace(part[:i])] = true
+			}
+		}
+		return ctx
+	}
+	return completionContext{}
+}
+
+// splitArgs splits the arguments of a call at the commas outside strings and
+// brackets, and checks if the text ends inside brackets
+func splitArgs(args string) ([]string, bool) {
+	var parts []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(args); i++ {
+		c := args[i]
+		if quote != 0 {
+			// 只有 ` 引起来的字符串可以换行
+			if c == quote || c == '\n' && quote != '`' {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, args[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, args[start:]), depth > 0
+}
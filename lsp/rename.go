@@ -0,0 +1,85 @@
+package lsp
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/symbols"
+)
+
+// rename renames the symbol at a position. Functions and constants are renamed
+// in all dagl files of the workspace, variables in the document only.
+func (s *Server) rename(params json.RawMessage) (interface{}, error) {
+	var p renameParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, errors.Errorf("document %s is not open", p.TextDocument.URI)
+	}
+	ref := doc.symbols.RefAt(doc.pos(p.Position))
+	if ref == nil || ref.Symbol == nil {
+		return nil, errors.New("no symbol to rename at the position")
+	}
+	index := symbols.NewIndex()
+	// uris 是索引中的路径对应的打开文档的uri，其他文件的uri由路径生成
+	uris := make(map[string]string)
+	docs := map[string]*document{doc.uri: doc}
+	if ref.Symbol.Kind != symbols.Var {
+		if s.root != "" {
+			if err := index.AddDir(s.root); err != nil {
+				return nil, err
+			}
+		}
+		docs = s.docs
+	}
+	// 打开的文档可能还没有保存，以编辑器中的内容为准
+	for uri, d := range docs {
+		path := uriPath(uri)
+		if path == "" {
+			path = uri
+		}
+		uris[path] = uri
+		index.Add(path, d.text)
+	}
+	renames, err := index.Rename(ref.Symbol.QualifiedName(), p.NewName)
+	if err != nil {
+		return nil, err
+	}
+	edit := workspaceEdit{Changes: make(map[string][]textEdit)}
+	for path, refs := range renames {
+		uri, ok := uris[path]
+		if !ok {
+			uri = pathURI(path)
+		}
+		d := docs[uri]
+		if d == nil {
+			d = &document{lines: strings.Split(index.Source(path), "\n")}
+		}
+		for _, ref := range refs {
+			edit.Changes[uri] = append(edit.Changes[uri], textEdit{Range: d.nameRange(ref.Pos, ref.Name), NewText: p.NewName})
+		}
+	}
+	return edit, nil
+}
+
+// uriPath returns the path of a file uri, or "" for other uris
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathURI returns the file uri of a path
+func pathURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,237 @@
+// Package lsp implements a dagl language server speaking the language server protocol.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+
+	"emperror.dev/errors"
+)
+
+// Server is a dagl language server. It handles one message at a time.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+	// docs 是打开的文档，以uri为键
+	docs map[string]*document
+	// root 是工作区的根目录，改名时会搜索其中的 dagl 文件
+	root     string
+	shutdown bool
+}
+
+// NewServer creates a server reading messages from in and writing to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, docs: make(map[string]*document)}
+}
+
+// errExit 表示收到了 exit 通知
+var errExit = errors.New("exit")
+
+// Run serves until the client sends exit or closes the input.
+// It returns an error if the client exits without shutting down the server first.
+func (s *Server) Run() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.handle(msg); err == errExit {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// read reads a message framed by a Content-Length header
+func (s *Server) read() (*message, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errors.WrapIf(err, "read header")
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, errors.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, errors.WrapIf(err, "read body")
+	}
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return &message{Error: &responseError{Code: codeParseError, Message: err.Error()}}, nil
+	}
+	return msg, nil
+}
+
+// write writes a message framed by a Content-Length header
+func (s *Server) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return errors.WrapIf(err, "write message")
+}
+
+// reply responds to a request
+func (s *Server) reply(id *json.RawMessage, result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return s.write(&message{ID: id, Result: data})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, format string, args ...interface{}) error {
+	return s.write(&message{ID: id, Error: &responseError{Code: code, Message: fmt.Sprintf(format, args...)}})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.write(&message{Method: method, Params: data})
+}
+
+// handle handles a request or a notification. It only returns errExit or
+// the errors writing messages, so the server keeps serving after bad messages.
+func (s *Server) handle(msg *message) error {
+	if msg.Error != nil {
+		// 无法解析的消息，响应的id为null
+		id := json.RawMessage("null")
+		return s.write(&message{ID: &id, Error: msg.Error})
+	}
+	if msg.Method == "" {
+		// 客户端对服务器请求的响应，服务器不发请求，忽略
+		return nil
+	}
+	handler, ok := handlers[msg.Method]
+	if !ok {
+		if msg.ID == nil {
+			// 不支持的通知，如 $/cancelRequest
+			return nil
+		}
+		return s.replyError(msg.ID, codeMethodNotFound, "method %q not found", msg.Method)
+	}
+	if s.shutdown && msg.Method != "exit" && msg.ID != nil {
+		return s.replyError(msg.ID, codeInvalidRequest, "server is shut down")
+	}
+	result, err := handler(s, msg.Params)
+	if err == errExit {
+		return err
+	}
+	if msg.ID == nil {
+		if err == nil {
+			return nil
+		}
+		// 通知没有响应，错误写到客户端的日志里，继续服务
+		return s.notify("window/logMessage", logMessageParams{Type: messageError, Message: fmt.Sprintf("%s: %v", msg.Method, err)})
+	}
+	if err != nil {
+		return s.replyError(msg.ID, codeInvalidParams, "%v", err)
+	}
+	return s.reply(msg.ID, result)
+}
+
+// handlers handle the methods, the results of notifications are ignored
+var handlers = map[string]func(s *Server, params json.RawMessage) (interface{}, error){
+	"initialize":              (*Server).initialize,
+	"initialized":             func(*Server, json.RawMessage) (interface{}, error) { return nil, nil },
+	"shutdown":                (*Server).shutdownServer,
+	"exit":                    func(*Server, json.RawMessage) (interface{}, error) { return nil, errExit },
+	"textDocument/didOpen":    (*Server).didOpen,
+	"textDocument/didChange":  (*Server).didChange,
+	"textDocument/didClose":   (*Server).didClose,
+	"textDocument/definition": (*Server).definition,
+	"textDocument/hover":      (*Server).hover,
+	"textDocument/completion": (*Server).completion,
+	"textDocument/rename":     (*Server).rename,
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var p initializeParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+	}
+	s.root = uriPath(p.RootURI)
+	var result initializeResult
+	result.ServerInfo.Name = "daglc"
+	result.Capabilities.TextDocumentSync = textDocumentSyncFull
+	result.Capabilities.DefinitionProvider = true
+	result.Capabilities.HoverProvider = true
+	result.Capabilities.RenameProvider = true
+	result.Capabilities.CompletionProvider.TriggerCharacters = []string{`"`, "'", "`", "(", ",", "@"}
+	return result, nil
+}
+
+func (s *Server) shutdownServer(json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p didOpenTextDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p didChangeTextDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	// 全量同步，最后一次修改就是整个文档
+	return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p didCloseTextDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	return nil, s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}})
+}
+
+// update analyzes a changed document and publishes its diagnostics
+func (s *Server) update(uri, text string) error {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics})
+}
+
+// document returns the open document at a position
+func (s *Server) document(params json.RawMessage) (*document, textDocumentPositionParams, error) {
+	var p textDocumentPositionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, p, err
+	}
+	doc, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, p, errors.Errorf("document %s is not open", p.TextDocument.URI)
+	}
+	return doc, p, nil
+}
@@ -0,0 +1,293 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// session runs the server on requests and returns the messages it wrote.
+// A request with an id is sent as a request, otherwise as a notification.
+func session(t *testing.T, requests ...map[string]interface{}) []message {
+	var in bytes.Buffer
+	for _, request := range requests {
+		request["jsonrpc"] = "2.0"
+		body, err := json.Marshal(request)
+		require.NoError(t, err)
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	var out bytes.Buffer
+	require.NoError(t, NewServer(&in, &out).Run())
+	var messages []message
+	server := &Server{in: bufio.NewReader(&out)}
+	for out.Len() > 0 || server.in.Buffered() > 0 {
+		msg, err := server.read()
+		require.NoError(t, err)
+		messages = append(messages, *msg)
+	}
+	return messages
+}
+
+const testURI = "file:///main.dagl"
+
+const testCode = `@prefix = 'p';
+// lookupCache looks up the cache
+inline func lookupCache(key) {
+    builtin("lookup_cache", key, prefix=@prefix);
+}
+
+func main(input) {
+    cacheRes = @call(lookupCache, [input]);
+    builtin("jq", cacheRes, filter='.payload');
+}
+`
+
+func open(text string) map[string]interface{} {
+	return map[string]interface{}{"method": "textDocument/didOpen", "params": map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI, "languageId": "dagl", "version": 1, "text": text},
+	}}
+}
+
+func at(id int, method string, line, character int) map[string]interface{} {
+	return map[string]interface{}{"id": id, "method": method, "params": map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI},
+		"position":     map[string]interface{}{"line": line, "character": character},
+	}}
+}
+
+func result(t *testing.T, msg message, v interface{}) {
+	require.Nil(t, msg.Error)
+	require.NoError(t, json.Unmarshal(msg.Result, v))
+}
+
+// TestServer tests a session with diagnostics, definitions, hover and completion
+func TestServer(t *testing.T) {
+	broken := "func main(input) {\n    builtin(\"jq\", cachRes, filter='.a');\n}\n"
+	messages := session(t,
+		map[string]interface{}{"id": 1, "method": "initialize", "params": map[string]interface{}{}},
+		map[string]interface{}{"method": "initialized", "params": map[string]interface{}{}},
+		open(testCode),
+		at(2, "textDocument/definition", 7, 24),
+		at(3, "textDocument/hover", 7, 24),
+		at(4, "textDocument/definition", 3, 45),
+		at(5, "textDocument/definition", 8, 2),
+		map[string]interface{}{"method": "textDocument/didChange", "params": map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": testURI, "version": 2},
+			"contentChanges": []interface{}{map[string]interface{}{"text": broken}},
+		}},
+		map[string]interface{}{"id": 6, "method": "unknown/method"},
+		map[string]interface{}{"id": 7, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+	)
+	require.Len(t, messages, 9)
+
+	var initialize initializeResult
+	result(t, messages[0], &initialize)
+	require.True(t, initialize.Capabilities.DefinitionProvider)
+
+	require.Equal(t, "textDocument/publishDiagnostics", messages[1].Method)
+	var diagnostics publishDiagnosticsParams
+	require.NoError(t, json.Unmarshal(messages[1].Params, &diagnostics))
+	require.Empty(t, diagnostics.Diagnostics)
+
+	// @call 的函数名跳转到函数定义
+	var loc location
+	result(t, messages[2], &loc)
+	require.Equal(t, location{URI: testURI, Range: textRange{Start: position{2, 12}, End: position{2, 23}}}, loc)
+
+	var h hover
+	result(t, messages[3], &h)
+	require.Equal(t, "```dagl\ninline func lookupCache(key)\n```\n\nlookupCache looks up the cache", h.Contents.Value)
+
+	// 常量引用跳转到常量定义
+	result(t, messages[4], &loc)
+	require.Equal(t, textRange{Start: position{0, 1}, End: position{0, 7}}, loc.Range)
+
+	// 不是名字的位置没有定义
+	require.Equal(t, "null", string(messages[5].Result))
+
+	require.NoError(t, json.Unmarshal(messages[6].Params, &diagnostics))
+	require.Equal(t, []diagnostic{{
+		Range:    textRange{Start: position{1, 4}, End: position{1, 11}},
+		Severity: severityError,
+		Source:   "daglc",
+		Message:  `invalid input node: undefined variable "cachRes"`,
+	}}, diagnostics.Diagnostics)
+
+	require.Equal(t, codeMethodNotFound, messages[7].Error.Code)
+	require.Equal(t, "null", string(messages[8].Result))
+}
+
+// TestSyntaxDiagnostics tests that syntax errors are published instead of exiting
+func TestSyntaxDiagnostics(t *testing.T) {
+	messages := session(t,
+		open("func main(input) {\n    builtin(\"jq\", input filter='.a');\n}\n"),
+		map[string]interface{}{"id": 1, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+	)
+	var diagnostics publishDiagnosticsParams
+	require.NoError(t, json.Unmarshal(messages[0].Params, &diagnostics))
+	require.Len(t, diagnostics.Diagnostics, 1)
+	require.Equal(t, "expect ), got identifier filter", diagnostics.Diagnostics[0].Message)
+	require.Equal(t, textRange{Start: position{1, 24}, End: position{1, 30}}, diagnostics.Diagnostics[0].Range)
+}
+
+// TestNotificationErrors tests that the errors of notifications are logged and the server keeps serving
+func TestNotificationErrors(t *testing.T) {
+	messages := session(t,
+		open(testCode),
+		map[string]interface{}{"method": "textDocument/didChange", "params": map[string]interface{}{
+			"textDocument":   "bad",
+			"contentChanges": []interface{}{},
+		}},
+		at(1, "textDocument/hover", 7, 24),
+		map[string]interface{}{"id": 2, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+	)
+	require.Len(t, messages, 4)
+
+	require.Equal(t, "window/logMessage", messages[1].Method)
+	var log logMessageParams
+	require.NoError(t, json.Unmarshal(messages[1].Params, &log))
+	require.Equal(t, messageError, log.Type)
+	require.Contains(t, log.Message, "textDocument/didChange: ")
+
+	var h hover
+	result(t, messages[2], &h)
+	require.Contains(t, h.Contents.Value, "inline func lookupCache(key)")
+}
+
+// TestHoverVariables tests hovering over parameters and assigned variables
+func TestHoverVariables(t *testing.T) {
+	messages := session(t,
+		open(testCode),
+		at(1, "textDocument/hover", 3, 29),
+		at(2, "textDocument/hover", 8, 20),
+		map[string]interface{}{"id": 3, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+	)
+	var h hover
+	result(t, messages[1], &h)
+	require.Equal(t, "```dagl\nkey\n```\n\nparameter of `inline func lookupCache(key)`", h.Contents.Value)
+	result(t, messages[2], &h)
+	require.Equal(t, "```dagl\ncacheRes = @call(lookupCache, [input]);\n```\n\nvariable in func main", h.Contents.Value)
+}
+
+// TestCompletion tests completing builtin names, arg names, functions and constants
+func TestCompletion(t *testing.T) {
+	text := testCode + "func other(input) {\n    builtin(\"\n    builtin(\"http\", input, endpoint='http://a/(', \n    @call(\n    builtin(\"jq\", input, filter=@\n"
+	messages := session(t,
+		open(text),
+		at(1, "textDocument/completion", 11, 13),
+		at(2, "textDocument/completion", 12, 50),
+		at(3, "textDocument/completion", 13, 10),
+		at(4, "textDocument/completion", 14, 34),
+		map[string]interface{}{"id": 5, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+	)
+	labels := func(msg message) []string {
+		var items []completionItem
+		result(t, msg, &items)
+		var labels []string
+		for _, item := range items {
+			labels = append(labels, item.Label)
+		}
+		return labels
+	}
+	require.Equal(t, []string{"http", "identity", "jq", "lookup_cache", "set_cache"}, labels(messages[1]))
+	require.Equal(t, []string{"method", "max_retry_times", "default_value", "timeout"}, labels(messages[2]))
+	require.Equal(t, []string{"lookupCache"}, labels(messages[3]))
+	require.Equal(t, []string{"call", "prefix"}, labels(messages[4]))
+}
+
+// TestCompletionAt tests finding the completion context before the cursor
+func TestCompletionAt(t *testing.T) {
+	for prefix, expected := range map[string]completionContext{
+		`a = builtin("j`:                         {kind: completeBuiltin},
+		`a = model("n`:                           {},
+		`builtin("jq", [a, b`:                    {},
+		`builtin("jq", input, fil`:               {kind: completeArg, call: "jq", used: map[string]bool{}},
+		`builtin("jq", input, filter='.a', f`:    {kind: completeArg, call: "jq", used: map[string]bool{"filter": true}},
+		`builtin("jq", input, filter='.a(;', `:   {kind: completeArg, call: "jq", used: map[string]bool{"filter": true}},
+		`builtin("jq", input, filter='`:          {},
+		"builtin(\"\nbuiltin(\"jq\", input, ":    {kind: completeArg, call: "jq", used: map[string]bool{}},
+		`@call(look`:                             {kind: completeFunc},
+		`@call(lookupCache, [in`:                 {},
+		`@pre`:                                   {kind: completeConst},
+		`builtin("jq", input); // builtin("`:     {},
+		"// builtin(\"\nbuiltin(\"jq\", input, ": {kind: completeArg, call: "jq", used: map[string]bool{}},
+	} {
+		require.Equal(t, expected, completionAt(prefix), prefix)
+	}
+}
+
+// TestPositions tests converting positions of non ascii text
+func TestPositions(t *testing.T) {
+	doc := newDocument(testURI, "// 红楼梦😀\nfunc main(input) {\n    input;\n}\n")
+	require.Empty(t, doc.diagnostics)
+	require.Equal(t, position{0, 6}, doc.position(doc.pos(position{0, 6})))
+	require.Equal(t, 13, doc.pos(position{0, 6}).Column)
+	require.Equal(t, 17, doc.pos(position{0, 8}).Column)
+	require.Equal(t, len("// 红楼梦😀\nfunc main(input) {\n")+4, doc.offset(position{2, 4}))
+}
+
+// TestRename tests renaming a function in the workspace and a variable in the document
+func TestRename(t *testing.T) {
+	root := t.TempDir()
+	other := filepath.Join(root, "other.dagl")
+	require.NoError(t, os.WriteFile(other, []byte("inline func lookupCache(key) {\n    key;\n}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "unrelated.dagl"), []byte("func main(input) {\n    input;\n}\n"), 0o644))
+	uri := pathURI(filepath.Join(root, "main.dagl"))
+	rename := func(id, line, character int, name string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "method": "textDocument/rename", "params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+			"position":     map[string]interface{}{"line": line, "character": character},
+			"newName":      name,
+		}}
+	}
+	messages := session(t,
+		map[string]interface{}{"id": 1, "method": "initialize", "params": map[string]interface{}{"rootUri": pathURI(root)}},
+		map[string]interface{}{"method": "textDocument/didOpen", "params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "languageId": "dagl", "version": 1, "text": testCode},
+		}},
+		rename(2, 7, 24, "getCache"),
+		rename(3, 8, 20, "res"),
+		rename(4, 8, 20, "input"),
+		map[string]interface{}{"id": 5, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+	)
+	var initialize initializeResult
+	result(t, messages[0], &initialize)
+	require.True(t, initialize.Capabilities.RenameProvider)
+
+	var edit workspaceEdit
+	result(t, messages[2], &edit)
+	require.Equal(t, map[string][]textEdit{
+		uri: {
+			{Range: textRange{Start: position{2, 12}, End: position{2, 23}}, NewText: "getCache"},
+			{Range: textRange{Start: position{7, 21}, End: position{7, 32}}, NewText: "getCache"},
+		},
+		pathURI(other): {
+			{Range: textRange{Start: position{0, 12}, End: position{0, 23}}, NewText: "getCache"},
+		},
+	}, edit.Changes)
+
+	// 变量只在当前文档中改名
+	edit = workspaceEdit{}
+	result(t, messages[3], &edit)
+	require.Equal(t, map[string][]textEdit{
+		uri: {
+			{Range: textRange{Start: position{7, 4}, End: position{7, 12}}, NewText: "res"},
+			{Range: textRange{Start: position{8, 18}, End: position{8, 26}}, NewText: "res"},
+		},
+	}, edit.Changes)
+
+	require.Equal(t, codeInvalidParams, messages[4].Error.Code)
+	require.Equal(t, uriPath(uri)+`:7:11: variable "input" is already defined`, messages[4].Error.Message)
+}
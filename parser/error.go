@@ -0,0 +1,17 @@
+package parser
+
+// Error is a syntax error at a position in dagl source. The generator reports
+// its errors with this type as well.
+type Error struct {
+	Pos Pos
+	Msg string
+	// context 是出错的源码行，进程退出前打印
+	context string
+}
+
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Msg
+	}
+	return e.Msg
+}
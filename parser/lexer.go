@@ -81,6 +81,22 @@ var literalToToken = map[rune]Token{
 type TokenData struct {
 	Token Token
 	Value interface{}
+	Pos   Pos
+}
+
+// Pos is a position in the source
+type Pos struct {
+	Line   int // 行号，从1开始
+	Column int // 列号，从1开始，按字节计算
+}
+
+// IsValid checks if the position is known
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 type lexer struct {
@@ -89,6 +105,7 @@ type lexer struct {
 	line      int // 行号，用于报错
 	lineBegin int
 	queue     []TokenData
+	tokPos    Pos // 最近一次返回的token的位置
 }
 
 func newLexer(input string) *lexer {
@@ -104,12 +121,17 @@ func (l *lexer) Next() (t Token, v interface{}) {
 	if len(l.queue) > 0 {
 		tok := l.queue[len(l.queue)-1]
 		l.queue = l.queue[:len(l.queue)-1]
+		l.tokPos = tok.Pos
 		return tok.Token, tok.Value
 	}
 	item, err := l.nextItem()
 	if err == io.EOF {
+		l.tokPos = Pos{Line: l.line + 1, Column: l.pos - l.lineBegin + 1}
 		return EOF, nil
 	}
+	if !unicode.IsSpace(item) {
+		l.tokPos = Pos{Line: l.line + 1, Column: l.pos - utf8.RuneLen(item) - l.lineBegin + 1}
+	}
 	switch item {
 	case ';', '(', ')', '{', '}', '=', ',', '[', ']', '@':
 		return literalToToken[item], nil
@@ -131,17 +153,19 @@ func (l *lexer) LookAhead() (t Token, v interface{}) {
 	pos := l.pos
 	line := l.line
 	lineBegin := l.lineBegin
+	tokPos := l.tokPos
 	t, v = l.Next()
 	l.pos = pos
 	l.line = line
 	l.lineBegin = lineBegin
+	l.tokPos = tokPos
 	return
 }
 
 // Back 用于回退一个token
 // 会将指针回退到上一个token的位置
-func (l *lexer) Back(tok Token, val interface{}) {
-	l.queue = append(l.queue, TokenData{tok, val})
+func (l *lexer) Back(tok Token, val interface{}, pos Pos) {
+	l.queue = append(l.queue, TokenData{tok, val, pos})
 }
 
 func (l *lexer) scanComment() (Token, interface{}) {
@@ -223,9 +247,16 @@ func (l *lexer) backItem(item rune) {
 func (l *lexer) errorf(format string, args ...interface{}) string {
 	msg := bytes.NewBufferString("")
 	msg.WriteString(fmt.Sprintf("line %d:%s\n", l.line, fmt.Sprintf(format, args...)))
-	msg.WriteString(strings.Split(l.input, "\n")[l.line])
+	// 出错的字符是换行时，已经到了下一行
+	line, column := l.line, l.pos-l.lineBegin-1
+	if column < 0 && line > 0 {
+		line--
+		column = strings.LastIndexByte(l.input[:l.lineBegin-1], '\n')
+		column = l.lineBegin - 1 - column - 1
+	}
+	msg.WriteString(strings.Split(l.input, "\n")[line])
 	msg.WriteByte('\n')
-	msg.WriteString(strings.Repeat(" ", l.pos-l.lineBegin-1))
+	msg.WriteString(strings.Repeat(" ", column))
 	msg.WriteString("^\n")
 	return msg.String()
 }
@@ -123,3 +123,12 @@ func TestLexerComment(t *testing.T) {
 		}
 	}
 }
+
+// TestUnterminatedString tests reporting a string broken by a newline
+func TestUnterminatedString(t *testing.T) {
+	tok, v := newLexer("'abc\ndef").Next()
+	expected := "line 1:waiting for 100111\n'abc\n    ^\n"
+	if tok != ILEGAL || v != expected {
+		t.Fatalf("expected %v %q, got %v %q", ILEGAL, expected, tok, v)
+	}
+}
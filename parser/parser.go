@@ -14,7 +14,28 @@ type parser struct {
 	lexer *lexer
 }
 
-func (p *parser) Parse() (statements []Statement) {
+// Parse parses the input, and exits the process on syntax errors
+func (p *parser) Parse() []Statement {
+	statements, err := p.TryParse()
+	if err != nil {
+		e := err.(*Error)
+		log.Fatalf("%s%s\n", e.context, e.Msg)
+	}
+	return statements
+}
+
+// TryParse parses the input and returns the first syntax error as an *Error,
+// together with the top level statements parsed before it
+func (p *parser) TryParse() (statements []Statement, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
 	for {
 		var stmts []Statement
 		tok, v := p.lexer.Next()
@@ -28,7 +49,7 @@ func (p *parser) Parse() (statements []Statement) {
 			stmts = p.parseConst()
 			break
 		case COMMENT:
-			stmts = []Statement{CommentStmt{Comment: v.(string)}}
+			stmts = []Statement{CommentStmt{Comment: v.(string), Pos: p.lexer.tokPos}}
 			break
 		case IDENTIFIER:
 			switch v {
@@ -38,6 +59,9 @@ func (p *parser) Parse() (statements []Statement) {
 			case "func":
 				stmts = p.parseFunc()
 				break
+			case "test":
+				stmts = p.parseTest()
+				break
 			default:
 				p.reportErrorf("unexpected token: %s", tok)
 			}
@@ -51,17 +75,20 @@ func (p *parser) Parse() (statements []Statement) {
 }
 
 func (p *parser) parseConst() (statements []Statement) {
+	pos := p.lexer.tokPos
 	tok, v := p.checkTokenType(IDENTIFIER)
-	constName := v.(string)
+	constName, namePos := v.(string), p.lexer.tokPos
 	p.checkTokenType(ASSIGNMENT)
 	tok, v = p.lexer.Next()
 	switch tok {
 	case AT:
 		_, v = p.checkTokenType(IDENTIFIER)
-		statements = append(statements, AssignStmt{VarName: constName, Value: StrVal{Type: StrValTypeConst, Value: v.(string)}})
+		value := StrVal{Type: StrValTypeConst, Value: v.(string), Pos: p.lexer.tokPos}
+		statements = append(statements, AssignStmt{VarName: constName, Value: value, Pos: pos, NamePos: namePos})
 		break
 	case STRING:
-		statements = []Statement{AssignStmt{VarName: constName, Value: StrVal{Type: StrValTypeLiteral, Value: v.(string)}}}
+		value := StrVal{Type: StrValTypeLiteral, Value: v.(string), Pos: p.lexer.tokPos}
+		statements = []Statement{AssignStmt{VarName: constName, Value: value, Pos: pos, NamePos: namePos}}
 		break
 	default:
 		p.reportErrorf("expect string, got %s", tok)
@@ -72,16 +99,23 @@ func (p *parser) parseConst() (statements []Statement) {
 }
 
 func (p *parser) parseInlineFunc() (statements []Statement) {
+	pos := p.lexer.tokPos
 	p.checkTokenAndValue(IDENTIFIER, "func")
 	statements = p.parseFunc()
+	funcStmt := statements[0].(FuncStmt)
+	funcStmt.Pos = pos
+	funcStmt.Inline = true
+	statements[0] = funcStmt
 	return
 }
 
 func (p *parser) parseFunc() (statements []Statement) {
+	pos := p.lexer.tokPos
 	tok, v := p.checkTokenType(IDENTIFIER)
-	funcName := v.(string)
+	funcName, namePos := v.(string), p.lexer.tokPos
 	p.checkTokenType(LEFT_PARENTHESIS)
 	var inputs []string
+	var inputPos []Pos
 	for {
 		tok, v = p.lexer.Next()
 		if tok == RIGHT_PARENTHESIS {
@@ -99,10 +133,11 @@ func (p *parser) parseFunc() (statements []Statement) {
 			return
 		}
 		inputs = append(inputs, v.(string))
+		inputPos = append(inputPos, p.lexer.tokPos)
 	}
 	p.checkTokenType(LEFT_CURLY_BRACE)
 	statements = p.parseBody()
-	statements = []Statement{FuncStmt{Name: funcName, Inputs: inputs, Body: statements}}
+	statements = []Statement{FuncStmt{Name: funcName, Inputs: inputs, Body: statements, Pos: pos, NamePos: namePos, InputPos: inputPos}}
 	return
 }
 
@@ -121,7 +156,7 @@ func (p *parser) parseBody() (statements []Statement) {
 			stmts = p.parseInlineFuncCall()
 			break
 		case COMMENT:
-			stmts = []Statement{CommentStmt{Comment: v.(string)}}
+			stmts = []Statement{CommentStmt{Comment: v.(string), Pos: p.lexer.tokPos}}
 			break
 		case IDENTIFIER:
 			switch v {
@@ -135,12 +170,13 @@ func (p *parser) parseBody() (statements []Statement) {
 				stmts = p.parseIfStmt()
 				break
 			default:
+				pos := p.lexer.tokPos
 				t1, _ := p.lexer.LookAhead()
 				if t1 == ASSIGNMENT {
-					p.lexer.Back(tok, v)
+					p.lexer.Back(tok, v, pos)
 					stmts = p.parseNodeAssign()
 				} else {
-					stmts = append(stmts, NodeValStmt{Name: v.(string)})
+					stmts = append(stmts, NodeValStmt{Name: v.(string), Pos: pos})
 					p.checkTokenType(SEMICOLON)
 				}
 			}
@@ -157,13 +193,18 @@ func (p *parser) parseBody() (statements []Statement) {
 
 // parseInlineFuncCall parses inline function call.
 func (p *parser) parseInlineFuncCall() (statements []Statement) {
+	pos := p.lexer.tokPos
 	p.checkTokenAndValue(IDENTIFIER, "call")
 	statements = p.parseFuncCall(FuncCallTypeInline)
+	call := statements[0].(FuncCallStmt)
+	call.Pos = pos
+	statements[0] = call
 	return
 }
 
 // parseFuncCall parses inline function call.
 func (p *parser) parseFuncCall(_type FuncCallType) (statements []Statement) {
+	pos := p.lexer.tokPos
 	p.checkTokenType(LEFT_PARENTHESIS)
 	var funcName string
 	if p.checkIfNextToken(STRING) {
@@ -173,6 +214,7 @@ func (p *parser) parseFuncCall(_type FuncCallType) (statements []Statement) {
 		_, v := p.checkTokenType(IDENTIFIER)
 		funcName = v.(string)
 	}
+	namePos := p.lexer.tokPos
 	p.checkTokenType(COMMA)
 	inputs := p.parseInputs()
 	var argPairs []ArgPair
@@ -183,7 +225,7 @@ func (p *parser) parseFuncCall(_type FuncCallType) (statements []Statement) {
 		p.checkTokenType(RIGHT_PARENTHESIS)
 	}
 	p.checkTokenType(SEMICOLON)
-	statements = []Statement{FuncCallStmt{Type: _type, FuncName: funcName, Inputs: inputs, Args: argPairs}}
+	statements = []Statement{FuncCallStmt{Type: _type, FuncName: funcName, Inputs: inputs, Args: argPairs, Pos: pos, NamePos: namePos}}
 	return
 }
 
@@ -191,7 +233,7 @@ func (p *parser) parseFuncCall(_type FuncCallType) (statements []Statement) {
 func (p *parser) parseInputs() (inputs []NodeExp) {
 	if !p.checkIfNextToken(LEFT_SQUARE_BRACKET) {
 		_, v := p.checkTokenType(IDENTIFIER)
-		inputs = []NodeExp{{Type: NodeExpTypeVar, Value: v.(string)}}
+		inputs = []NodeExp{{Type: NodeExpTypeVar, Value: v.(string), Pos: p.lexer.tokPos}}
 		return
 	}
 	p.checkTokenType(LEFT_SQUARE_BRACKET)
@@ -211,7 +253,7 @@ func (p *parser) parseInputs() (inputs []NodeExp) {
 			p.reportErrorf("expect identifier, got %s", tok)
 			return
 		}
-		inputs = append(inputs, NodeExp{Type: NodeExpTypeVar, Value: v.(string)})
+		inputs = append(inputs, NodeExp{Type: NodeExpTypeVar, Value: v.(string), Pos: p.lexer.tokPos})
 	}
 }
 
@@ -233,26 +275,27 @@ func (p *parser) parseArgPairs() (argPairs []ArgPair) {
 			p.reportErrorf("expect identifier, got %s", tok)
 			return
 		}
-		argName := v.(string)
+		argName, argPos := v.(string), p.lexer.tokPos
 		p.checkTokenType(ASSIGNMENT)
 		var argValue StrVal
 		tok, v = p.lexer.Next()
 		if tok == AT {
 			_, v = p.checkTokenType(IDENTIFIER)
-			argValue = StrVal{Type: StrValTypeConst, Value: v.(string)}
+			argValue = StrVal{Type: StrValTypeConst, Value: v.(string), Pos: p.lexer.tokPos}
 		} else if tok == STRING {
-			argValue = StrVal{Type: StrValTypeLiteral, Value: v.(string)}
+			argValue = StrVal{Type: StrValTypeLiteral, Value: v.(string), Pos: p.lexer.tokPos}
 		} else {
 			p.reportErrorf("expect string, got %s", tok)
 			return
 		}
-		argPairs = append(argPairs, ArgPair{Name: argName, Value: argValue})
+		argPairs = append(argPairs, ArgPair{Name: argName, Value: argValue, Pos: argPos})
 	}
 	return
 }
 
 func (p *parser) parseNodeAssign() (statements []Statement) {
 	tok, v := p.checkTokenType(IDENTIFIER)
+	pos := p.lexer.tokPos
 	nodeName := v.(string)
 	p.checkTokenType(ASSIGNMENT)
 	tok, v = p.lexer.Next()
@@ -261,18 +304,18 @@ func (p *parser) parseNodeAssign() (statements []Statement) {
 		switch v.(string) {
 		case "builtin":
 			stmts := p.parseFuncCall(FuncCallTypeBuiltin)
-			statements = append(statements, NodeAssignStmt{VarName: nodeName, Value: stmts[0].(FuncCallStmt)})
+			statements = append(statements, NodeAssignStmt{VarName: nodeName, Value: stmts[0].(FuncCallStmt), Pos: pos})
 			break
 		case "model":
 			stmts := p.parseFuncCall(FuncCallTypeModel)
-			statements = append(statements, NodeAssignStmt{VarName: nodeName, Value: stmts[0].(FuncCallStmt)})
+			statements = append(statements, NodeAssignStmt{VarName: nodeName, Value: stmts[0].(FuncCallStmt), Pos: pos})
 			break
 		default:
 			p.reportErrorf("expect builtin, got %s", v.(string))
 		}
 	case AT:
 		stmts := p.parseInlineFuncCall()
-		statements = append(statements, NodeAssignStmt{VarName: nodeName, Value: stmts[0].(FuncCallStmt)})
+		statements = append(statements, NodeAssignStmt{VarName: nodeName, Value: stmts[0].(FuncCallStmt), Pos: pos})
 	default:
 		p.reportErrorf("expect @call or identifier, got %s", tok)
 	}
@@ -281,28 +324,30 @@ func (p *parser) parseNodeAssign() (statements []Statement) {
 
 // parserIfStmt parses if statement
 func (p *parser) parseIfStmt() (statements []Statement) {
+	pos := p.lexer.tokPos
 	p.checkTokenType(LEFT_PARENTHESIS)
 	var cond NodeExp
 	// parse condition
 	// condition can be nodeVar or builtinFuncCall or inlineFuncCall
 	tok, v := p.lexer.Next()
+	condPos := p.lexer.tokPos
 	switch tok {
 	case IDENTIFIER:
 		switch v.(string) {
 		case "builtin":
 			stmts := p.parseFuncCall(FuncCallTypeBuiltin)
-			cond = NodeExp{Type: NodeExpTypeFuncCall, Value: stmts[0].(FuncCallStmt)}
+			cond = NodeExp{Type: NodeExpTypeFuncCall, Value: stmts[0].(FuncCallStmt), Pos: condPos}
 			break
 		case "model":
 			stmts := p.parseFuncCall(FuncCallTypeModel)
-			cond = NodeExp{Type: NodeExpTypeFuncCall, Value: stmts[0].(FuncCallStmt)}
+			cond = NodeExp{Type: NodeExpTypeFuncCall, Value: stmts[0].(FuncCallStmt), Pos: condPos}
 			break
 		default:
-			cond = NodeExp{Type: NodeExpTypeVar, Value: v.(string)}
+			cond = NodeExp{Type: NodeExpTypeVar, Value: v.(string), Pos: condPos}
 		}
 	case AT:
 		stmts := p.parseInlineFuncCall()
-		cond = NodeExp{Type: NodeExpTypeFuncCall, Value: stmts[0].(FuncCallStmt)}
+		cond = NodeExp{Type: NodeExpTypeFuncCall, Value: stmts[0].(FuncCallStmt), Pos: condPos}
 	default:
 		p.reportErrorf("expect builtin or @call or identifier, got %s", tok)
 	}
@@ -320,10 +365,72 @@ func (p *parser) parseIfStmt() (statements []Statement) {
 		}
 		falseStmts = p.parseBody()
 	}
-	statements = []Statement{IfStmt{Cond: cond, True: trueStmts, False: falseStmts}}
+	statements = []Statement{IfStmt{Cond: cond, True: trueStmts, False: falseStmts, Pos: pos}}
 	return
 }
 
+// parseTest parses a test of the main function
+func (p *parser) parseTest() (statements []Statement) {
+	pos := p.lexer.tokPos
+	_, v := p.checkTokenType(STRING)
+	name, namePos := v.(string), p.lexer.tokPos
+	p.checkTokenType(LEFT_CURLY_BRACE)
+	var body []Statement
+	seen := map[TestItemKind]bool{}
+	for {
+		tok, v := p.lexer.Next()
+		switch tok {
+		case RIGHT_CURLY_BRACE:
+			return []Statement{TestStmt{Name: name, Body: body, Pos: pos, NamePos: namePos}}
+		case COMMENT:
+			body = append(body, CommentStmt{Comment: v.(string), Pos: p.lexer.tokPos})
+			continue
+		case IDENTIFIER:
+		default:
+			p.reportErrorf("expect input, mock or expect, got %s", tok)
+		}
+		item := TestItemStmt{Pos: p.lexer.tokPos}
+		switch v {
+		case "input":
+			item.Kind = TestItemInput
+		case "expect":
+			item.Kind = TestItemExpect
+		case "mock":
+			item.Kind = TestItemMock
+			// 节点类型和内联函数中的节点名带点，写成字符串
+			tok, v = p.lexer.Next()
+			if tok != IDENTIFIER && tok != STRING {
+				p.reportErrorf("expect identifier or string, got %s", tok)
+			}
+			item.Key, item.KeyPos = v.(string), p.lexer.tokPos
+		default:
+			p.reportErrorf("expect input, mock or expect, got %s", v)
+		}
+		if item.Kind != TestItemMock && seen[item.Kind] {
+			p.reportErrorf("duplicate %s in test %q", item.Kind, name)
+		}
+		seen[item.Kind] = true
+		p.checkTokenType(ASSIGNMENT)
+		item.Value = p.parseStrVal()
+		p.checkTokenType(SEMICOLON)
+		body = append(body, item)
+	}
+}
+
+// parseStrVal parses a string literal or a constant reference
+func (p *parser) parseStrVal() StrVal {
+	tok, v := p.lexer.Next()
+	switch tok {
+	case AT:
+		_, v = p.checkTokenType(IDENTIFIER)
+		return StrVal{Type: StrValTypeConst, Value: v.(string), Pos: p.lexer.tokPos}
+	case STRING:
+		return StrVal{Type: StrValTypeLiteral, Value: v.(string), Pos: p.lexer.tokPos}
+	}
+	p.reportErrorf("expect string, got %s", tok)
+	return StrVal{}
+}
+
 // checkTokenAndValue checks if the next token is the expected one
 func (p *parser) checkTokenAndValue(tok Token, v interface{}) (Token, interface{}) {
 	tok2, v2 := p.lexer.Next()
@@ -337,7 +444,7 @@ func (p *parser) checkTokenAndValue(tok Token, v interface{}) (Token, interface{
 func (p *parser) checkTokenType(tok Token) (Token, interface{}) {
 	tok2, v := p.lexer.Next()
 	if tok2 != tok {
-		p.reportErrorf("line %d: %s:\nexpect %s, got %s:%s\n", p.lexer.line, p.lexer.input[p.lexer.lineBegin:p.lexer.pos], tok, tok2, v)
+		p.reportErrorf("expect %s, got %s %v", tok, tok2, v)
 	}
 	return tok2, v
 }
@@ -348,8 +455,8 @@ func (p *parser) checkIfNextToken(tok Token) bool {
 	return tok2 == tok
 }
 
-// reportErrorf reports error
+// reportErrorf reports an error at the last token and stops parsing
 func (p *parser) reportErrorf(format string, args ...interface{}) {
 	ctx := fmt.Sprintf("line %d:\n %s:\n", p.lexer.line, p.lexer.input[p.lexer.lineBegin:p.lexer.pos])
-	log.Fatalf(ctx+format+"\n", args...)
+	panic(&Error{Pos: p.lexer.tokPos, Msg: fmt.Sprintf(format, args...), context: ctx})
 }
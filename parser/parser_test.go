@@ -3,6 +3,8 @@ package parser
 import (
 	"reflect"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 // TestParseConst tests the parser's ability to parse a constant assignment
@@ -11,7 +13,7 @@ func TestParseConst(t *testing.T) {
 	expected := []Statement{AssignStmt{VarName: "foo", Value: StrVal{Type: StrValTypeLiteral, Value: "bar"}}}
 	parser := NewParser(input)
 	parser.lexer.Next()
-	actual := parser.parseConst()
+	actual := clearPos(parser.parseConst())
 	if !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("expected %v, got %v", expected, actual)
 	}
@@ -23,7 +25,7 @@ func TestParseBuiltinFuncCall(t *testing.T) {
 	expected := []Statement{FuncCallStmt{Type: FuncCallTypeBuiltin, FuncName: "get_cache", Inputs: []NodeExp{{Type: NodeExpTypeVar, Value: "req"}}, Args: []ArgPair{{Name: "prefix", Value: StrVal{Type: StrValTypeLiteral, Value: "hello"}}}}}
 	parser := NewParser(input)
 	parser.lexer.Next()
-	actual := parser.parseFuncCall(FuncCallTypeBuiltin)
+	actual := clearPos(parser.parseFuncCall(FuncCallTypeBuiltin))
 	if !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("expected %v, got %v", expected, actual)
 	}
@@ -35,7 +37,7 @@ func TestParseInlineFuncCall(t *testing.T) {
 	expected := []Statement{FuncCallStmt{Type: FuncCallTypeInline, FuncName: "setCache", Inputs: []NodeExp{{Type: NodeExpTypeVar, Value: "req"}, {Type: NodeExpTypeVar, Value: "output"}}}}
 	parser := NewParser(input)
 	parser.lexer.Next()
-	actual := parser.parseInlineFuncCall()
+	actual := clearPos(parser.parseInlineFuncCall())
 	if !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("expected %v, got %v", expected, actual)
 	}
@@ -47,7 +49,7 @@ func TestParseModelFuncCall(t *testing.T) {
 	expected := []Statement{FuncCallStmt{Type: FuncCallTypeModel, FuncName: "finder", Inputs: []NodeExp{{Type: NodeExpTypeVar, Value: "req"}}, Args: []ArgPair{{Name: "output", Value: StrVal{Type: StrValTypeLiteral, Value: "output"}}}}}
 	parser := NewParser(input)
 	parser.lexer.Next()
-	actual := parser.parseFuncCall(FuncCallTypeModel)
+	actual := clearPos(parser.parseFuncCall(FuncCallTypeModel))
 	if !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("expected %v, got %v", expected, actual)
 	}
@@ -58,7 +60,7 @@ func TestParseNodeAssignment(t *testing.T) {
 	input := `node=builtin("jq",[input],filter="");`
 	expected := []Statement{NodeAssignStmt{VarName: "node", Value: FuncCallStmt{Type: FuncCallTypeBuiltin, FuncName: "jq", Inputs: []NodeExp{{Type: NodeExpTypeVar, Value: "input"}}, Args: []ArgPair{{Name: "filter", Value: StrVal{Type: StrValTypeLiteral, Value: ""}}}}}}
 	parser := NewParser(input)
-	actual := parser.parseNodeAssign()
+	actual := clearPos(parser.parseNodeAssign())
 	if !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("expected %v, got %v", expected, actual)
 	}
@@ -91,7 +93,7 @@ func TestParseInlineFunc(t *testing.T) {
 	}
 	parser := NewParser(input)
 	parser.lexer.Next()
-	actual := parser.Parse()
+	actual := clearPos(parser.Parse())
 	if !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("expected %#v\n got %#v\n", expected, actual)
 	}
@@ -111,7 +113,7 @@ func TestParseIfStmt(t *testing.T) {
 		False: []Statement{CommentStmt{Comment: "// test comment in body"}, FuncCallStmt{Type: FuncCallTypeModel, FuncName: "finder", Inputs: []NodeExp{{Type: NodeExpTypeVar, Value: "req"}}, Args: []ArgPair{{Name: "output", Value: StrVal{Type: StrValTypeLiteral, Value: "output"}}}}}}}
 	parser := NewParser(input)
 	parser.lexer.Next()
-	actual := parser.parseIfStmt()
+	actual := clearPos(parser.parseIfStmt())
 	if !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("expected %v, got %v", expected, actual)
 	}
@@ -122,7 +124,7 @@ func TestParseComment(t *testing.T) {
 	input := `// this is a comment`
 	expected := []Statement{CommentStmt{Comment: "// this is a comment"}}
 	parser := NewParser(input)
-	actual := parser.Parse()
+	actual := clearPos(parser.Parse())
 	if !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("expected %v, got %v", expected, actual)
 	}
@@ -165,7 +167,7 @@ func TestParseFullCode(t *testing.T) {
 	expected := []Statement{
 		AssignStmt{VarName: "cacheKey", Value: StrVal{Type: StrValTypeLiteral, Value: ".suggestion_type+\"##\"+(.filter_retrievers//[]|join(\"#\"))+\"##\"+(.context//[]|join(\"#\"))+\"##\"+.query"}},
 		FuncStmt{
-			Name: "getCacheKey", Inputs: []string{"input"},
+			Name: "getCacheKey", Inputs: []string{"input"}, Inline: true,
 			Body: []Statement{
 				FuncCallStmt{Type: FuncCallTypeBuiltin, FuncName: "jq", Inputs: []NodeExp{{Type: NodeExpTypeVar, Value: "input"}}, Args: []ArgPair{{Name: "filter", Value: StrVal{Type: StrValTypeConst, Value: "cacheKey"}}}},
 			},
@@ -173,6 +175,7 @@ func TestParseFullCode(t *testing.T) {
 		FuncStmt{
 			Name:   "setCache",
 			Inputs: []string{"key", "result"},
+			Inline: true,
 			Body: []Statement{
 				NodeAssignStmt{VarName: "cacheReq", Value: FuncCallStmt{Type: FuncCallTypeBuiltin, FuncName: "jq", Inputs: []NodeExp{
 					{Type: NodeExpTypeVar, Value: "key"}, {Type: NodeExpTypeVar, Value: "result"},
@@ -184,6 +187,7 @@ func TestParseFullCode(t *testing.T) {
 		}, FuncStmt{
 			Name:   "lookupCache",
 			Inputs: []string{"key"},
+			Inline: true,
 			Body: []Statement{
 				FuncCallStmt{Type: FuncCallTypeBuiltin, FuncName: "lookup_cache", Inputs: []NodeExp{{Type: NodeExpTypeVar, Value: "key"}}, Args: []ArgPair{{Name: "prefix", Value: StrVal{Type: StrValTypeLiteral, Value: "ime_rec_bert_ner_v1"}}}},
 			}},
@@ -217,8 +221,141 @@ func TestParseFullCode(t *testing.T) {
 		CommentStmt{Comment: `// {"payload": "{\"request_id\":\"1674\",\"request_type\":7,\"context\":[],\"context_interval\":[],\"query\":\"红楼梦小姐姐\",\"uid\":\"1674\",\"api_level\":0}"}`},
 	}
 	parser := NewParser(input)
-	actual := parser.Parse()
+	actual := clearPos(parser.Parse())
 	if !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("expected %s\n got %s\n", expected, actual)
 	}
 }
+
+// clearPos clears the positions of statements, so that tests can compare the structure only
+func clearPos(statements []Statement) []Statement {
+	for i, statement := range statements {
+		switch v := statement.(type) {
+		case AssignStmt:
+			v.Pos = Pos{}
+			v.NamePos = Pos{}
+			v.Value.Pos = Pos{}
+			statements[i] = v
+		case NodeAssignStmt:
+			v.Pos = Pos{}
+			v.Value = clearCallPos(v.Value)
+			statements[i] = v
+		case FuncCallStmt:
+			statements[i] = clearCallPos(v)
+		case IfStmt:
+			v.Pos = Pos{}
+			v.Cond.Pos = Pos{}
+			if call, ok := v.Cond.Value.(FuncCallStmt); ok {
+				v.Cond.Value = clearCallPos(call)
+			}
+			v.True = clearPos(v.True)
+			v.False = clearPos(v.False)
+			statements[i] = v
+		case FuncStmt:
+			v.Pos = Pos{}
+			v.NamePos = Pos{}
+			v.InputPos = nil
+			v.Body = clearPos(v.Body)
+			statements[i] = v
+		case NodeValStmt:
+			v.Pos = Pos{}
+			statements[i] = v
+		case CommentStmt:
+			v.Pos = Pos{}
+			statements[i] = v
+		case TestStmt:
+			v.Pos = Pos{}
+			v.NamePos = Pos{}
+			v.Body = clearPos(v.Body)
+			statements[i] = v
+		case TestItemStmt:
+			v.Pos = Pos{}
+			v.KeyPos = Pos{}
+			v.Value.Pos = Pos{}
+			statements[i] = v
+		}
+	}
+	return statements
+}
+
+// clearCallPos clears the positions of a function call and its inputs and args
+func clearCallPos(call FuncCallStmt) FuncCallStmt {
+	call.Pos = Pos{}
+	call.NamePos = Pos{}
+	inputs := append([]NodeExp(nil), call.Inputs...)
+	for i := range inputs {
+		inputs[i].Pos = Pos{}
+	}
+	if call.Inputs != nil {
+		call.Inputs = inputs
+	}
+	args := append([]ArgPair(nil), call.Args...)
+	for i := range args {
+		args[i].Pos = Pos{}
+		args[i].Value.Pos = Pos{}
+	}
+	if call.Args != nil {
+		call.Args = args
+	}
+	return call
+}
+
+// TestParsePositions tests the positions recorded on statements
+func TestParsePositions(t *testing.T) {
+	input := `@prefix = "p";
+// comment
+inline func lookupCache(key) {
+	cacheRes = builtin("lookup_cache", key, prefix=@prefix);
+	cacheRes;
+}
+func main(input) {
+  if (input) { @call(lookupCache, [input]); }
+}`
+	statements := NewParser(input).Parse()
+	require.Equal(t, Pos{Line: 1, Column: 1}, statements[0].(AssignStmt).Pos)
+	require.Equal(t, Pos{Line: 2, Column: 1}, statements[1].(CommentStmt).Pos)
+	lookupCache := statements[2].(FuncStmt)
+	require.Equal(t, Pos{Line: 3, Column: 1}, lookupCache.Pos)
+	assign := lookupCache.Body[0].(NodeAssignStmt)
+	require.Equal(t, Pos{Line: 4, Column: 2}, assign.Pos)
+	require.Equal(t, Pos{Line: 4, Column: 13}, assign.Value.Pos)
+	require.Equal(t, Pos{Line: 5, Column: 2}, lookupCache.Body[1].(NodeValStmt).Pos)
+	main := statements[3].(FuncStmt)
+	require.Equal(t, Pos{Line: 7, Column: 1}, main.Pos)
+	ifStmt := main.Body[0].(IfStmt)
+	require.Equal(t, Pos{Line: 8, Column: 3}, ifStmt.Pos)
+	require.Equal(t, Pos{Line: 8, Column: 16}, ifStmt.True[0].(FuncCallStmt).Pos)
+
+	// 名字、参数和引用的位置
+	require.Equal(t, Pos{Line: 1, Column: 2}, statements[0].(AssignStmt).NamePos)
+	require.Equal(t, Pos{Line: 1, Column: 11}, statements[0].(AssignStmt).Value.Pos)
+	require.Equal(t, Pos{Line: 3, Column: 13}, lookupCache.NamePos)
+	require.Equal(t, []Pos{{Line: 3, Column: 25}}, lookupCache.InputPos)
+	require.Equal(t, Pos{Line: 4, Column: 21}, assign.Value.NamePos)
+	require.Equal(t, Pos{Line: 4, Column: 37}, assign.Value.Inputs[0].Pos)
+	require.Equal(t, Pos{Line: 4, Column: 42}, assign.Value.Args[0].Pos)
+	require.Equal(t, Pos{Line: 4, Column: 50}, assign.Value.Args[0].Value.Pos)
+	require.Equal(t, Pos{Line: 8, Column: 7}, ifStmt.Cond.Pos)
+	call := ifStmt.True[0].(FuncCallStmt)
+	require.Equal(t, Pos{Line: 8, Column: 22}, call.NamePos)
+	require.Equal(t, Pos{Line: 8, Column: 36}, call.Inputs[0].Pos)
+}
+
+// TestTryParse tests returning syntax errors with their positions
+func TestTryParse(t *testing.T) {
+	for _, c := range []struct {
+		input string
+		err   string
+	}{
+		{"func main(input) {\n  a = builtin(\"jq\", input filter='.a');\n}", "2:27: expect ), got identifier filter"},
+		{"@a = 'x'\nfunc main(input) {}", "2:1: expect ;, got identifier func"},
+		{"func main(input) {\n  input;", "2:9: unexpected EOF"},
+		{"main(input) {}", "1:1: unexpected token: identifier"},
+	} {
+		_, err := NewParser(c.input).TryParse()
+		require.EqualError(t, err, c.err, c.input)
+	}
+	statements, err := NewParser("@a = 'x';\n@b = @a;\nfunc main(input) {").TryParse()
+	require.Error(t, err)
+	require.Len(t, statements, 2)
+}
@@ -0,0 +1,304 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+const (
+	// indentUnit 是函数体和分支每一层的缩进
+	indentUnit = "    "
+	// maxLineWidth 是一行的最大长度，超过时每个参数单独一行
+	maxLineWidth = 100
+)
+
+// Fprint writes statements as dagl source
+func Fprint(w io.Writer, statements []Statement) error {
+	p := &printer{}
+	return p.print(w, statements)
+}
+
+// Format formats dagl source canonically. Comments and blank lines between
+// statements are kept, and formatting formatted source changes nothing.
+func Format(src string) (string, error) {
+	statements, err := NewParser(src).TryParse()
+	if err != nil {
+		return "", err
+	}
+	p := &printer{lines: strings.Split(src, "\n")}
+	var buf bytes.Buffer
+	if err := p.print(&buf, statements); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (p *printer) print(w io.Writer, statements []Statement) error {
+	p.body(statements, 0)
+	if p.err != nil {
+		return p.err
+	}
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// startsGroup checks if a top level statement is separated from the previous one by a blank line
+func startsGroup(prev, statement Statement) bool {
+	_, prevFunc := prev.(FuncStmt)
+	if _, prevTest := prev.(TestStmt); prevTest {
+		prevFunc = true
+	}
+	_, prevComment := prev.(CommentStmt)
+	switch statement.(type) {
+	case FuncStmt, TestStmt:
+		return !prevComment
+	case CommentStmt:
+		return !prevComment
+	default:
+		return prevFunc
+	}
+}
+
+// Quote quotes a string literal with the first of ', " and ` it does not contain.
+// dagl strings have no escapes, so a string containing all of them can not be quoted.
+func Quote(s string) (string, error) {
+	for _, quote := range []string{"'", `"`, "`"} {
+		// 只有 ` 引起来的字符串可以换行
+		if strings.Contains(s, quote) || quote != "`" && strings.Contains(s, "\n") {
+			continue
+		}
+		return quote + s + quote, nil
+	}
+	return "", fmt.Errorf("string %q can not be quoted in dagl", s)
+}
+
+type printer struct {
+	buf bytes.Buffer
+	err error
+	// lines 是格式化的源码，用于保留空行和行尾注释
+	lines []string
+}
+
+// line writes a line at the given depth
+func (p *printer) line(depth int, format string, args ...interface{}) {
+	p.buf.WriteString(strings.Repeat(indentUnit, depth))
+	fmt.Fprintf(&p.buf, format, args...)
+	p.buf.WriteString("\n")
+}
+
+func (p *printer) statement(statement Statement, depth int) {
+	switch v := statement.(type) {
+	case AssignStmt:
+		p.line(depth, "@%s = %s;", v.VarName, p.strVal(v.Value))
+	case NodeAssignStmt:
+		p.callLine(depth, v.VarName+" = ", v.Value)
+	case FuncCallStmt:
+		p.callLine(depth, "", v)
+	case NodeValStmt:
+		p.line(depth, "%s;", v.Name)
+	case CommentStmt:
+		p.line(depth, "%s", strings.TrimRightFunc(v.Comment, unicode.IsSpace))
+	case IfStmt:
+		p.line(depth, "if (%s) {", p.cond(v.Cond))
+		p.body(v.True, depth+1)
+		if v.False != nil {
+			p.line(depth, "} else {")
+			p.body(v.False, depth+1)
+		}
+		p.line(depth, "}")
+	case FuncStmt:
+		keyword := "func"
+		if v.Inline {
+			keyword = "inline func"
+		}
+		p.line(depth, "%s %s(%s) {", keyword, v.Name, strings.Join(v.Inputs, ", "))
+		p.body(v.Body, depth+1)
+		p.line(depth, "}")
+	case TestStmt:
+		p.line(depth, "test %s {", p.name(v.Name))
+		p.body(v.Body, depth+1)
+		p.line(depth, "}")
+	case TestItemStmt:
+		if v.Kind != TestItemMock {
+			p.line(depth, "%s = %s;", v.Kind, p.strVal(v.Value))
+			break
+		}
+		key := v.Key
+		if !isIdentifier(key) {
+			key = p.name(key)
+		}
+		p.line(depth, "mock %s = %s;", key, p.strVal(v.Value))
+	default:
+		p.fail(fmt.Errorf("unknown statement type %T", statement))
+	}
+}
+
+func (p *printer) body(statements []Statement, depth int) {
+	for i, statement := range statements {
+		pos := statementPos(statement)
+		if _, ok := statement.(CommentStmt); ok && p.trailing(pos) {
+			// 行尾注释接在上一行后面
+			p.buf.Truncate(p.buf.Len() - 1)
+			fmt.Fprintf(&p.buf, " %s\n", strings.TrimRightFunc(statement.(CommentStmt).Comment, unicode.IsSpace))
+			continue
+		}
+		// 函数和它前面的注释与其他语句之间空一行，源码中的空行也保留下来
+		if i > 0 && (depth == 0 && startsGroup(statements[i-1], statement) || p.blankBefore(pos)) {
+			p.buf.WriteString("\n")
+		}
+		p.statement(statement, depth)
+	}
+}
+
+// trailing checks if the source line has other tokens before pos
+func (p *printer) trailing(pos Pos) bool {
+	if !pos.IsValid() || pos.Line > len(p.lines) || pos.Column > len(p.lines[pos.Line-1])+1 {
+		return false
+	}
+	return strings.TrimSpace(p.lines[pos.Line-1][:pos.Column-1]) != ""
+}
+
+// blankBefore checks if the statement at pos begins a line that follows a blank line
+func (p *printer) blankBefore(pos Pos) bool {
+	if !pos.IsValid() || pos.Line < 2 || pos.Line > len(p.lines) || p.trailing(pos) {
+		return false
+	}
+	return strings.TrimSpace(p.lines[pos.Line-2]) == ""
+}
+
+// statementPos returns the position of a statement
+func statementPos(statement Statement) Pos {
+	switch v := statement.(type) {
+	case AssignStmt:
+		return v.Pos
+	case NodeAssignStmt:
+		return v.Pos
+	case FuncCallStmt:
+		return v.Pos
+	case NodeValStmt:
+		return v.Pos
+	case CommentStmt:
+		return v.Pos
+	case IfStmt:
+		return v.Pos
+	case FuncStmt:
+		return v.Pos
+	case TestStmt:
+		return v.Pos
+	case TestItemStmt:
+		return v.Pos
+	}
+	return Pos{}
+}
+
+// cond returns the condition of an if statement
+func (p *printer) cond(cond NodeExp) string {
+	switch v := cond.Value.(type) {
+	case string:
+		return v
+	case FuncCallStmt:
+		// 条件中的函数调用也以分号结尾
+		return p.call(v) + ";"
+	case *FuncCallStmt:
+		return p.call(*v) + ";"
+	default:
+		p.fail(fmt.Errorf("unknown cond %v", cond.Value))
+		return ""
+	}
+}
+
+// callLine writes a call statement, putting every arg on its own line if it is too long
+func (p *printer) callLine(depth int, prefix string, call FuncCallStmt) {
+	head, args := p.callParts(call)
+	line := prefix + p.call(call) + ";"
+	if len(args) == 0 || len(indentUnit)*depth+len(line) <= maxLineWidth && !strings.Contains(line, "\n") {
+		p.line(depth, "%s", line)
+		return
+	}
+	p.line(depth, "%s%s,", prefix, head)
+	for i, arg := range args {
+		if i == len(args)-1 {
+			p.line(depth+1, "%s);", arg)
+		} else {
+			p.line(depth+1, "%s,", arg)
+		}
+	}
+}
+
+// call returns a builtin, model or inline function call without the semicolon
+func (p *printer) call(call FuncCallStmt) string {
+	head, args := p.callParts(call)
+	if len(args) == 0 {
+		return head + ")"
+	}
+	return head + ", " + strings.Join(args, ", ") + ")"
+}
+
+// callParts returns a call up to its inputs, and its args
+func (p *printer) callParts(call FuncCallStmt) (string, []string) {
+	var inputs []string
+	for _, input := range call.Inputs {
+		inputs = append(inputs, fmt.Sprint(input.Value))
+	}
+	input := "[" + strings.Join(inputs, ", ") + "]"
+	var head string
+	switch call.Type {
+	case FuncCallTypeInline:
+		head = fmt.Sprintf("@call(%s, %s", call.FuncName, input)
+	case FuncCallTypeBuiltin, FuncCallTypeModel:
+		// 只有一个输入时省略方括号
+		if len(inputs) == 1 {
+			input = inputs[0]
+		}
+		head = fmt.Sprintf("%s(%s, %s", call.Type, p.name(call.FuncName), input)
+	default:
+		p.fail(fmt.Errorf("unknown func call type %v", call.Type))
+	}
+	var args []string
+	for _, arg := range call.Args {
+		args = append(args, fmt.Sprintf("%s=%s", arg.Name, p.strVal(arg.Value)))
+	}
+	return head, args
+}
+
+// isIdentifier checks if s can be written as an identifier
+func isIdentifier(s string) bool {
+	l := &lexer{}
+	for _, r := range s {
+		if !l.isIdentifier(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (p *printer) strVal(val StrVal) string {
+	if val.Type == StrValTypeConst {
+		return "@" + val.Value
+	}
+	return p.quote(val.Value)
+}
+
+// name quotes a name with " unless it can not be
+func (p *printer) name(s string) string {
+	if strings.ContainsAny(s, "\"\n") {
+		return p.quote(s)
+	}
+	return `"` + s + `"`
+}
+
+func (p *printer) quote(s string) string {
+	quoted, err := Quote(s)
+	p.fail(err)
+	return quoted
+}
+
+// fail records the first error
+func (p *printer) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestFprint tests printing statements and parsing them back
+func TestFprint(t *testing.T) {
+	input := `@prefix = "ime_rec";
+// lookup cache
+inline func lookupCache(key) {
+	builtin("lookup_cache", key, prefix=@prefix);
+}
+func main(input) {
+	cacheRes=@call(lookupCache,[input]);
+	if(cacheRes){
+		result=model("ner", [input, cacheRes], default_value='{"a":"b"}', text=` + "`it's \"x\"`" + `);
+		result;
+	}else{
+		builtin("identity",[]);
+	}
+}`
+	var buf bytes.Buffer
+	require.NoError(t, Fprint(&buf, NewParser(input).Parse()))
+	expected := `@prefix = 'ime_rec';
+
+// lookup cache
+inline func lookupCache(key) {
+    builtin("lookup_cache", key, prefix=@prefix);
+}
+
+func main(input) {
+    cacheRes = @call(lookupCache, [input]);
+    if (cacheRes) {
+        result = model("ner", [input, cacheRes], default_value='{"a":"b"}', text=` + "`it's \"x\"`" + `);
+        result;
+    } else {
+        builtin("identity", []);
+    }
+}
+`
+	require.Equal(t, expected, buf.String())
+	require.Equal(t, clearPos(NewParser(input).Parse()), clearPos(NewParser(buf.String()).Parse()))
+}
+
+// TestQuote tests choosing the quote of a string literal
+func TestQuote(t *testing.T) {
+	for s, expected := range map[string]string{
+		`.a`:           `'.a'`,
+		`{"a": 1}`:     `'{"a": 1}'`,
+		`it's`:         `"it's"`,
+		`it's "a"`:     "`it's \"a\"`",
+		"it's\n":       "`it's\n`",
+		"{\n\"a\": 1}": "`{\n\"a\": 1}`",
+	} {
+		quoted, err := Quote(s)
+		require.NoError(t, err)
+		require.Equal(t, expected, quoted)
+	}
+	_, err := Quote("'\"`")
+	require.Error(t, err)
+	_, err = Quote("it's\n`")
+	require.Error(t, err)
+}
+
+// TestFormat tests keeping comments and blank lines, wrapping long calls and formatting idempotently
+func TestFormat(t *testing.T) {
+	input := "@prefix=`ime_rec`; // the cache prefix\n" + `
+// a function to set cache
+inline func setCache(key, result) {
+	cacheReq=builtin("jq",[key,result],filter=` + "`" + `{"key": .[0], "payload": .[1], "ttl": 259200000}` + "`" + `);
+
+
+	builtin("set_cache", cacheReq, prefix=@prefix);   
+}
+func main(input) { // entry
+  result=builtin("http", input, endpoint=` + "`http://192002625-146479.Production/suggestion/`" + `,
+        method=` + "`post`" + `, max_retry_times="3", default_value=` + "`" + `{"actions":[]}` + "`" + `, timeout="800ms");
+
+  @call(setCache, [input, result]);
+  if(result){
+    // hit
+    result;
+  }else{ result; }
+}
+`
+	expected := `@prefix = 'ime_rec'; // the cache prefix
+
+// a function to set cache
+inline func setCache(key, result) {
+    cacheReq = builtin("jq", [key, result],
+        filter='{"key": .[0], "payload": .[1], "ttl": 259200000}');
+
+    builtin("set_cache", cacheReq, prefix=@prefix);
+}
+
+func main(input) { // entry
+    result = builtin("http", input,
+        endpoint='http://192002625-146479.Production/suggestion/',
+        method='post',
+        max_retry_times='3',
+        default_value='{"actions":[]}',
+        timeout='800ms');
+
+    @call(setCache, [input, result]);
+    if (result) {
+        // hit
+        result;
+    } else {
+        result;
+    }
+}
+`
+	formatted, err := Format(input)
+	require.NoError(t, err)
+	require.Equal(t, expected, formatted)
+	require.Equal(t, clearPos(NewParser(input).Parse()), clearPos(NewParser(formatted).Parse()))
+
+	again, err := Format(formatted)
+	require.NoError(t, err)
+	require.Equal(t, formatted, again)
+}
+
+// TestFormatTest tests formatting tests of the main function
+func TestFormatTest(t *testing.T) {
+	input := "func main(input) { input; }\n" +
+		"// cache miss\n" +
+		"test \"miss\" {\n" +
+		"input=`{\"a\": 1}`;   mock lookup_cache='{\"found\":false}';\n" +
+		"\n" +
+		"  mock \"builtin.http\"=@empty; // no actions\n" +
+		"expect=`{\n  \"a\": 1\n}`;}\n" +
+		"test 'it\"s' { }\n"
+	expected := "func main(input) {\n" +
+		"    input;\n" +
+		"}\n" +
+		"\n" +
+		"// cache miss\n" +
+		"test \"miss\" {\n" +
+		"    input = '{\"a\": 1}';\n" +
+		"    mock lookup_cache = '{\"found\":false}';\n" +
+		"\n" +
+		"    mock \"builtin.http\" = @empty; // no actions\n" +
+		"    expect = `{\n  \"a\": 1\n}`;\n" +
+		"}\n" +
+		"\n" +
+		"test 'it\"s' {\n" +
+		"}\n"
+	formatted, err := Format(input)
+	require.NoError(t, err)
+	require.Equal(t, expected, formatted)
+	require.Equal(t, clearPos(NewParser(input).Parse()), clearPos(NewParser(formatted).Parse()))
+
+	again, err := Format(formatted)
+	require.NoError(t, err)
+	require.Equal(t, formatted, again)
+}
@@ -23,6 +23,8 @@ func (s StrExpType) String() string {
 type StrVal struct {
 	Type  StrExpType
 	Value string
+	// Pos 是字符串开头引号的位置，常量引用时是 @ 后面常量名的位置
+	Pos Pos
 }
 
 type NodeExpType int
@@ -35,6 +37,8 @@ const (
 type NodeExp struct {
 	Type  NodeExpType
 	Value interface{}
+	// Pos 是变量名或者函数调用的位置
+	Pos Pos
 }
 
 func (n NodeExp) String() string {
@@ -52,6 +56,8 @@ func (n NodeExp) String() string {
 type ArgPair struct {
 	Name  string
 	Value StrVal
+	// Pos 是参数名的位置
+	Pos Pos
 }
 
 // Statement is an interface for all statements
@@ -64,6 +70,9 @@ type Statement interface {
 type AssignStmt struct {
 	VarName string
 	Value   StrVal
+	Pos     Pos
+	// NamePos 是 @ 后面常量名的位置
+	NamePos Pos
 }
 
 func (a AssignStmt) String() string {
@@ -74,6 +83,7 @@ func (a AssignStmt) String() string {
 type NodeAssignStmt struct {
 	VarName string
 	Value   FuncCallStmt
+	Pos     Pos
 }
 
 func (a NodeAssignStmt) String() string {
@@ -107,6 +117,10 @@ type FuncCallStmt struct {
 	FuncName string
 	Args     []ArgPair
 	Inputs   []NodeExp
+	// Pos 是 builtin、model 或者 @call 的位置
+	Pos Pos
+	// NamePos 是函数名的位置，builtin 和 model 的函数名是字符串，位置是开头的引号
+	NamePos Pos
 }
 
 func (m FuncCallStmt) String() string {
@@ -118,6 +132,7 @@ type IfStmt struct {
 	Cond  NodeExp
 	True  []Statement
 	False []Statement
+	Pos   Pos
 }
 
 func (i IfStmt) String() string {
@@ -133,6 +148,12 @@ type FuncStmt struct {
 	Name   string
 	Inputs []string
 	Body   []Statement
+	// Inline 为true时函数是用 inline func 定义的
+	Inline bool
+	Pos    Pos
+	// NamePos 是函数名的位置，InputPos 是每个参数名的位置
+	NamePos  Pos
+	InputPos []Pos
 }
 
 func (f FuncStmt) String() string {
@@ -144,6 +165,7 @@ func (f FuncStmt) String() string {
 // NodeValStmt is a statement that return a node
 type NodeValStmt struct {
 	Name string
+	Pos  Pos
 }
 
 func (n NodeValStmt) String() string {
@@ -153,8 +175,65 @@ func (n NodeValStmt) String() string {
 // CommentStmt is a statement that is a comment
 type CommentStmt struct {
 	Comment string
+	Pos     Pos
 }
 
 func (c CommentStmt) String() string {
 	return fmt.Sprintf("%s\n", c.Comment)
 }
+
+// TestStmt is a statement that defines a test of the main function
+type TestStmt struct {
+	Name string
+	// Body 是 TestItemStmt 和注释
+	Body []Statement
+	Pos  Pos
+	// NamePos 是测试名字符串开头引号的位置
+	NamePos Pos
+}
+
+func (t TestStmt) String() string {
+	return fmt.Sprintf(`test %q {
+	%v
+}\n`, t.Name, t.Body)
+}
+
+type TestItemKind int
+
+const (
+	TestItemInput  TestItemKind = iota // input = `...`;
+	TestItemMock                       // mock lookup_cache = `...`;
+	TestItemExpect                     // expect = `...`;
+)
+
+func (k TestItemKind) String() string {
+	switch k {
+	case TestItemInput:
+		return "input"
+	case TestItemMock:
+		return "mock"
+	case TestItemExpect:
+		return "expect"
+	default:
+		return "unknown"
+	}
+}
+
+// TestItemStmt is a statement in a test that sets the input of main, mocks
+// the output of nodes, or sets the expected response
+type TestItemStmt struct {
+	Kind TestItemKind
+	// Key 是 mock 的节点名、节点类型或者op名
+	Key   string
+	Value StrVal
+	Pos   Pos
+	// KeyPos 是 Key 的位置，Key 是字符串时是开头的引号
+	KeyPos Pos
+}
+
+func (t TestItemStmt) String() string {
+	if t.Kind == TestItemMock {
+		return fmt.Sprintf("mock %s = %v\n", t.Key, t.Value)
+	}
+	return fmt.Sprintf("%s = %v\n", t.Kind, t.Value)
+}
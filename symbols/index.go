@@ -0,0 +1,159 @@
+package symbols
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// Index is the resolved symbols of the dagl files in a workspace. The files
+// don't import each other, so a name is resolved in its own file; renaming a
+// function or a constant renames it in every file defining it.
+type Index struct {
+	files map[string]*indexedFile
+}
+
+type indexedFile struct {
+	src  string
+	file *File
+	// err 是语法错误，有语法错误的文件不能改名
+	err error
+}
+
+// NewIndex creates an empty index
+func NewIndex() *Index {
+	return &Index{files: make(map[string]*indexedFile)}
+}
+
+// Add parses and resolves the source of a file, replacing the file indexed at the same path
+func (x *Index) Add(path, src string) {
+	statements, err := parser.NewParser(src).TryParse()
+	x.files[path] = &indexedFile{src: src, file: Resolve(statements), err: err}
+}
+
+// AddDir adds the .dagl files under a directory, skipping hidden directories
+func (x *Index) AddDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".dagl" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		x.Add(path, string(data))
+		return nil
+	})
+}
+
+// Paths returns the paths of the indexed files, sorted
+func (x *Index) Paths() []string {
+	paths := make([]string, 0, len(x.files))
+	for path := range x.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Source returns the source of an indexed file
+func (x *Index) Source(path string) string {
+	if f := x.files[path]; f != nil {
+		return f.src
+	}
+	return ""
+}
+
+// File returns the resolved names of an indexed file and its syntax error
+func (x *Index) File(path string) (*File, error) {
+	if f := x.files[path]; f != nil {
+		return f.file, f.err
+	}
+	return nil, errors.Errorf("%s is not indexed", path)
+}
+
+// FileError is an error in an indexed file
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	var pe *parser.Error
+	if errors.As(e.Err, &pe) && pe.Pos.IsValid() {
+		return e.Path + ":" + pe.Pos.String() + ": " + pe.Msg
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Rename renames the symbols with a qualified name in all indexed files, see
+// File.Lookup for the names. It returns the references to rename keyed by path.
+// A file with syntax errors that contains the name fails the rename, as its
+// references can't be found.
+func (x *Index) Rename(old, name string) (map[string][]*Ref, error) {
+	// 变量的限定名是 函数名.变量名，源码中出现的是变量名
+	word := old[strings.LastIndexByte(old, '.')+1:]
+	renames := make(map[string][]*Ref)
+	found := false
+	for _, path := range x.Paths() {
+		f := x.files[path]
+		if f.err != nil {
+			if containsWord(f.src, word) {
+				return nil, &FileError{Path: path, Err: f.err}
+			}
+			continue
+		}
+		symbols := f.file.Lookup(old)
+		if len(symbols) == 0 {
+			continue
+		}
+		found = true
+		refs, err := f.file.Rename(symbols, name)
+		if err != nil {
+			return nil, &FileError{Path: path, Err: err}
+		}
+		if len(refs) > 0 {
+			renames[path] = refs
+		}
+	}
+	if !found {
+		return nil, errors.Errorf("no symbol %q found", old)
+	}
+	return renames, nil
+}
+
+// containsWord checks if src contains word as a whole identifier
+func containsWord(src, word string) bool {
+	for i := 0; ; {
+		j := strings.Index(src[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		before, _ := utf8.DecodeLastRuneInString(src[:start])
+		after, _ := utf8.DecodeRuneInString(src[end:])
+		if !ValidName(string(before)) && !ValidName(string(after)) {
+			return true
+		}
+		i = start + 1
+	}
+}
@@ -0,0 +1,116 @@
+package symbols
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"emperror.dev/errors"
+	"github.com/vuuihc/gfc/parser"
+)
+
+// keywords 是语法中有特殊含义的名字，不能用作符号名
+var keywords = map[string]bool{
+	"func": true, "inline": true, "builtin": true, "model": true,
+	"if": true, "else": true, "call": true,
+}
+
+// ValidName checks if name can be the name of a symbol
+func ValidName(name string) bool {
+	if name == "" || keywords[name] {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// QualifiedName returns the name Lookup finds the symbol by: the name of a
+// constant or a function, or function.name for a variable
+func (s *Symbol) QualifiedName() string {
+	if s.Kind == Var {
+		return s.Func.Name + "." + s.Name
+	}
+	return s.Name
+}
+
+// Lookup returns the symbols with a qualified name. A variable assigned several
+// times has a symbol for each assignment, and so has a constant or a function
+// defined again.
+func (f *File) Lookup(name string) []*Symbol {
+	var symbols []*Symbol
+	for _, symbol := range f.Symbols {
+		if symbol.QualifiedName() == name {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+// Rename returns the references to rename to give symbols a new name, sorted
+// by position. Only names are renamed, so string literals and comments are
+// left as they are. It fails if the new name could change what another name
+// resolves to.
+func (f *File) Rename(symbols []*Symbol, name string) ([]*Ref, error) {
+	if !ValidName(name) {
+		return nil, errors.Errorf("invalid name %q", name)
+	}
+	if len(symbols) == 0 || symbols[0].Name == name {
+		return nil, nil
+	}
+	old := symbols[0].Name
+	// 变量、常量和函数共用一个命名空间，内联函数还能读到调用者的变量，
+	// 所以新名字在文件中用过就可能改变名字的解析，保守地拒绝
+	for _, symbol := range f.Symbols {
+		if symbol.Name == name {
+			return nil, &parser.Error{Pos: symbol.Pos, Msg: fmt.Sprintf("%s %q is already defined", symbol.Kind, name)}
+		}
+	}
+	for _, ref := range f.Refs {
+		if ref.Name == name {
+			return nil, &parser.Error{Pos: ref.Pos, Msg: fmt.Sprintf("%q is used here", name)}
+		}
+		// 内联函数中没有解析的变量可能在展开时引用到被改名的变量
+		if ref.Name == old && ref.Kind == Var && ref.Symbol == nil && symbols[0].Kind == Var {
+			return nil, &parser.Error{Pos: ref.Pos, Msg: fmt.Sprintf("%q may refer to the renamed variable through an inline call", old)}
+		}
+	}
+	var refs []*Ref
+	for _, symbol := range symbols {
+		refs = append(refs, f.RefsTo(symbol)...)
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		a, b := refs[i].Pos, refs[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return refs, nil
+}
+
+// Replace replaces the names of references in src with name
+func Replace(src string, refs []*Ref, name string) (string, error) {
+	lines := strings.SplitAfter(src, "\n")
+	offsets := make([]int, len(lines))
+	for i := 1; i < len(lines); i++ {
+		offsets[i] = offsets[i-1] + len(lines[i-1])
+	}
+	var buf strings.Builder
+	last := 0
+	for _, ref := range refs {
+		if ref.Pos.Line < 1 || ref.Pos.Line > len(lines) {
+			return "", errors.Errorf("invalid position %s of %q", ref.Pos, ref.Name)
+		}
+		offset := offsets[ref.Pos.Line-1] + ref.Pos.Column - 1
+		if offset < last || offset > len(src) || !strings.HasPrefix(src[offset:], ref.Name) {
+			return "", errors.Errorf("%s: %q not found in source", ref.Pos, ref.Name)
+		}
+		buf.WriteString(src[last:offset])
+		buf.WriteString(name)
+		last = offset + len(ref.Name)
+	}
+	buf.WriteString(src[last:])
+	return buf.String(), nil
+}
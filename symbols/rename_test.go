@@ -0,0 +1,91 @@
+package symbols
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/parser"
+)
+
+func rename(t *testing.T, src, old, name string) (string, error) {
+	f := Resolve(parser.NewParser(src).Parse())
+	refs, err := f.Rename(f.Lookup(old), name)
+	if err != nil {
+		return "", err
+	}
+	renamed, err := Replace(src, refs, name)
+	require.NoError(t, err)
+	return renamed, nil
+}
+
+// TestRename tests renaming functions, constants and variables
+func TestRename(t *testing.T) {
+	renamed, err := rename(t, testCode, "lookupCache", "getCache")
+	require.NoError(t, err)
+	require.Contains(t, renamed, "inline func getCache(key) {")
+	require.Contains(t, renamed, "cacheRes = @call(getCache, [input]);")
+	// 注释不改
+	require.Contains(t, renamed, "// lookupCache looks up the cache")
+
+	// 字符串中的常量名不改
+	src := "@prefix = 'prefix';\n@other = @prefix;\nfunc main(input) {\n\tbuiltin(\"jq\", input, filter=@prefix);\n}\n"
+	renamed, err = rename(t, src, "prefix", "cachePrefix")
+	require.NoError(t, err)
+	require.Equal(t, "@cachePrefix = 'prefix';\n@other = @cachePrefix;\nfunc main(input) {\n\tbuiltin(\"jq\", input, filter=@cachePrefix);\n}\n", renamed)
+
+	// 变量的每次赋值都改名，别的函数中的同名变量不改
+	renamed, err = rename(t, testCode, "main.input", "req")
+	require.NoError(t, err)
+	require.Contains(t, renamed, "func main(req) {\n\treq = builtin(\"jq\", req, filter='.payload');\n\tcacheRes = @call(lookupCache, [req]);")
+	renamed, err = rename(t, testCode, "lookupCache.key", "cacheKey")
+	require.NoError(t, err)
+	require.Contains(t, renamed, "inline func lookupCache(cacheKey) {\n\tres = builtin(\"lookup_cache\", cacheKey, prefix=@prefix);")
+}
+
+// TestRenameConflicts tests that a rename which could change the resolution of names fails
+func TestRenameConflicts(t *testing.T) {
+	for _, c := range []struct {
+		old, name, err string
+	}{
+		{"lookupCache", "main", `9:6: function "main" is already defined`},
+		{"prefix", "hit", `13:3: variable "hit" is already defined`},
+		{"main.cacheRes", "result", `17:28: "result" is used here`},
+		{"main.input", "if", `invalid name "if"`},
+		{"main.input", "a-b", `invalid name "a-b"`},
+	} {
+		_, err := rename(t, testCode, c.old, c.name)
+		require.EqualError(t, err, c.err, c.old)
+	}
+
+	// 内联函数可能读到调用者中的变量
+	src := "inline func f(a) {\n\tbuiltin(\"jq\", x, filter='.');\n}\nfunc main(x) {\n\t@call(f, [x]);\n}\n"
+	_, err := rename(t, src, "main.x", "y")
+	require.EqualError(t, err, `2:16: "x" may refer to the renamed variable through an inline call`)
+}
+
+// TestIndexRename tests renaming a symbol in all files of an index
+func TestIndexRename(t *testing.T) {
+	index := NewIndex()
+	index.Add("a.dagl", testCode)
+	index.Add("b.dagl", "inline func lookupCache(key) {\n\tkey;\n}\nfunc main(input) {\n\t@call(lookupCache, [input]);\n}\n")
+	index.Add("c.dagl", "func main(input) {\n\tbuiltin(\"jq\", input, filter='.lookupCache');\n}\n")
+
+	renames, err := index.Rename("lookupCache", "getCache")
+	require.NoError(t, err)
+	require.Len(t, renames, 2)
+	require.Len(t, renames["a.dagl"], 2)
+	renamed, err := Replace(index.Source("b.dagl"), renames["b.dagl"], "getCache")
+	require.NoError(t, err)
+	require.Equal(t, "inline func getCache(key) {\n\tkey;\n}\nfunc main(input) {\n\t@call(getCache, [input]);\n}\n", renamed)
+
+	_, err = index.Rename("missing", "x")
+	require.EqualError(t, err, `no symbol "missing" found`)
+
+	// 有语法错误的文件中出现了这个名字
+	index.Add("d.dagl", "func main(input) {\n\t@call(lookupCache, [input] x);\n}\n")
+	_, err = index.Rename("lookupCache", "getCache")
+	require.EqualError(t, err, "d.dagl:2:29: expect ), got identifier x")
+	index.Add("d.dagl", "func main(input) {\n\tinput\n}\n")
+	_, err = index.Rename("lookupCache", "getCache")
+	require.NoError(t, err)
+}
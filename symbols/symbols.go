@@ -0,0 +1,255 @@
+// Package symbols resolves the names in dagl source to their definitions.
+package symbols
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/vuuihc/gfc/parser"
+)
+
+// Kind is the kind of a symbol
+type Kind int
+
+const (
+	Var   Kind = iota // 节点变量，包括函数参数
+	Const             // 顶层定义的常量
+	Func              // 函数
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Var:
+		return "variable"
+	case Const:
+		return "constant"
+	case Func:
+		return "function"
+	default:
+		return "unknown"
+	}
+}
+
+// Symbol is a defined name
+type Symbol struct {
+	Name string
+	Kind Kind
+	// Pos 是定义处名字的位置
+	Pos parser.Pos
+	// Stmt 是定义的语句：函数是 FuncStmt，常量是 AssignStmt，变量是 NodeAssignStmt，参数是所在的 FuncStmt
+	Stmt parser.Statement
+	// Func 是变量和参数所在的函数
+	Func *parser.FuncStmt
+	// Param 为true时变量是函数参数
+	Param bool
+	// Doc 是紧挨在函数或者常量定义前面的注释
+	Doc string
+}
+
+// Ref is an occurrence of a name in the source, definitions included
+type Ref struct {
+	Name string
+	Kind Kind
+	// Pos 是名字的位置
+	Pos parser.Pos
+	// Symbol 是名字解析到的定义，无法解析时为nil
+	Symbol *Symbol
+}
+
+// File is the resolved names of a parsed dagl file
+type File struct {
+	Symbols []*Symbol
+	// Refs 按位置排序
+	Refs []*Ref
+	// globals 是顶层定义的常量和函数，后定义的覆盖先定义的
+	globals scope
+}
+
+// scope maps names to symbols. Like the generator's Stack, variables,
+// constants and functions share one namespace.
+type scope map[string]*Symbol
+
+func (s scope) copy() scope {
+	c := make(scope, len(s))
+	for k, v := range s {
+		c[k] = v
+	}
+	return c
+}
+
+// Resolve resolves the names in statements. Variables are resolved lexically,
+// so a variable an inline function reads from its caller is left unresolved.
+func Resolve(statements []parser.Statement) *File {
+	f := &File{globals: scope{}}
+	var funcs []*Symbol
+	var tests []parser.TestStmt
+	for i, statement := range statements {
+		switch v := statement.(type) {
+		case parser.AssignStmt:
+			// @b = @a 引用的是在它之前定义的常量
+			f.strVal(v.Value, f.globals)
+			f.define(f.globals, &Symbol{Name: v.VarName, Kind: Const, Pos: v.NamePos, Stmt: v, Doc: docComment(statements, i)})
+		case parser.FuncStmt:
+			fn := v
+			symbol := &Symbol{Name: v.Name, Kind: Func, Pos: v.NamePos, Stmt: v, Func: &fn, Doc: docComment(statements, i)}
+			f.define(f.globals, symbol)
+			funcs = append(funcs, symbol)
+		case parser.TestStmt:
+			tests = append(tests, v)
+		}
+	}
+	// 函数在所有顶层语句之后才被展开，能看到所有的常量和函数
+	for _, symbol := range funcs {
+		fn := symbol.Func
+		s := f.globals.copy()
+		for i, input := range fn.Inputs {
+			var pos parser.Pos
+			if i < len(fn.InputPos) {
+				pos = fn.InputPos[i]
+			}
+			f.define(s, &Symbol{Name: input, Kind: Var, Pos: pos, Stmt: *fn, Func: fn, Param: true})
+		}
+		f.body(fn, fn.Body, s)
+	}
+	for _, test := range tests {
+		for _, statement := range test.Body {
+			if item, ok := statement.(parser.TestItemStmt); ok {
+				f.strVal(item.Value, f.globals)
+			}
+		}
+	}
+	sort.SliceStable(f.Refs, func(i, j int) bool {
+		a, b := f.Refs[i].Pos, f.Refs[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return f
+}
+
+// define defines a symbol in a scope and records its definition as a reference
+func (f *File) define(s scope, symbol *Symbol) {
+	s[symbol.Name] = symbol
+	f.Symbols = append(f.Symbols, symbol)
+	f.Refs = append(f.Refs, &Ref{Name: symbol.Name, Kind: symbol.Kind, Pos: symbol.Pos, Symbol: symbol})
+}
+
+// ref records a reference to a name of the given kind
+func (f *File) ref(s scope, name string, kind Kind, pos parser.Pos) {
+	symbol := s[name]
+	if symbol != nil && symbol.Kind != kind {
+		symbol = nil
+	}
+	f.Refs = append(f.Refs, &Ref{Name: name, Kind: kind, Pos: pos, Symbol: symbol})
+}
+
+func (f *File) strVal(val parser.StrVal, s scope) {
+	if val.Type == parser.StrValTypeConst {
+		f.ref(s, val.Value, Const, val.Pos)
+	}
+}
+
+func (f *File) call(call parser.FuncCallStmt, s scope) {
+	if call.Type == parser.FuncCallTypeInline {
+		f.ref(s, call.FuncName, Func, call.NamePos)
+	}
+	for _, input := range call.Inputs {
+		if name, ok := input.Value.(string); ok {
+			f.ref(s, name, Var, input.Pos)
+		}
+	}
+	for _, arg := range call.Args {
+		f.strVal(arg.Value, s)
+	}
+}
+
+// body resolves the statements of a function body or a branch
+func (f *File) body(fn *parser.FuncStmt, statements []parser.Statement, s scope) {
+	for _, statement := range statements {
+		switch v := statement.(type) {
+		case parser.NodeAssignStmt:
+			f.call(v.Value, s)
+			f.define(s, &Symbol{Name: v.VarName, Kind: Var, Pos: v.Pos, Stmt: v, Func: fn})
+		case parser.FuncCallStmt:
+			f.call(v, s)
+		case parser.NodeValStmt:
+			f.ref(s, v.Name, Var, v.Pos)
+		case parser.IfStmt:
+			switch cond := v.Cond.Value.(type) {
+			case string:
+				f.ref(s, cond, Var, v.Cond.Pos)
+			case parser.FuncCallStmt:
+				f.call(cond, s)
+			}
+			// 和生成器一样，true 分支中赋值的变量在if之后不可见，else 分支中的可见
+			f.body(fn, v.True, s.copy())
+			f.body(fn, v.False, s)
+		}
+	}
+}
+
+// docComment returns the comments right above the statement at index i, without the //
+func docComment(statements []parser.Statement, i int) string {
+	line := statementLine(statements[i])
+	var lines []string
+	for j := i - 1; j >= 0; j-- {
+		comment, ok := statements[j].(parser.CommentStmt)
+		if !ok || comment.Pos.Line != line-1 {
+			break
+		}
+		text := strings.TrimPrefix(comment.Comment, "//")
+		lines = append([]string{strings.TrimSpace(text)}, lines...)
+		line--
+	}
+	return strings.Join(lines, "\n")
+}
+
+func statementLine(statement parser.Statement) int {
+	switch v := statement.(type) {
+	case parser.AssignStmt:
+		return v.Pos.Line
+	case parser.FuncStmt:
+		return v.Pos.Line
+	}
+	return 0
+}
+
+// RefAt returns the reference whose name covers pos, or nil. A position just
+// after the name also counts, where editors put the cursor after typing it.
+func (f *File) RefAt(pos parser.Pos) *Ref {
+	for _, ref := range f.Refs {
+		if ref.Pos.Line == pos.Line && ref.Pos.Column <= pos.Column && pos.Column <= ref.Pos.Column+len(ref.Name) {
+			return ref
+		}
+	}
+	return nil
+}
+
+// RefsTo returns the references resolved to a symbol, its definition included
+func (f *File) RefsTo(symbol *Symbol) []*Ref {
+	var refs []*Ref
+	for _, ref := range f.Refs {
+		if ref.Symbol == symbol {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// Global returns the top level constant or function visible in function bodies
+func (f *File) Global(name string, kind Kind) *Symbol {
+	if symbol := f.globals[name]; symbol != nil && symbol.Kind == kind {
+		return symbol
+	}
+	return nil
+}
+
+// Globals returns the top level symbols of a kind visible in function bodies, sorted by name
+func (f *File) Globals(kind Kind) []*Symbol {
+	var symbols []*Symbol
+	for _, symbol := range f.globals {
+		if symbol.Kind == kind {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+	return symbols
+}
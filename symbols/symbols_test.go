@@ -0,0 +1,102 @@
+package symbols
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vuuihc/gfc/parser"
+)
+
+const testCode = `@prefix = 'p';
+@other = @prefix;
+// lookupCache looks up the cache
+// with the key
+inline func lookupCache(key) {
+	res = builtin("lookup_cache", key, prefix=@prefix);
+	res;
+}
+func main(input) {
+	input = builtin("jq", input, filter='.payload');
+	cacheRes = @call(lookupCache, [input]);
+	if (cacheRes) {
+		hit = builtin("jq", cacheRes, filter='.a');
+	} else {
+		miss = builtin("jq", cacheRes, filter='.b');
+	}
+	builtin("jq", [miss, hit, result], filter='.[0]');
+}`
+
+// TestResolve tests resolving references to their definitions
+func TestResolve(t *testing.T) {
+	f := Resolve(parser.NewParser(testCode).Parse())
+
+	prefix := f.Global("prefix", Const)
+	require.NotNil(t, prefix)
+	require.Equal(t, parser.Pos{Line: 1, Column: 2}, prefix.Pos)
+	require.Len(t, f.RefsTo(prefix), 3)
+
+	lookupCache := f.Global("lookupCache", Func)
+	require.NotNil(t, lookupCache)
+	require.Equal(t, "lookupCache looks up the cache\nwith the key", lookupCache.Doc)
+	ref := f.RefAt(parser.Pos{Line: 11, Column: 20})
+	require.Equal(t, "lookupCache", ref.Name)
+	require.Same(t, lookupCache, ref.Symbol)
+
+	// 参数 key 在函数体中被引用
+	ref = f.RefAt(parser.Pos{Line: 6, Column: 32})
+	require.Equal(t, "key", ref.Name)
+	require.True(t, ref.Symbol.Param)
+	require.Equal(t, parser.Pos{Line: 5, Column: 25}, ref.Symbol.Pos)
+
+	// input 赋值语句右边引用的是参数，之后引用的是新的变量
+	ref = f.RefAt(parser.Pos{Line: 10, Column: 24})
+	require.True(t, ref.Symbol.Param)
+	ref = f.RefAt(parser.Pos{Line: 11, Column: 33})
+	require.False(t, ref.Symbol.Param)
+	require.Equal(t, parser.Pos{Line: 10, Column: 2}, ref.Symbol.Pos)
+
+	// true 分支中的变量在if之后不可见，else 分支中的可见
+	ref = f.RefAt(parser.Pos{Line: 17, Column: 17})
+	require.Equal(t, "miss", ref.Name)
+	require.NotNil(t, ref.Symbol)
+	ref = f.RefAt(parser.Pos{Line: 17, Column: 23})
+	require.Equal(t, "hit", ref.Name)
+	require.Nil(t, ref.Symbol)
+	require.Nil(t, f.RefAt(parser.Pos{Line: 17, Column: 3}))
+}
+
+// TestResolveKinds tests that a name resolves only to a symbol of the kind it is used as
+func TestResolveKinds(t *testing.T) {
+	f := Resolve(parser.NewParser(`@f = 'x';
+inline func f(a) {
+	a;
+}
+func main(input) {
+	@call(f, [input]);
+	builtin("jq", input, filter=@f);
+}`).Parse())
+	// 后定义的函数覆盖了常量
+	require.NotNil(t, f.Global("f", Func))
+	require.Nil(t, f.Global("f", Const))
+	require.NotNil(t, f.RefAt(parser.Pos{Line: 6, Column: 8}).Symbol)
+	require.Nil(t, f.RefAt(parser.Pos{Line: 7, Column: 31}).Symbol)
+	require.Equal(t, []*Symbol{f.Global("f", Func), f.Global("main", Func)}, f.Globals(Func))
+}
+
+// TestResolveTests tests resolving the constants used in tests of the main function
+func TestResolveTests(t *testing.T) {
+	f := Resolve(parser.NewParser(`test "miss" {
+	input = @input;
+	mock lookup_cache = @miss;
+}
+@input = '{}';
+func main(input) {
+	input;
+}`).Parse())
+	ref := f.RefAt(parser.Pos{Line: 2, Column: 11})
+	require.Equal(t, "input", ref.Name)
+	require.Same(t, f.Global("input", Const), ref.Symbol)
+	ref = f.RefAt(parser.Pos{Line: 3, Column: 23})
+	require.Equal(t, "miss", ref.Name)
+	require.Nil(t, ref.Symbol)
+}